@@ -1,16 +1,24 @@
 package aof
 
 import (
+	"errors"
+	"fmt"
 	"go-redis/config"
 	databaseface "go-redis/interface/database"
+	"go-redis/interface/resp"
 	"go-redis/lib/logger"
+	"go-redis/lib/sync/atomic"
 	"go-redis/lib/utils"
+	"go-redis/rdb"
 	"go-redis/resp/connection"
-	"go-redis/resp/parser"
 	"go-redis/resp/reply"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // CmdLine is alias for [][]byte, represents a command line
@@ -18,105 +26,603 @@ type CmdLine = [][]byte
 
 const (
 	aofQueueSize = 1 << 16
+	// autoRewriteInterval is the period of checking the threshold of auto rewrite, like serverCron of redis
+	autoRewriteInterval = 100 * time.Millisecond
+
+	defaultAppendFilename = "appendonly.aof"
+	defaultAppendDirname  = "appendonlydir"
+
+	baseSuffix = ".base"
+	incrSuffix = ".incr"
+
+	rdbMagic = "REDIS" // base file in rdb format begins with it
+)
+
+const (
+	// FsyncAlways do fsync for every write, the client is replied after the write is durable
+	FsyncAlways = "always"
+	// FsyncEverySec do fsync every second
+	FsyncEverySec = "everysec"
+	// FsyncNo lets operating system decides when to fsync
+	FsyncNo = "no"
 )
 
 type payload struct {
-	cmdLine CmdLine
-	dbIndex int
+	cmdLines []CmdLine
+	dbIndex  int
+	// seq is the sequence number of payloads sent by AddAof, it's 0 for callbacks
+	seq uint64
+	// callback is called by the aof goroutine instead of writing, after the payloads queued before it are written
+	callback func()
 }
 
 // AofHandler receive msgs from channel and write to AOF file
 type AofHandler struct {
-	db          databaseface.Database
-	aofChan     chan *payload
+	db            databaseface.Database
+	snapshotMaker SnapshotMaker
+	aofChan       chan *payload
+	// aofFile is the latest incr file, aofFilename is its path
 	aofFile     *os.File
 	aofFilename string
+	aofFsync    string
 	currentDB   int
+	// lastTimestamp is the unix time of the latest timestamp annotation in aofFile
+	lastTimestamp int64
+
+	// dir is appenddirname, fileName is the prefix of files in it
+	dir      string
+	fileName string
+	manifest *manifest
+
+	// pausingAof stops writing aof while a rewrite is starting or finishing,
+	// it protects aofFile, aofFilename, currentDB, manifest and aofSize
+	pausingAof sync.Mutex
+	rewriting  atomic.Boolean
+	// aofSize is the total size of aof files, baseSize is the size after the latest rewrite
+	aofSize  int64
+	baseSize int64
+
+	// closeMu protects closed and sending to aofChan, finished is closed after aofChan is drained
+	closeMu  sync.RWMutex
+	closed   bool
+	finished chan struct{}
+	// abort stops handleAof before the channel is drained, when shutdown-timeout is reached
+	abort chan struct{}
+	// queuedSeq is the sequence number of the latest payload sent by AddAof, it's protected by closeMu
+	queuedSeq uint64
+	// syncedSeq is the sequence number of the latest payload fsynced for appendfsync always,
+	// syncCond is broadcast when it grows or aof is closed
+	syncMu     sync.Mutex
+	syncCond   *sync.Cond
+	syncedSeq  uint64
+	syncClosed bool
 }
 
 // NewAOFHandler creates a new aof.AofHandler
-func NewAOFHandler(db databaseface.Database) (*AofHandler, error) {
+// snapshotMaker takes snapshots of db, it's used by aof rewrite
+func NewAOFHandler(db databaseface.Database, snapshotMaker SnapshotMaker) (*AofHandler, error) {
 	handler := &AofHandler{}
-	handler.aofFilename = config.Properties.AppendFilename
+	handler.dir, handler.fileName = aofPaths()
 	handler.db = db
+	handler.snapshotMaker = snapshotMaker
+	handler.aofFsync = strings.ToLower(config.Properties.AppendFsync)
+	switch handler.aofFsync {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+	case "":
+		handler.aofFsync = FsyncEverySec
+	default:
+		logger.Warn("unknown appendfsync policy " + handler.aofFsync + ", use everysec")
+		handler.aofFsync = FsyncEverySec
+	}
+	if err := handler.openManifest(); err != nil {
+		return nil, err
+	}
 	// 重载数据
-	handler.LoadAof()
-	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err := handler.LoadAof(); err != nil {
+		return nil, err
+	}
+	if err := handler.openIncrFile(); err != nil {
+		return nil, err
+	}
+	size, err := handler.filesSize(handler.manifest.files())
 	if err != nil {
 		return nil, err
 	}
-	handler.aofFile = aofFile
+	handler.aofSize = size
+	handler.baseSize = size
+	// the db selected at the end of file is unknown, so SELECT is always written before the first command
+	handler.currentDB = -1
 	handler.aofChan = make(chan *payload, aofQueueSize)
+	handler.finished = make(chan struct{})
+	handler.abort = make(chan struct{})
+	handler.syncCond = sync.NewCond(&handler.syncMu)
 	go func() {
 		handler.handleAof()
 	}()
+	if handler.aofFsync == FsyncEverySec {
+		go handler.fsyncEverySecond()
+	}
+	go handler.autoRewrite()
 	return handler, nil
 }
 
+// aofPaths returns appenddirname and the prefix of aof files
+func aofPaths() (dir string, fileName string) {
+	filename := config.Properties.AppendFilename
+	if filename == "" {
+		filename = defaultAppendFilename
+	}
+	dir = config.Properties.AppendDirname
+	if dir == "" {
+		dir = defaultAppendDirname
+	}
+	if !filepath.IsAbs(dir) {
+		// appenddirname is relative to the directory of appendfilename
+		dir = filepath.Join(filepath.Dir(filename), dir)
+	}
+	return dir, filepath.Base(filename)
+}
+
+func (handler *AofHandler) path(info *aofInfo) string {
+	return filepath.Join(handler.dir, info.name)
+}
+
+func (handler *AofHandler) manifestPath() string {
+	return filepath.Join(handler.dir, handler.fileName+manifestSuffix)
+}
+
+// openManifest reads manifest in appenddirname. If there is no manifest but a single aof file
+// written by the old version exists, it's moved into appenddirname as the base file
+func (handler *AofHandler) openManifest() error {
+	if err := os.MkdirAll(handler.dir, 0755); err != nil {
+		return err
+	}
+	m, err := readManifest(handler.manifestPath())
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		handler.manifest = m
+		handler.removeHistory()
+		return nil
+	}
+	m = &manifest{}
+	legacyFile := config.Properties.AppendFilename
+	if info, err := os.Stat(legacyFile); err == nil && !info.IsDir() {
+		base := &aofInfo{name: handler.fileName, seq: 1, fileType: fileTypeBase}
+		if err := os.Rename(legacyFile, handler.path(base)); err != nil {
+			return err
+		}
+		m.base = base
+		m.baseSeq = base.seq
+		logger.Info("moved aof file " + legacyFile + " into " + handler.dir + " as base file")
+		if err := writeManifest(handler.manifestPath(), m); err != nil {
+			return err
+		}
+	}
+	handler.manifest = m
+	return nil
+}
+
+// openIncrFile opens the latest incr file for appending, creates one if there is no incr file
+func (handler *AofHandler) openIncrFile() error {
+	m := handler.manifest
+	if len(m.incrs) == 0 {
+		return handler.rotateIncrFile()
+	}
+	filename := handler.path(m.incrs[len(m.incrs)-1])
+	aofFile, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	handler.aofFile = aofFile
+	handler.aofFilename = filename
+	return nil
+}
+
+// rotateIncrFile creates a new incr file, the following commands are written into it.
+// The caller should hold pausingAof if aof is being written
+func (handler *AofHandler) rotateIncrFile() error {
+	m := handler.manifest.copy()
+	m.incrSeq++
+	info := &aofInfo{
+		name:     fmt.Sprintf("%s.%d%s%s", handler.fileName, m.incrSeq, incrSuffix, aofFormatSuffix),
+		seq:      m.incrSeq,
+		fileType: fileTypeIncr,
+	}
+	m.incrs = append(m.incrs, info)
+	filename := handler.path(info)
+	aofFile, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeManifest(handler.manifestPath(), m); err != nil {
+		_ = aofFile.Close()
+		_ = os.Remove(filename)
+		return err
+	}
+	if handler.aofFile != nil {
+		_ = handler.aofFile.Close()
+	}
+	handler.manifest = m
+	handler.aofFile = aofFile
+	handler.aofFilename = filename
+	// a new file is loaded from db 0, SELECT must be written before the first command
+	handler.currentDB = -1
+	handler.lastTimestamp = 0
+	return nil
+}
+
+// removeHistory removes files replaced by rewrite, they are kept if aof-keep-history is yes
+func (handler *AofHandler) removeHistory() {
+	if len(handler.manifest.history) == 0 {
+		return
+	}
+	if !config.Properties.AofKeepHistory {
+		for _, info := range handler.manifest.history {
+			if err := os.Remove(handler.path(info)); err != nil && !os.IsNotExist(err) {
+				logger.Warn("remove history aof file failed: " + err.Error())
+				return
+			}
+		}
+	}
+	m := handler.manifest.copy()
+	m.history = nil
+	if err := writeManifest(handler.manifestPath(), m); err != nil {
+		logger.Warn("write aof manifest failed: " + err.Error())
+		return
+	}
+	handler.manifest = m
+}
+
+func (handler *AofHandler) filesSize(files []*aofInfo) (int64, error) {
+	var size int64
+	for _, info := range files {
+		stat, err := os.Stat(handler.path(info))
+		if err != nil {
+			return 0, err
+		}
+		size += stat.Size()
+	}
+	return size, nil
+}
+
 // AddAof send command to aof goroutine through channel
-func (handler *AofHandler) AddAof(dbIndex int, cmdLine CmdLine) {
+// multiple command lines are written together, such as a transaction.
+// It doesn't wait for fsync, the caller should release its locks before calling WaitFsync
+func (handler *AofHandler) AddAof(dbIndex int, cmdLines ...CmdLine) {
 	if config.Properties.AppendOnly && handler.aofChan != nil {
-		handler.aofChan <- &payload{
-			cmdLine: cmdLine,
-			dbIndex: dbIndex,
+		p := &payload{
+			cmdLines: cmdLines,
+			dbIndex:  dbIndex,
+		}
+		// payloads are sent in order of their sequence numbers
+		handler.closeMu.Lock()
+		if handler.closed {
+			handler.closeMu.Unlock()
+			logger.Warn("aof is closed, command dropped")
+			return
 		}
+		handler.queuedSeq++
+		p.seq = handler.queuedSeq
+		handler.aofChan <- p
+		handler.closeMu.Unlock()
 	}
 }
 
+// WaitFsync blocks until the payloads sent before are fsynced if appendfsync is always.
+// Like redis, the reply is sent after the commands executed before are durable.
+// It returns error if aof is closed before the payloads are written
+func (handler *AofHandler) WaitFsync() error {
+	if handler.aofFsync != FsyncAlways || handler.aofChan == nil {
+		return nil
+	}
+	handler.closeMu.RLock()
+	seq := handler.queuedSeq
+	handler.closeMu.RUnlock()
+	handler.syncMu.Lock()
+	defer handler.syncMu.Unlock()
+	for handler.syncedSeq < seq && !handler.syncClosed {
+		handler.syncCond.Wait()
+	}
+	if handler.syncedSeq < seq {
+		return errAofClosed
+	}
+	return nil
+}
+
 // handleAof listen aof channel and write into file
 func (handler *AofHandler) handleAof() {
+	defer close(handler.finished)
 	// serialized execution
-	handler.currentDB = 0
-	for p := range handler.aofChan {
-		if p.dbIndex != handler.currentDB {
-			// select db
-			data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
-			_, err := handler.aofFile.Write(data)
-			if err != nil {
+	for {
+		select {
+		case <-handler.abort:
+			return
+		default:
+		}
+		var p *payload
+		select {
+		case <-handler.abort:
+			return
+		case p = <-handler.aofChan:
+		}
+		if p == nil { // channel is closed and drained
+			return
+		}
+		if handler.aofFsync != FsyncAlways {
+			handler.writeAof(p)
+		} else {
+			// group commit: payloads queued by concurrent clients share one fsync
+			batch := handler.drainAofChan(p)
+			for _, p := range batch {
+				handler.writeAof(p)
+			}
+			handler.fsync()
+			handler.markSynced(batch)
+		}
+	}
+}
+
+// markSynced wakes up the callers waiting for the payloads in batch
+func (handler *AofHandler) markSynced(batch []*payload) {
+	handler.syncMu.Lock()
+	for _, p := range batch {
+		handler.syncedSeq = max(handler.syncedSeq, p.seq)
+	}
+	handler.syncMu.Unlock()
+	handler.syncCond.Broadcast()
+}
+
+// drainAofChan returns the given payload and all the payloads already in channel
+func (handler *AofHandler) drainAofChan(first *payload) []*payload {
+	batch := []*payload{first}
+	for {
+		select {
+		case p, ok := <-handler.aofChan:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, p)
+		default:
+			return batch
+		}
+	}
+}
+
+// fsync flushes aof file to disk
+func (handler *AofHandler) fsync() {
+	handler.pausingAof.Lock()
+	aofFile := handler.aofFile
+	handler.pausingAof.Unlock()
+	// don't block writing during fsync. If aof file is replaced by rewrite meanwhile,
+	// its data has been fsynced by rewrite and closing it makes Sync return ErrClosed
+	err := aofFile.Sync()
+	if err != nil && !errors.Is(err, os.ErrClosed) {
+		logger.Error("fsync aof failed: " + err.Error())
+	}
+}
+
+// fsyncEverySecond fsyncs aof file periodically for appendfsync everysec
+func (handler *AofHandler) fsyncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			handler.fsync()
+		case <-handler.finished:
+			return
+		}
+	}
+}
+
+// Close stops receiving commands, the commands in channel are written into file before it's fsynced and closed.
+// It gives up waiting after shutdown-timeout seconds, 0 means waiting until all the commands are written
+func (handler *AofHandler) Close() {
+	handler.closeMu.Lock()
+	if handler.closed {
+		handler.closeMu.Unlock()
+		return
+	}
+	handler.closed = true
+	close(handler.aofChan)
+	handler.closeMu.Unlock()
+
+	if timeout := config.Properties.ShutdownTimeout; timeout > 0 {
+		select {
+		case <-handler.finished:
+		case <-time.After(time.Duration(timeout) * time.Second):
+			// the payload being written is finished before the file is closed, the rest are dropped
+			close(handler.abort)
+			<-handler.finished
+			logger.Warn(fmt.Sprintf("timeout draining aof queue, %d commands are not written", len(handler.aofChan)))
+		}
+	} else {
+		<-handler.finished
+	}
+	// callers waiting for the dropped payloads get error
+	handler.syncMu.Lock()
+	handler.syncClosed = true
+	handler.syncMu.Unlock()
+	handler.syncCond.Broadcast()
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	if err := handler.aofFile.Sync(); err != nil {
+		logger.Error("fsync aof failed: " + err.Error())
+	}
+	_ = handler.aofFile.Close()
+	logger.Info("aof is closed")
+}
+
+func (handler *AofHandler) writeAof(p *payload) {
+	if p.callback != nil {
+		p.callback()
+		return
+	}
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	if config.Properties.AofTimestampEnabled {
+		if now := time.Now().Unix(); now > handler.lastTimestamp {
+			// commands after the annotation are executed at or after the time
+			data := makeTimestampAnnotation(now)
+			if _, err := handler.aofFile.Write(data); err != nil {
 				logger.Warn(err)
-				continue // skip this command
+				return
 			}
-			handler.currentDB = p.dbIndex
+			handler.aofSize += int64(len(data))
+			handler.lastTimestamp = now
 		}
-		data := reply.MakeMultiBulkReply(p.cmdLine).ToBytes()
+	}
+	if p.dbIndex != handler.currentDB {
+		// select db
+		data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
 		_, err := handler.aofFile.Write(data)
 		if err != nil {
 			logger.Warn(err)
+			return // skip this command
 		}
+		handler.aofSize += int64(len(data))
+		handler.currentDB = p.dbIndex
+	}
+	data := make([]byte, 0)
+	for _, cmdLine := range p.cmdLines {
+		data = append(data, reply.MakeMultiBulkReply(cmdLine).ToBytes()...)
 	}
+	_, err := handler.aofFile.Write(data)
+	if err != nil {
+		logger.Warn(err)
+		return
+	}
+	handler.aofSize += int64(len(data))
 }
 
-// LoadAof read aof file
-func (handler *AofHandler) LoadAof() {
+// LoadAof loads base file and incr files recorded in manifest
+func (handler *AofHandler) LoadAof() error {
+	return handler.loadFiles(handler.manifest.files())
+}
 
-	file, err := os.Open(handler.aofFilename)
+// loadFiles loads the given files in order, only the last file is allowed to be truncated
+func (handler *AofHandler) loadFiles(files []*aofInfo) error {
+	for i, info := range files {
+		filename := handler.path(info)
+		isRdb, err := isRdbFile(filename)
+		if err != nil {
+			return err
+		}
+		if isRdb {
+			err = handler.loadRdbFile(filename)
+		} else {
+			err = handler.loadAofFile(filename, i == len(files)-1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRdbFile checks whether the file starts with the magic number of rdb
+func isRdbFile(filename string) (bool, error) {
+	file, err := os.Open(filename)
 	if err != nil {
-		logger.Warn(err)
-		return
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
 	}
 	defer file.Close()
-	ch := parser.ParseStream(file)
-	fakeConn := &connection.Connection{} // only used for save dbIndex
-	for p := range ch {
-		if p.Err != nil {
-			if p.Err == io.EOF {
-				break
+	header := make([]byte, len(rdbMagic))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false, nil
+	}
+	return string(header) == rdbMagic, nil
+}
+
+// loadRdbFile loads base file in rdb format
+func (handler *AofHandler) loadRdbFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fakeConn := &connection.Connection{}
+	now := time.Now()
+	var execErr error
+	err = rdb.NewDecoder(file).Parse(func(o *rdb.Object) bool {
+		if o.Expiration != nil && o.Expiration.Before(now) {
+			return true
+		}
+		if o.DB != fakeConn.GetDBIndex() {
+			ret := handler.db.Exec(fakeConn, utils.ToCmdLine("SELECT", strconv.Itoa(o.DB)))
+			if errReply, ok := ret.(resp.ErrorReply); ok {
+				execErr = fmt.Errorf("select db %d failed: %s", o.DB, errReply.Error())
+				return false
 			}
-			logger.Error("parse error: " + p.Err.Error())
-			continue
 		}
-		if p.Data == nil {
-			logger.Error("empty payload")
-			continue
+		for _, cmdLine := range ObjectToCmds(o) {
+			ret := handler.db.Exec(fakeConn, cmdLine)
+			if errReply, ok := ret.(resp.ErrorReply); ok {
+				logger.Error("exec err: " + errReply.Error())
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("load rdb %s failed: %v", filename, err)
+	}
+	return execErr
+}
+
+// loadAofFile loads file in aof format
+// If the last command is incomplete and truncation is allowed, the file is truncated to the last complete command
+// when aof-load-truncated is yes, otherwise loading fails. Malformed data in the middle of the file always fails loading
+func (handler *AofHandler) loadAofFile(filename string, allowTruncated bool) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	cmdReader := newCmdReader(file)
+	fakeConn := &connection.Connection{} // only used for save dbIndex
+	// validOffset is the end of the last complete command out of transaction
+	var validOffset int64
+	for {
+		cmdLine, err := cmdReader.next()
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			return truncateAof(filename, validOffset, allowTruncated)
+		}
+		if err != nil {
+			return fmt.Errorf("load aof %s failed: %v, make a backup and try check-aof --fix", filename, err)
 		}
-		r, ok := p.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk reply")
-			continue
+		ret := handler.db.Exec(fakeConn, cmdLine)
+		if errReply, ok := ret.(resp.ErrorReply); ok {
+			logger.Error("exec err: " + errReply.Error())
 		}
-		ret := handler.db.Exec(fakeConn, r.Args)
-		if reply.IsErrorReply(ret) {
-			logger.Error("exec err", err)
+		if !fakeConn.InMultiState() {
+			validOffset = cmdReader.offset
 		}
 	}
+	if fakeConn.InMultiState() {
+		// transaction without EXEC at the end of file, the queued commands are dropped
+		return truncateAof(filename, validOffset, allowTruncated)
+	}
+	return nil
+}
+
+// truncateAof handles the incomplete command at the end of aof file
+func truncateAof(filename string, validOffset int64, allowTruncated bool) error {
+	if !allowTruncated || !config.Properties.AofLoadTruncated {
+		return fmt.Errorf("unexpected end of aof %s at offset %d, set aof-load-truncated yes or run check-aof --fix",
+			filename, validOffset)
+	}
+	logger.Warn(fmt.Sprintf("!!! Warning: short read while loading the AOF file %s, truncating it to offset %d",
+		filename, validOffset))
+	return os.Truncate(filename, validOffset)
 }
@@ -0,0 +1,96 @@
+package aof
+
+import (
+	"errors"
+	"go-redis/config"
+	"go-redis/lib/utils"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupAofConfig enables aof in a temporary directory
+func setupAofConfig(t *testing.T, fsync string) {
+	backup := config.Properties
+	config.Properties = config.DefaultProperties()
+	config.Properties.AppendOnly = true
+	config.Properties.AppendFilename = filepath.Join(t.TempDir(), "appendonly.aof")
+	config.Properties.AppendFsync = fsync
+	t.Cleanup(func() {
+		config.Properties = backup
+	})
+}
+
+func TestAofHandler_WaitFsync(t *testing.T) {
+	setupAofConfig(t, FsyncAlways)
+	handler, err := NewAOFHandler(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	for i := 0; i < 100; i++ {
+		handler.AddAof(0, utils.ToCmdLine("SET", "k", "v"))
+	}
+	if err := handler.WaitFsync(); err != nil {
+		t.Fatal(err)
+	}
+	handler.syncMu.Lock()
+	synced := handler.syncedSeq
+	handler.syncMu.Unlock()
+	if synced != 100 {
+		t.Errorf("expected 100 payloads fsynced, actually %d", synced)
+	}
+}
+
+func TestAofHandler_CloseTimeout(t *testing.T) {
+	setupAofConfig(t, FsyncAlways)
+	config.Properties.ShutdownTimeout = 1
+	handler, err := NewAOFHandler(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the aof goroutine is stuck, as writing to a slow disk
+	stuck := make(chan struct{})
+	go func() {
+		_ = handler.runInAofGoroutine(func() error {
+			<-stuck
+			return nil
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	handler.AddAof(0, utils.ToCmdLine("SET", "k", "v"))
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- handler.WaitFsync()
+	}()
+	rewriteErr := make(chan error, 1)
+	go func() {
+		rewriteErr <- handler.runInAofGoroutine(func() error {
+			return nil
+		})
+	}()
+
+	time.AfterFunc(1500*time.Millisecond, func() {
+		close(stuck)
+	})
+	closed := make(chan struct{})
+	go func() {
+		handler.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close doesn't return after shutdown-timeout")
+	}
+	for name, ch := range map[string]chan error{"WaitFsync": waitErr, "callback": rewriteErr} {
+		select {
+		case err := <-ch:
+			if !errors.Is(err, errAofClosed) {
+				t.Errorf("%s: expected %v, actually %v", name, errAofClosed, err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s is not released after aof is closed", name)
+		}
+	}
+}
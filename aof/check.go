@@ -0,0 +1,114 @@
+package aof
+
+import (
+	"errors"
+	"go-redis/rdb"
+	"io"
+	"os"
+	"strings"
+)
+
+// CheckResult describes the validity of an aof file
+type CheckResult struct {
+	Size int64
+	// ValidSize is the end of the last complete command out of transaction, the file can be truncated to it
+	ValidSize int64
+	// Err is the reason why the file is invalid, nil if the file is valid
+	Err error
+}
+
+// CheckAof validates the aof file, and truncates it to the valid size if fix is true.
+// Base file in rdb format is validated as well, but it can't be fixed
+func CheckAof(filename string, fix bool) (*CheckResult, error) {
+	isRdb, err := isRdbFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if isRdb {
+		return checkRdb(filename, fix)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	result := &CheckResult{Size: info.Size()}
+	reader := newCmdReader(file)
+	inMulti := false
+	for {
+		offset := reader.offset
+		cmdLine, err := reader.next()
+		if err == io.EOF {
+			if inMulti {
+				result.Err = errors.New("reached EOF before reading EXEC for MULTI")
+			}
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			result.Err = errors.New("unexpected end of file")
+			break
+		}
+		if err != nil {
+			result.Err = err
+			break
+		}
+		switch strings.ToLower(string(cmdLine[0])) {
+		case "multi":
+			if inMulti {
+				result.Err = &FormatError{Offset: offset, Msg: "unexpected MULTI"}
+			}
+			inMulti = true
+		case "exec", "discard":
+			if !inMulti {
+				result.Err = &FormatError{Offset: offset, Msg: "unexpected " + strings.ToUpper(string(cmdLine[0]))}
+			}
+			inMulti = false
+		}
+		if result.Err != nil {
+			break
+		}
+		if !inMulti {
+			result.ValidSize = reader.offset
+		}
+	}
+	_ = file.Close()
+	if result.Err == nil {
+		result.ValidSize = result.Size
+		return result, nil
+	}
+	if fix {
+		if err := os.Truncate(filename, result.ValidSize); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func checkRdb(filename string, fix bool) (*CheckResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{Size: info.Size(), ValidSize: info.Size()}
+	err = rdb.NewDecoder(file).Parse(func(o *rdb.Object) bool {
+		return true
+	})
+	if err == nil {
+		return result, nil
+	}
+	result.ValidSize = 0
+	result.Err = err
+	if fix {
+		return result, errors.New("rdb file can't be fixed by truncation")
+	}
+	return result, nil
+}
@@ -0,0 +1,188 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+multi-part aof consists of files in appenddirname:
+  - base file, written by rewrite in rdb or aof format
+  - incr files, the commands executed after the base file is created
+  - manifest, records the files above in order, such as:
+    file appendonly.aof.1.base.rdb seq 1 type b
+    file appendonly.aof.1.incr.aof seq 1 type i
+*/
+
+const (
+	manifestSuffix  = ".manifest"
+	rdbFormatSuffix = ".rdb"
+	aofFormatSuffix = ".aof"
+
+	fileTypeBase    = "b"
+	fileTypeIncr    = "i"
+	fileTypeHistory = "h" // replaced by rewrite, waiting to be removed
+)
+
+// aofInfo describes a file of multi-part aof
+type aofInfo struct {
+	name     string
+	seq      int
+	fileType string
+}
+
+// manifest tracks files of multi-part aof, the data is the base file followed by incr files
+type manifest struct {
+	base    *aofInfo // nil if no base file is created yet
+	incrs   []*aofInfo
+	history []*aofInfo
+	// seq of the latest base file and incr file
+	baseSeq int
+	incrSeq int
+}
+
+func (m *manifest) copy() *manifest {
+	c := *m
+	c.incrs = append([]*aofInfo(nil), m.incrs...)
+	c.history = append([]*aofInfo(nil), m.history...)
+	return &c
+}
+
+// files returns base file and incr files in the order of loading
+func (m *manifest) files() []*aofInfo {
+	files := make([]*aofInfo, 0, len(m.incrs)+1)
+	if m.base != nil {
+		files = append(files, m.base)
+	}
+	return append(files, m.incrs...)
+}
+
+func (m *manifest) encode() []byte {
+	var sb strings.Builder
+	for _, info := range m.history {
+		sb.WriteString(info.encode())
+	}
+	if m.base != nil {
+		sb.WriteString(m.base.encode())
+	}
+	for _, info := range m.incrs {
+		sb.WriteString(info.encode())
+	}
+	return []byte(sb.String())
+}
+
+func (info *aofInfo) encode() string {
+	return fmt.Sprintf("file %s seq %d type %s\n", info.name, info.seq, info.fileType)
+}
+
+// parseManifest reads manifest, each line is made of key value pairs
+func parseManifest(reader io.Reader) (*manifest, error) {
+	m := &manifest{}
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields)%2 != 0 {
+			return nil, fmt.Errorf("invalid manifest line %d: %s", lineNum, line)
+		}
+		info := &aofInfo{}
+		for i := 0; i < len(fields); i += 2 {
+			switch fields[i] {
+			case "file":
+				info.name = fields[i+1]
+			case "seq":
+				seq, err := strconv.Atoi(fields[i+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid seq in manifest line %d: %s", lineNum, line)
+				}
+				info.seq = seq
+			case "type":
+				info.fileType = fields[i+1]
+			}
+		}
+		if info.name == "" || filepath.Base(info.name) != info.name {
+			return nil, fmt.Errorf("invalid file name in manifest line %d: %s", lineNum, line)
+		}
+		switch info.fileType {
+		case fileTypeBase:
+			if m.base != nil {
+				return nil, errors.New("found duplicate base file in manifest")
+			}
+			m.base = info
+			m.baseSeq = info.seq
+		case fileTypeIncr:
+			if info.seq <= m.incrSeq {
+				return nil, errors.New("incr files in manifest are not in order")
+			}
+			m.incrs = append(m.incrs, info)
+			m.incrSeq = info.seq
+		case fileTypeHistory:
+			m.history = append(m.history, info)
+		default:
+			return nil, fmt.Errorf("unknown file type in manifest line %d: %s", lineNum, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// readManifest reads manifest file, returns nil if it doesn't exist
+func readManifest(filename string) (*manifest, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	return parseManifest(file)
+}
+
+// writeManifest replaces manifest file atomically
+func writeManifest(filename string, m *manifest) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "temp-*"+manifestSuffix)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}()
+	if _, err := tmpFile.Write(m.encode()); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), filename); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(filename))
+}
+
+// syncDir makes renaming and creating files in the directory durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,62 @@
+package aof
+
+import (
+	"go-redis/lib/utils"
+	"go-redis/rdb"
+	"strconv"
+	"time"
+)
+
+// aofRewriteItemsPerCmd is the max number of items in a command, large collections are split into multiple commands
+const aofRewriteItemsPerCmd = 64
+
+// ObjectToCmds serializes rdb object to redis commands, the expiration is set by the last command
+func ObjectToCmds(obj *rdb.Object) []CmdLine {
+	key := []byte(obj.Key)
+	var cmds []CmdLine
+	switch obj.Type {
+	case rdb.StringType:
+		cmds = []CmdLine{utils.ToCmdLine2("set", key, obj.String)}
+	case rdb.ListType:
+		cmds = chunkCmds("rpush", key, obj.List, 1)
+	case rdb.SetType:
+		cmds = chunkCmds("sadd", key, obj.Set, 1)
+	case rdb.HashType:
+		args := make([][]byte, 0, len(obj.Hash)*2)
+		for field, value := range obj.Hash {
+			args = append(args, []byte(field), value)
+		}
+		cmds = chunkCmds("hset", key, args, 2)
+	case rdb.ZSetType:
+		args := make([][]byte, 0, len(obj.ZSet)*2)
+		for _, member := range obj.ZSet {
+			score := strconv.FormatFloat(member.Score, 'f', -1, 64)
+			args = append(args, []byte(score), []byte(member.Member))
+		}
+		cmds = chunkCmds("zadd", key, args, 2)
+	}
+	if len(cmds) > 0 && obj.Expiration != nil {
+		cmds = append(cmds, MakeExpireCmd(obj.Key, *obj.Expiration))
+	}
+	return cmds
+}
+
+// chunkCmds makes commands such as "rpush key item...", each of them has at most aofRewriteItemsPerCmd items.
+// An item consists of argsPerItem arguments, such as field and value of hash
+func chunkCmds(name string, key []byte, args [][]byte, argsPerItem int) []CmdLine {
+	step := aofRewriteItemsPerCmd * argsPerItem
+	cmds := make([]CmdLine, 0, (len(args)+step-1)/step)
+	for start := 0; start < len(args); start += step {
+		end := min(start+step, len(args))
+		cmd := make(CmdLine, 0, 2+end-start)
+		cmd = append(cmd, []byte(name), key)
+		cmd = append(cmd, args[start:end]...)
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+// MakeExpireCmd generates command line to set expiration for the given key
+func MakeExpireCmd(key string, expireAt time.Time) CmdLine {
+	return utils.ToCmdLine("pexpireat", key, strconv.FormatInt(expireAt.UnixMilli(), 10))
+}
@@ -0,0 +1,132 @@
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// timestampPrefix begins the annotation of the time when the following commands are executed
+const timestampPrefix = "#TS:"
+
+// makeTimestampAnnotation returns the annotation of the given unix time
+func makeTimestampAnnotation(ts int64) []byte {
+	return []byte(timestampPrefix + strconv.FormatInt(ts, 10) + "\r\n")
+}
+
+// FormatError reports malformed data in aof file
+type FormatError struct {
+	Offset int64 // offset of the malformed line
+	Msg    string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("bad file format at offset %d: %s", e.Offset, e.Msg)
+}
+
+// cmdReader reads command lines from aof file. Unlike the parser of client requests,
+// it never skips invalid data and tracks the offset of the data read
+type cmdReader struct {
+	reader *bufio.Reader
+	offset int64
+	// timestamp is the time of the latest timestamp annotation read
+	timestamp int64
+	// stopAt stops reading at the annotation later than it, 0 means reading the whole file
+	stopAt int64
+	// stopped tells whether reading is stopped by stopAt, offset is the beginning of the annotation then
+	stopped bool
+}
+
+func newCmdReader(reader io.Reader) *cmdReader {
+	return &cmdReader{
+		reader: bufio.NewReader(reader),
+	}
+}
+
+// next reads a command line, it returns io.EOF at the end of file and io.ErrUnexpectedEOF if the last command is incomplete
+func (r *cmdReader) next() (CmdLine, error) {
+	start := r.offset
+	header, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	for len(header) > 0 && header[0] == '#' {
+		// annotation such as "#TS:1700000000"
+		if bytes.HasPrefix(header, []byte(timestampPrefix)) {
+			ts, err := strconv.ParseInt(string(header[len(timestampPrefix):]), 10, 64)
+			if err != nil {
+				return nil, &FormatError{Offset: start, Msg: "illegal timestamp annotation " + strconv.Quote(string(header))}
+			}
+			if r.stopAt > 0 && ts > r.stopAt {
+				r.offset = start
+				r.stopped = true
+				return nil, io.EOF
+			}
+			r.timestamp = ts
+		}
+		start = r.offset
+		header, err = r.readLine()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(header) == 0 || header[0] != '*' {
+		return nil, &FormatError{Offset: start, Msg: "expect '*', got " + strconv.Quote(string(header))}
+	}
+	argc, err := strconv.Atoi(string(header[1:]))
+	if err != nil || argc < 1 {
+		return nil, &FormatError{Offset: start, Msg: "illegal number of arguments " + strconv.Quote(string(header))}
+	}
+	cmdLine := make(CmdLine, 0, argc)
+	for i := 0; i < argc; i++ {
+		lineStart := r.offset
+		line, err := r.readLine()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, &FormatError{Offset: lineStart, Msg: "expect '$', got " + strconv.Quote(string(line))}
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 {
+			return nil, &FormatError{Offset: lineStart, Msg: "illegal bulk length " + strconv.Quote(string(line))}
+		}
+		bulkStart := r.offset
+		bulk := make([]byte, size+2)
+		n, err := io.ReadFull(r.reader, bulk)
+		r.offset += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(bulk, []byte("\r\n")) {
+			return nil, &FormatError{Offset: bulkStart, Msg: "bulk string is not terminated by CRLF"}
+		}
+		cmdLine = append(cmdLine, bulk[:size])
+	}
+	return cmdLine, nil
+}
+
+// readLine reads a line without the trailing CRLF
+func (r *cmdReader) readLine() ([]byte, error) {
+	start := r.offset
+	line, err := r.reader.ReadBytes('\n')
+	r.offset += int64(len(line))
+	if err == io.EOF && len(line) > 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, &FormatError{Offset: start, Msg: "line is not terminated by CRLF"}
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,323 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go-redis/config"
+	"go-redis/lib/logger"
+	"go-redis/lib/utils"
+	"go-redis/rdb"
+	"go-redis/resp/reply"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	errRewriting = errors.New("Background append only file rewriting already in progress")
+	errAofClosed = errors.New("aof is closed")
+)
+
+// Snapshot is a point-in-time view of db, values are kept unchanged until it's released
+type Snapshot interface {
+	// ForEach traverses objects in the snapshot in order of db index
+	ForEach(cb func(obj *rdb.Object) bool)
+	// Sizes returns the number of keys and the number of keys with ttl in each db
+	Sizes() (keyCounts map[int]int, ttlCounts map[int]int)
+	// Release must be called after the snapshot is dumped
+	Release()
+}
+
+// SnapshotMaker takes a snapshot while writes are blocked, onTaken is called before writes are resumed.
+// No snapshot is taken if onTaken returns error
+type SnapshotMaker func(onTaken func() error) (Snapshot, error)
+
+// rewriteCtx holds the state of aof files when the rewrite starts
+type rewriteCtx struct {
+	tmpFile  *os.File
+	snapshot Snapshot
+	incrSeq  int // seq of the last incr file written before the snapshot, the files up to it are replaced by the new base file
+}
+
+// Rewrite compacts the aof file, it blocks until the rewrite is finished
+func (handler *AofHandler) Rewrite() error {
+	ctx, err := handler.startRewrite()
+	if err != nil {
+		return err
+	}
+	return handler.rewrite(ctx)
+}
+
+// BackgroundRewrite starts rewriting in another goroutine, returns error if failed to start
+func (handler *AofHandler) BackgroundRewrite() error {
+	ctx, err := handler.startRewrite()
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := handler.rewrite(ctx); err != nil {
+			logger.Error("aof rewrite failed: " + err.Error())
+		}
+	}()
+	return nil
+}
+
+// autoRewrite checks the threshold periodically and rewrites aof when it's reached.
+// The rewrite needs the aof goroutine, so it can't be started by the aof goroutine itself
+func (handler *AofHandler) autoRewrite() {
+	ticker := time.NewTicker(autoRewriteInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !handler.needRewrite() {
+				continue
+			}
+			if err := handler.Rewrite(); err != nil && err != errRewriting {
+				logger.Error("auto aof rewrite failed: " + err.Error())
+			}
+		case <-handler.finished:
+			return
+		}
+	}
+}
+
+// needRewrite checks auto-aof-rewrite-percentage and auto-aof-rewrite-min-size
+func (handler *AofHandler) needRewrite() bool {
+	percentage := config.Properties.AutoAofRewritePercentage
+	if percentage <= 0 || handler.rewriting.Get() {
+		return false
+	}
+	handler.pausingAof.Lock()
+	size, base := handler.aofSize, handler.baseSize
+	handler.pausingAof.Unlock()
+	if size < config.Properties.AutoAofRewriteMinSize {
+		return false
+	}
+	if base == 0 {
+		return true
+	}
+	return (size-base)*100/base >= int64(percentage)
+}
+
+// startRewrite takes a snapshot of db and switches to a new incr file at the same moment,
+// so the new base file and the following incr files contain every command exactly once
+func (handler *AofHandler) startRewrite() (*rewriteCtx, error) {
+	handler.pausingAof.Lock()
+	if handler.rewriting.Get() {
+		handler.pausingAof.Unlock()
+		return nil, errRewriting
+	}
+	handler.rewriting.Set(true)
+	handler.pausingAof.Unlock()
+
+	// create tmp file in appenddirname, so that it can be renamed atomically
+	tmpFile, err := os.CreateTemp(handler.dir, "temp-rewrite-*"+baseSuffix)
+	if err != nil {
+		handler.rewriting.Set(false)
+		return nil, err
+	}
+	ctx := &rewriteCtx{tmpFile: tmpFile}
+	ctx.snapshot, err = handler.snapshotMaker(func() error {
+		// commands in the snapshot may be still queued, they must go to the old files
+		return handler.runInAofGoroutine(func() error {
+			handler.pausingAof.Lock()
+			defer handler.pausingAof.Unlock()
+			if err := handler.aofFile.Sync(); err != nil {
+				return err
+			}
+			ctx.incrSeq = handler.manifest.incrSeq
+			return handler.rotateIncrFile()
+		})
+	})
+	if err != nil {
+		handler.abortRewrite(ctx)
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// runInAofGoroutine calls fn after the payloads queued before are written, it blocks until fn returns
+func (handler *AofHandler) runInAofGoroutine(fn func() error) error {
+	errChan := make(chan error, 1)
+	handler.closeMu.RLock()
+	if handler.closed {
+		handler.closeMu.RUnlock()
+		return errAofClosed
+	}
+	handler.aofChan <- &payload{
+		callback: func() {
+			errChan <- fn()
+		},
+	}
+	handler.closeMu.RUnlock()
+	select {
+	case err := <-errChan:
+		return err
+	case <-handler.finished:
+		// fn isn't called if aof is closed before the payload is handled
+		select {
+		case err := <-errChan:
+			return err
+		default:
+			return errAofClosed
+		}
+	}
+}
+
+// rewrite writes the data in the old files into tmp file and makes it the new base file
+func (handler *AofHandler) rewrite(ctx *rewriteCtx) error {
+	err := handler.doRewrite(ctx)
+	if err != nil {
+		handler.abortRewrite(ctx)
+		return err
+	}
+	err = handler.finishRewrite(ctx)
+	if err != nil {
+		handler.abortRewrite(ctx)
+		return err
+	}
+	logger.Info("aof rewrite finished")
+	return nil
+}
+
+// doRewrite writes the snapshot into tmp file in rdb or aof format. Clients are not blocked
+func (handler *AofHandler) doRewrite(ctx *rewriteCtx) error {
+	defer ctx.snapshot.Release()
+	var err error
+	if config.Properties.AofUseRdbPreamble {
+		err = writeRdbBase(ctx.tmpFile, ctx.snapshot)
+	} else {
+		err = writeAofBase(ctx.tmpFile, ctx.snapshot)
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.tmpFile.Sync()
+}
+
+// writeRdbBase writes the snapshot in rdb format
+func writeRdbBase(file *os.File, snap Snapshot) error {
+	encoder := rdb.NewEncoder(file)
+	if err := encoder.WriteHeader(); err != nil {
+		return err
+	}
+	if err := encoder.WriteAuxFields(true); err != nil {
+		return err
+	}
+	// sizes of databases for RESIZEDB
+	keyCounts, ttlCounts := snap.Sizes()
+	dbIndex := -1
+	var err error
+	snap.ForEach(func(obj *rdb.Object) bool {
+		if obj.DB != dbIndex {
+			if err = encoder.WriteDBHeader(obj.DB, keyCounts[obj.DB], ttlCounts[obj.DB]); err != nil {
+				return false
+			}
+			dbIndex = obj.DB
+		}
+		err = encoder.WriteObject(obj)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return encoder.WriteEnd()
+}
+
+// writeAofBase writes the commands to rebuild the snapshot, large collections are split into multiple commands
+func writeAofBase(file *os.File, snap Snapshot) error {
+	writer := bufio.NewWriter(file)
+	var err error
+	if config.Properties.AofTimestampEnabled {
+		// the data of base file is as of now
+		if _, err = writer.Write(makeTimestampAnnotation(time.Now().Unix())); err != nil {
+			return err
+		}
+	}
+	dbIndex := -1
+	snap.ForEach(func(obj *rdb.Object) bool {
+		if obj.DB != dbIndex {
+			// select db only if it's not empty
+			data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(obj.DB))).ToBytes()
+			if _, err = writer.Write(data); err != nil {
+				return false
+			}
+			dbIndex = obj.DB
+		}
+		for _, cmd := range ObjectToCmds(obj) {
+			if _, err = writer.Write(reply.MakeMultiBulkReply(cmd).ToBytes()); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// finishRewrite renames tmp file to the new base file and replaces the old files with it in manifest
+func (handler *AofHandler) finishRewrite(ctx *rewriteCtx) error {
+	if err := ctx.tmpFile.Close(); err != nil {
+		return err
+	}
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+
+	m := handler.manifest.copy()
+	m.baseSeq++
+	suffix := aofFormatSuffix
+	if config.Properties.AofUseRdbPreamble {
+		suffix = rdbFormatSuffix
+	}
+	base := &aofInfo{
+		name:     fmt.Sprintf("%s.%d%s%s", handler.fileName, m.baseSeq, baseSuffix, suffix),
+		seq:      m.baseSeq,
+		fileType: fileTypeBase,
+	}
+	if err := os.Rename(ctx.tmpFile.Name(), handler.path(base)); err != nil {
+		return err
+	}
+	// the old base file and incr files merged into the new base file become history
+	if m.base != nil {
+		m.history = append(m.history, &aofInfo{name: m.base.name, seq: m.base.seq, fileType: fileTypeHistory})
+	}
+	incrs := make([]*aofInfo, 0, len(m.incrs))
+	for _, info := range m.incrs {
+		if info.seq <= ctx.incrSeq {
+			m.history = append(m.history, &aofInfo{name: info.name, seq: info.seq, fileType: fileTypeHistory})
+		} else {
+			incrs = append(incrs, info)
+		}
+	}
+	m.base = base
+	m.incrs = incrs
+	if err := writeManifest(handler.manifestPath(), m); err != nil {
+		_ = os.Remove(handler.path(base))
+		return err
+	}
+	handler.manifest = m
+	handler.rewriting.Set(false)
+	handler.removeHistory()
+
+	size, err := handler.filesSize(m.files())
+	if err != nil {
+		logger.Warn("stat aof files failed: " + err.Error())
+		return nil
+	}
+	handler.aofSize = size
+	handler.baseSize = size
+	return nil
+}
+
+// abortRewrite drops tmp file, the new incr file is kept if writes have gone into it
+func (handler *AofHandler) abortRewrite(ctx *rewriteCtx) {
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	_ = ctx.tmpFile.Close()
+	_ = os.Remove(ctx.tmpFile.Name())
+	handler.rewriting.Set(false)
+}
@@ -0,0 +1,168 @@
+package aof
+
+import (
+	"errors"
+	"fmt"
+	"go-redis/rdb"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TruncateToTimestamp copies aof to dst, keeping only the commands executed at or before the unix time,
+// so that the data can be restored to the point in time, such as just before a mistaken FLUSHDB.
+// src is a single aof file or the manifest of multi-part aof, dst is a file or a directory respectively.
+// Commands are located by the timestamp annotations written when aof-timestamp-enabled is yes
+func TruncateToTimestamp(src string, dst string, timestamp int64) error {
+	if _, err := os.Stat(dst); err == nil {
+		return errors.New(dst + " already exists")
+	}
+	if strings.HasSuffix(src, manifestSuffix) {
+		return truncateMultiPart(src, dst, timestamp)
+	}
+	isRdb, err := isRdbFile(src)
+	if err != nil {
+		return err
+	}
+	if isRdb {
+		return errors.New("rdb file has no timestamp annotation")
+	}
+	_, err = copyUntil(src, dst, timestamp)
+	return err
+}
+
+// truncateMultiPart copies base file and incr files before the timestamp into dstDir with a new manifest
+func truncateMultiPart(manifestFile string, dstDir string, timestamp int64) error {
+	m, err := readManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return errors.New("manifest " + manifestFile + " doesn't exist")
+	}
+	srcDir := filepath.Dir(manifestFile)
+	if m.base != nil {
+		baseTs, err := baseTimestamp(filepath.Join(srcDir, m.base.name))
+		if err != nil {
+			return err
+		}
+		if baseTs > timestamp {
+			return fmt.Errorf("base file %s is created at %d, the data before it has been rewritten", m.base.name, baseTs)
+		}
+	}
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return err
+	}
+	out := &manifest{baseSeq: m.baseSeq}
+	if m.base != nil {
+		baseFile := filepath.Join(srcDir, m.base.name)
+		if err := copyFile(baseFile, filepath.Join(dstDir, m.base.name), -1); err != nil {
+			return err
+		}
+		out.base = m.base
+	}
+	for _, info := range m.incrs {
+		stopped, err := copyUntil(filepath.Join(srcDir, info.name), filepath.Join(dstDir, info.name), timestamp)
+		if err != nil {
+			return err
+		}
+		out.incrs = append(out.incrs, info)
+		out.incrSeq = info.seq
+		if stopped {
+			// the following incr files are written after the timestamp
+			break
+		}
+	}
+	return writeManifest(filepath.Join(dstDir, filepath.Base(manifestFile)), out)
+}
+
+// copyUntil copies the complete commands before the first annotation later than timestamp,
+// returns true if such annotation is found
+func copyUntil(src string, dst string, timestamp int64) (bool, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	reader := newCmdReader(file)
+	reader.stopAt = timestamp
+	inMulti := false
+	// validOffset is the end of the last complete command out of transaction
+	var validOffset int64
+	for {
+		cmdLine, err := reader.next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			_ = file.Close()
+			return false, fmt.Errorf("read %s failed: %v", src, err)
+		}
+		switch strings.ToLower(string(cmdLine[0])) {
+		case "multi":
+			inMulti = true
+		case "exec", "discard":
+			inMulti = false
+		}
+		if !inMulti {
+			validOffset = reader.offset
+		}
+	}
+	_ = file.Close()
+	return reader.stopped, copyFile(src, dst, validOffset)
+}
+
+// copyFile copies the first size bytes of src to dst, the whole file is copied if size is negative
+func copyFile(src string, dst string, size int64) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+	if size < 0 {
+		_, err = io.Copy(dstFile, srcFile)
+	} else {
+		_, err = io.CopyN(dstFile, srcFile, size)
+	}
+	if err != nil {
+		return err
+	}
+	return dstFile.Sync()
+}
+
+// baseTimestamp returns the time when base file is created, 0 if it's unknown
+func baseTimestamp(filename string) (int64, error) {
+	isRdb, err := isRdbFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if isRdb {
+		decoder := rdb.NewDecoder(file)
+		// aux fields are in front of objects
+		err := decoder.Parse(func(o *rdb.Object) bool {
+			return false
+		})
+		if err != nil {
+			return 0, err
+		}
+		ctime, _ := strconv.ParseInt(decoder.Aux("ctime"), 10, 64)
+		return ctime, nil
+	}
+	// base file in aof format begins with an annotation
+	reader := newCmdReader(file)
+	if _, err := reader.next(); err != nil && err != io.EOF {
+		return 0, err
+	}
+	return reader.timestamp, nil
+}
@@ -2,18 +2,23 @@ package cluster
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"github.com/jolestar/go-commons-pool/v2"
+	"go-redis/config"
+	"go-redis/lib/utils"
 	"go-redis/resp/client"
 )
 
 type connectionFactory struct {
-	Peer string
+	Peer      string
+	TLSConfig *tls.Config // dial peer over TLS if it's not nil
 }
 
 // 创建一个新的 Redis 客户端连接对象，并将其包装在一个 pool.PooledObject 中返回
 func (f *connectionFactory) MakeObject(ctx context.Context) (*pool.PooledObject, error) {
-	c, err := client.MakeClient(f.Peer)
+	// handshake is sent again when the client reconnects, such as after the peer restarts
+	c, err := client.MakeHandshakeClient(f.Peer, f.TLSConfig, peerHandshake())
 	if err != nil {
 		return nil, err
 	}
@@ -21,6 +26,19 @@ func (f *connectionFactory) MakeObject(ctx context.Context) (*pool.PooledObject,
 	return pool.NewPooledObject(c), nil
 }
 
+// peerHandshake authenticates to peer and switches to RESP3,
+// which keeps types of the replies relayed to clients, such as maps and doubles
+func peerHandshake() CmdLine {
+	cmdLine := utils.ToCmdLine("HELLO", "3")
+	if config.Properties.PeerUser != "" {
+		cmdLine = append(cmdLine, utils.ToCmdLine("AUTH", config.Properties.PeerUser, config.Properties.PeerPassword)...)
+	} else if config.Properties.RequirePass != "" {
+		// peers share the same requirepass by default
+		cmdLine = append(cmdLine, utils.ToCmdLine("AUTH", "default", config.Properties.RequirePass)...)
+	}
+	return cmdLine
+}
+
 func (f *connectionFactory) DestroyObject(ctx context.Context, object *pool.PooledObject) error {
 	c, ok := object.Object.(*client.Client)
 	if !ok {
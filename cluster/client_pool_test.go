@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"context"
+	"go-redis/config"
+	"go-redis/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/client"
+	"go-redis/resp/connection"
+	"go-redis/resp/parser"
+	"go-redis/resp/reply"
+	"go-redis/tcp"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testPeer serves a standalone database with authentication like a node of cluster
+type testPeer struct {
+	db         *database.StandaloneDatabase
+	activeConn sync.Map
+}
+
+func (p *testPeer) Handle(ctx context.Context, conn net.Conn) {
+	c := connection.NewConn(conn)
+	p.activeConn.Store(c, struct{}{})
+	defer p.activeConn.Delete(c)
+	defer c.Close()
+	reader := parser.NewParser(conn)
+	for {
+		cmdLine, _, err := reader.ReadCommand()
+		if err != nil {
+			return
+		}
+		var result resp.Reply
+		name := strings.ToLower(string(cmdLine[0]))
+		if errReply := database.Authorize(c, cmdLine); errReply != nil && name != "auth" && name != "hello" {
+			result = errReply
+		} else {
+			result = p.db.Exec(c, cmdLine)
+		}
+		if err := c.Write(reply.Encode(result, c.GetProtocol())); err != nil {
+			return
+		}
+	}
+}
+
+func (p *testPeer) Close() error {
+	p.activeConn.Range(func(key, value any) bool {
+		_ = key.(*connection.Connection).Close()
+		return true
+	})
+	p.db.Close()
+	return nil
+}
+
+// startTestPeer serves a new database on addr, the returned function stops it as the peer crashes
+func startTestPeer(t *testing.T, addr string) (string, func()) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		tcp.ListenAndServe([]net.Listener{listener}, &testPeer{db: database.NewStandaloneDatabase()}, closeChan)
+		close(done)
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			closeChan <- struct{}{}
+			<-done
+		})
+	}
+	t.Cleanup(stop)
+	return listener.Addr().String(), stop
+}
+
+// setupPeerConfig requires password of the default user and adds user "peer" by aclfile
+func setupPeerConfig(t *testing.T) {
+	dir := t.TempDir()
+	aclFile := filepath.Join(dir, "users.acl")
+	if err := os.WriteFile(aclFile, []byte("user peer on >peer-secret ~* +@all\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backup := config.Properties
+	config.Properties = config.DefaultProperties()
+	config.Properties.RequirePass = "secret"
+	config.Properties.AclFile = aclFile
+	config.Properties.DbFilename = filepath.Join(dir, "dump.rdb")
+	config.Properties.PeerUser = "peer"
+	config.Properties.PeerPassword = "peer-secret"
+	if err := database.SetupACL(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		config.Properties = backup
+		_ = database.SetupACL()
+	})
+}
+
+func TestConnectionFactory_PeerRestart(t *testing.T) {
+	setupPeerConfig(t)
+	addr, stop := startTestPeer(t, "127.0.0.1:0")
+	factory := &connectionFactory{Peer: addr}
+	object, err := factory.MakeObject(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := object.Object.(*client.Client)
+	defer c.Close()
+	if result := c.Send(utils.ToCmdLine("SET", "k", "v")); reply.IsErrorReply(result) {
+		t.Fatalf("expected OK, actually %q", result.ToBytes())
+	}
+
+	// the restarted peer doesn't know the connection was authenticated
+	stop()
+	startTestPeer(t, addr)
+	var result = c.Send(utils.ToCmdLine("SET", "k", "v"))
+	for i := 0; i < 3 && reply.IsErrorReply(result); i++ {
+		// requests sent before the client finds the connection broken may fail
+		result = c.Send(utils.ToCmdLine("SET", "k", "v"))
+	}
+	if reply.IsErrorReply(result) {
+		t.Fatalf("expected OK after peer restarted, actually %q", result.ToBytes())
+	}
+	// replies of RESP3 are decoded as their own types
+	if result := c.Send(utils.ToCmdLine("GET", "missing")); !isNullReply(result) {
+		t.Errorf("expected RESP3 null, actually %q", result.ToBytes())
+	}
+}
+
+func isNullReply(r resp.Reply) bool {
+	_, ok := r.(*reply.NullReply)
+	return ok
+}
+
+func TestConnectionFactory_WrongPassword(t *testing.T) {
+	setupPeerConfig(t)
+	addr, _ := startTestPeer(t, "127.0.0.1:0")
+	config.Properties.PeerPassword = "wrong"
+	factory := &connectionFactory{Peer: addr}
+	if _, err := factory.MakeObject(context.Background()); err == nil {
+		t.Error("expected handshake error")
+	}
+}
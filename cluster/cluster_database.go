@@ -3,6 +3,7 @@ package cluster
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	pool "github.com/jolestar/go-commons-pool/v2"
 	"go-redis/config"
@@ -12,6 +13,7 @@ import (
 	"go-redis/lib/consistenthash"
 	"go-redis/lib/logger"
 	"go-redis/resp/reply"
+	"go-redis/tcp"
 	"runtime/debug"
 	"strings"
 )
@@ -41,10 +43,21 @@ func MakeClusterDatabase() *ClusterDatabase {
 	}
 	nodes = append(nodes, config.Properties.Self)
 	cluster.peerPicker.AddNode(nodes...)
+	var tlsConfig *tls.Config
+	if config.Properties.TlsCluster {
+		// the certificate of server is also presented to peers
+		var err error
+		tlsConfig, err = tcp.MakeClientTLSConfig(config.Properties.TlsCertFile, config.Properties.TlsKeyFile,
+			config.Properties.TlsCaCertFile)
+		if err != nil {
+			panic(err)
+		}
+	}
 	ctx := context.Background()
 	for _, peer := range config.Properties.Peers {
 		cluster.peerConnection[peer] = pool.NewObjectPoolWithDefaultConfig(ctx, &connectionFactory{
-			Peer: peer,
+			Peer:      peer,
+			TLSConfig: tlsConfig,
 		})
 	}
 	cluster.nodes = nodes
@@ -54,6 +67,11 @@ func MakeClusterDatabase() *ClusterDatabase {
 // CmdFunc represents the handler of a redis command
 type CmdFunc func(cluster *ClusterDatabase, c resp.Connection, cmdAndArgs [][]byte) resp.Reply
 
+// PrepareShutdown persists data of current node before it exits
+func (cluster *ClusterDatabase) PrepareShutdown(mode databaseface.SaveMode) error {
+	return cluster.db.PrepareShutdown(mode)
+}
+
 // Close stops current node of cluster
 func (cluster *ClusterDatabase) Close() {
 	cluster.db.Close()
@@ -70,6 +88,12 @@ func (cluster *ClusterDatabase) Exec(c resp.Connection, cmdLine [][]byte) (resul
 		}
 	}()
 	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "auth" {
+		return database.Auth(c, cmdLine[1:])
+	}
+	if cmdName == "hello" {
+		return database.Hello(c, cmdLine[1:])
+	}
 	cmdFunc, ok := router[cmdName]
 	if !ok {
 		return reply.MakeErrReply("ERR unknown command '" + cmdName + "', or not supported in cluster mode")
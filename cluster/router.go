@@ -8,6 +8,12 @@ type CmdLine = [][]byte
 func makeRouter() map[string]CmdFunc {
 	routerMap := make(map[string]CmdFunc)
 	routerMap["ping"] = ping
+	// users and persistence are managed by each node
+	routerMap["acl"] = execLocal
+	routerMap["bgrewriteaof"] = execLocal
+	routerMap["save"] = execLocal
+	routerMap["bgsave"] = execLocal
+	routerMap["lastsave"] = execLocal
 
 	routerMap["del"] = Del
 
@@ -15,12 +21,71 @@ func makeRouter() map[string]CmdFunc {
 	routerMap["type"] = defaultFunc
 	routerMap["rename"] = Rename
 	routerMap["renamenx"] = Rename
+	routerMap["expire"] = defaultFunc
+	routerMap["pexpire"] = defaultFunc
+	routerMap["expireat"] = defaultFunc
+	routerMap["pexpireat"] = defaultFunc
+	routerMap["ttl"] = defaultFunc
+	routerMap["pttl"] = defaultFunc
+	routerMap["persist"] = defaultFunc
 
 	routerMap["set"] = defaultFunc
 	routerMap["setnx"] = defaultFunc
 	routerMap["get"] = defaultFunc
 	routerMap["getset"] = defaultFunc
 
+	routerMap["lpush"] = defaultFunc
+	routerMap["lpushx"] = defaultFunc
+	routerMap["rpush"] = defaultFunc
+	routerMap["rpushx"] = defaultFunc
+	routerMap["lpop"] = defaultFunc
+	routerMap["rpop"] = defaultFunc
+	routerMap["lrem"] = defaultFunc
+	routerMap["llen"] = defaultFunc
+	routerMap["lindex"] = defaultFunc
+	routerMap["lset"] = defaultFunc
+	routerMap["lrange"] = defaultFunc
+	routerMap["ltrim"] = defaultFunc
+	routerMap["linsert"] = defaultFunc
+
+	routerMap["hset"] = defaultFunc
+	routerMap["hmset"] = defaultFunc
+	routerMap["hsetnx"] = defaultFunc
+	routerMap["hget"] = defaultFunc
+	routerMap["hexists"] = defaultFunc
+	routerMap["hdel"] = defaultFunc
+	routerMap["hlen"] = defaultFunc
+	routerMap["hstrlen"] = defaultFunc
+	routerMap["hmget"] = defaultFunc
+	routerMap["hkeys"] = defaultFunc
+	routerMap["hvals"] = defaultFunc
+	routerMap["hgetall"] = defaultFunc
+	routerMap["hincrby"] = defaultFunc
+	routerMap["hincrbyfloat"] = defaultFunc
+
+	routerMap["sadd"] = defaultFunc
+	routerMap["sismember"] = defaultFunc
+	routerMap["smismember"] = defaultFunc
+	routerMap["srem"] = defaultFunc
+	routerMap["spop"] = defaultFunc
+	routerMap["scard"] = defaultFunc
+	routerMap["smembers"] = defaultFunc
+	routerMap["srandmember"] = defaultFunc
+
+	routerMap["zadd"] = defaultFunc
+	routerMap["zscore"] = defaultFunc
+	routerMap["zincrby"] = defaultFunc
+	routerMap["zrank"] = defaultFunc
+	routerMap["zrevrank"] = defaultFunc
+	routerMap["zcount"] = defaultFunc
+	routerMap["zcard"] = defaultFunc
+	routerMap["zrange"] = defaultFunc
+	routerMap["zrevrange"] = defaultFunc
+	routerMap["zrangebyscore"] = defaultFunc
+	routerMap["zrevrangebyscore"] = defaultFunc
+	routerMap["zrem"] = defaultFunc
+	routerMap["zremrangebyrank"] = defaultFunc
+
 	routerMap["flushdb"] = FlushDB
 
 	return routerMap
@@ -32,3 +97,8 @@ func defaultFunc(cluster *ClusterDatabase, c resp.Connection, args [][]byte) res
 	peer := cluster.peerPicker.PickNode(key)
 	return cluster.relay(peer, c, args)
 }
+
+// execute command on current node, it's not relayed to the peers
+func execLocal(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return cluster.db.Exec(c, args)
+}
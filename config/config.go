@@ -12,32 +12,112 @@ import (
 
 // ServerProperties defines global config properties
 type ServerProperties struct {
+	// port is 6379 if it's missing, only "port 0" disables the plaintext listener
 	Bind           string `cfg:"bind"`
 	Port           int    `cfg:"port"`
 	AppendOnly     bool   `cfg:"appendOnly"`
 	AppendFilename string `cfg:"appendFilename"`
+	AppendFsync    string `cfg:"appendfsync"`
 	MaxClients     int    `cfg:"maxclients"`
 	RequirePass    string `cfg:"requirepass"`
+	AclFile        string `cfg:"aclfile"`
 	Databases      int    `cfg:"databases"`
 
+	// close the connection after the client is idle for N seconds, 0 disables
+	Timeout int `cfg:"timeout"`
+	// probe clients every N seconds to detect dead peers, 0 disables
+	TcpKeepalive int `cfg:"tcp-keepalive"`
+	// backlog of the listening socket, it's also capped by /proc/sys/net/core/somaxconn on linux
+	TcpBacklog int `cfg:"tcp-backlog"`
+
+	// serve TLS on tls-port, alongside the plaintext port or instead of it if port is 0
+	TlsPort       int    `cfg:"tls-port"`
+	TlsCertFile   string `cfg:"tls-cert-file"`
+	TlsKeyFile    string `cfg:"tls-key-file"`
+	TlsCaCertFile string `cfg:"tls-ca-cert-file"`
+	// yes, no or optional, whether clients must present a certificate signed by tls-ca-cert-file, yes by default
+	TlsAuthClients string `cfg:"tls-auth-clients"`
+	// dial peers over TLS, peers should be the addresses of their tls-port
+	TlsCluster bool `cfg:"tls-cluster"`
+
+	// rewrite aof when it grows by the percentage since the latest rewrite, 0 disables auto rewrite
+	AutoAofRewritePercentage int   `cfg:"auto-aof-rewrite-percentage"`
+	AutoAofRewriteMinSize    int64 `cfg:"auto-aof-rewrite-min-size"`
+	// load the complete commands of a truncated aof instead of refusing to start, yes by default
+	AofLoadTruncated bool `cfg:"aof-load-truncated"`
+	// directory of base file, incr files and manifest, relative to the directory of appendfilename
+	AppendDirname string `cfg:"appenddirname"`
+	// write base file in rdb format when rewriting, yes by default
+	AofUseRdbPreamble bool `cfg:"aof-use-rdb-preamble"`
+	// keep the files replaced by rewrite in appenddirname for archiving instead of removing them
+	AofKeepHistory bool `cfg:"aof-keep-history"`
+	// write "#TS:<unix time>" annotations into aof, so that it can be truncated to a point in time
+	AofTimestampEnabled bool `cfg:"aof-timestamp-enabled"`
+
+	// save rules as pairs of "<seconds> <changes>", e.g. "900 1 300 10", empty disables auto save
+	Save       string `cfg:"save"`
+	DbFilename string `cfg:"dbfilename"`
+
+	// seconds to wait for in-flight commands and draining aof on shutdown, 0 waits without limit
+	ShutdownTimeout int `cfg:"shutdown-timeout"`
+
+	// max length of a bulk string in requests, 0 means no limit
+	ProtoMaxBulkLen int64 `cfg:"proto-max-bulk-len"`
+	// max number of arguments of a multi bulk request, 0 means no limit
+	ProtoMaxMultibulkLen int64 `cfg:"proto-max-multibulk-len"`
+	// clients are disconnected once the request being read exceeds the limit, 0 means no limit
+	ClientQueryBufferLimit int64 `cfg:"client-query-buffer-limit"`
+	// "<class> <hard limit> <soft limit> <soft seconds>" for classes normal, replica and pubsub,
+	// it may be written in multiple lines, one for each class
+	ClientOutputBufferLimit string `cfg:"client-output-buffer-limit"`
+
 	Peers []string `cfg:"peers"`
 	Self  string   `cfg:"self"`
+	// the user authenticating connections to peers, the default user with requirepass if peer-user is empty
+	PeerUser     string `cfg:"peer-user"`
+	PeerPassword string `cfg:"peer-password"`
+}
+
+const (
+	defaultTcpKeepalive           = 300
+	defaultTcpBacklog             = 511
+	defaultShutdownTimeout        = 10
+	defaultProtoMaxBulkLen        = 512 << 20
+	defaultProtoMaxMultibulkLen   = 1024 * 1024
+	defaultClientQueryBufferLimit = 1 << 30
+)
+
+// repeatableKeys are the options whose values of multiple lines are joined rather than overwritten
+var repeatableKeys = map[string]bool{
+	"client-output-buffer-limit": true,
 }
 
 // Properties holds global config properties
 var Properties *ServerProperties
 
 func init() {
-	// default config
-	Properties = &ServerProperties{
-		Bind:       "127.0.0.1",
-		Port:       6379,
-		AppendOnly: false,
+	Properties = DefaultProperties()
+}
+
+// DefaultProperties returns the config used when there is no config file, options missing in config file keep these values
+func DefaultProperties() *ServerProperties {
+	return &ServerProperties{
+		Bind: "0.0.0.0",
+		Port: 6379,
+		// options enabled by default
+		AofLoadTruncated:       true,
+		AofUseRdbPreamble:      true,
+		TcpKeepalive:           defaultTcpKeepalive,
+		TcpBacklog:             defaultTcpBacklog,
+		ShutdownTimeout:        defaultShutdownTimeout,
+		ProtoMaxBulkLen:        defaultProtoMaxBulkLen,
+		ProtoMaxMultibulkLen:   defaultProtoMaxMultibulkLen,
+		ClientQueryBufferLimit: defaultClientQueryBufferLimit,
 	}
 }
 
 func parse(src io.Reader) *ServerProperties {
-	config := &ServerProperties{}
+	config := DefaultProperties()
 
 	// read config file
 	rawMap := make(map[string]string)
@@ -49,9 +129,12 @@ func parse(src io.Reader) *ServerProperties {
 		}
 		pivot := strings.IndexAny(line, " ")
 		if pivot > 0 && pivot < len(line)-1 { // separator found
-			key := line[0:pivot]
+			key := strings.ToLower(line[0:pivot])
 			value := strings.Trim(line[pivot+1:], " ")
-			rawMap[strings.ToLower(key)] = value
+			if prev, ok := rawMap[key]; ok && repeatableKeys[key] {
+				value = prev + " " + value
+			}
+			rawMap[key] = value
 		}
 	}
 	if err := scanner.Err(); err != nil {
@@ -75,8 +158,8 @@ func parse(src io.Reader) *ServerProperties {
 			switch field.Type.Kind() {
 			case reflect.String:
 				fieldVal.SetString(value)
-			case reflect.Int:
-				intValue, err := strconv.ParseInt(value, 10, 64)
+			case reflect.Int, reflect.Int64:
+				intValue, err := ParseSize(value)
 				if err == nil {
 					fieldVal.SetInt(intValue)
 				}
@@ -94,6 +177,28 @@ func parse(src io.Reader) *ServerProperties {
 	return config
 }
 
+// ParseSize parses integers with an optional unit, such as 64mb, 1gb or 100
+func ParseSize(value string) (int64, error) {
+	lower := strings.ToLower(value)
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(lower, unit.suffix), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return n * unit.factor, nil
+		}
+	}
+	return strconv.ParseInt(lower, 10, 64)
+}
+
 // SetupConfig read config file and store properties into Properties
 func SetupConfig(configFilename string) {
 	file, err := os.Open(configFilename)
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse_Defaults(t *testing.T) {
+	for name, props := range map[string]*ServerProperties{
+		"empty config":       parse(strings.NewReader("")),
+		"no config file":     DefaultProperties(),
+		"config with bind":   parse(strings.NewReader("bind 127.0.0.1\n")),
+		"properties of init": Properties,
+	} {
+		if props.ProtoMaxBulkLen != defaultProtoMaxBulkLen {
+			t.Errorf("%s: expected proto-max-bulk-len %d, actually %d", name, defaultProtoMaxBulkLen, props.ProtoMaxBulkLen)
+		}
+		if props.ProtoMaxMultibulkLen != defaultProtoMaxMultibulkLen {
+			t.Errorf("%s: expected proto-max-multibulk-len %d, actually %d", name, defaultProtoMaxMultibulkLen, props.ProtoMaxMultibulkLen)
+		}
+		if props.ClientQueryBufferLimit != defaultClientQueryBufferLimit {
+			t.Errorf("%s: expected client-query-buffer-limit %d, actually %d", name, defaultClientQueryBufferLimit, props.ClientQueryBufferLimit)
+		}
+		if props.TcpKeepalive != defaultTcpKeepalive || props.TcpBacklog != defaultTcpBacklog {
+			t.Errorf("%s: expected tcp-keepalive %d and tcp-backlog %d, actually %d and %d",
+				name, defaultTcpKeepalive, defaultTcpBacklog, props.TcpKeepalive, props.TcpBacklog)
+		}
+		if props.ShutdownTimeout != defaultShutdownTimeout {
+			t.Errorf("%s: expected shutdown-timeout %d, actually %d", name, defaultShutdownTimeout, props.ShutdownTimeout)
+		}
+		if !props.AofLoadTruncated || !props.AofUseRdbPreamble {
+			t.Errorf("%s: aof-load-truncated and aof-use-rdb-preamble should be enabled", name)
+		}
+	}
+}
+
+func TestParse_Overrides(t *testing.T) {
+	props := parse(strings.NewReader(strings.Join([]string{
+		"proto-max-bulk-len 1mb",
+		"proto-max-multibulk-len 100",
+		"client-query-buffer-limit 0",
+		"aof-use-rdb-preamble no",
+		"client-output-buffer-limit normal 0 0 0",
+		"client-output-buffer-limit pubsub 32mb 8mb 60",
+	}, "\n")))
+	if props.ProtoMaxBulkLen != 1<<20 {
+		t.Errorf("expected proto-max-bulk-len %d, actually %d", 1<<20, props.ProtoMaxBulkLen)
+	}
+	if props.ProtoMaxMultibulkLen != 100 {
+		t.Errorf("expected proto-max-multibulk-len 100, actually %d", props.ProtoMaxMultibulkLen)
+	}
+	if props.ClientQueryBufferLimit != 0 {
+		t.Errorf("expected client-query-buffer-limit 0, actually %d", props.ClientQueryBufferLimit)
+	}
+	if props.AofUseRdbPreamble {
+		t.Error("aof-use-rdb-preamble should be disabled")
+	}
+	if expected := "normal 0 0 0 pubsub 32mb 8mb 60"; props.ClientOutputBufferLimit != expected {
+		t.Errorf("expected client-output-buffer-limit %q, actually %q", expected, props.ClientOutputBufferLimit)
+	}
+}
+
+func TestParse_Port(t *testing.T) {
+	tests := []struct {
+		config string
+		port   int
+	}{
+		{"", 6379},
+		{"bind 127.0.0.1\ntls-port 6380", 6379},
+		{"port 7000", 7000},
+		// plaintext listener is disabled only if port is explicitly 0
+		{"port 0\ntls-port 6380", 0},
+	}
+	for _, tt := range tests {
+		props := parse(strings.NewReader(tt.config))
+		if props.Port != tt.port {
+			t.Errorf("config %q: expected port %d, actually %d", tt.config, tt.port, props.Port)
+		}
+	}
+}
@@ -0,0 +1,674 @@
+package database
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/lib/wildcard"
+	"go-redis/resp/reply"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// extraCommandCategories holds categories of commands which are not registered in cmdTable
+var extraCommandCategories = map[string][]string{
+	"auth":    {"connection"},
+	"hello":   {"connection"},
+	"select":  {"connection"},
+	"multi":   {"transaction"},
+	"exec":    {"transaction"},
+	"discard": {"transaction"},
+	"watch":   {"transaction"},
+	"unwatch": {"transaction"},
+	"acl":     {"admin", "dangerous"},
+	"info":    {"dangerous"},
+
+	"bgrewriteaof": {"admin", "dangerous"},
+	"save":         {"admin", "dangerous"},
+	"bgsave":       {"admin", "dangerous"},
+	"lastsave":     {"admin", "dangerous"},
+	"shutdown":     {"admin", "dangerous"},
+}
+
+// aclUser holds password and permissions of a user
+type aclUser struct {
+	name    string
+	enabled bool
+	nopass  bool
+	// sha256 of passwords in hex
+	passwords []string
+	// command name -> allowed
+	allowed map[string]bool
+	// command rules applied after the last +@all or -@all, used to describe the user
+	cmdRules []string
+	// key patterns the user can access
+	keyPatterns []string
+	patterns    []*wildcard.Pattern
+}
+
+// aclUsers holds all users, the default user is used by unauthenticated connections if it's nopass.
+// users are created by SetupACL, because `+@all` needs the complete cmdTable
+var aclUsers = struct {
+	mu    sync.RWMutex
+	users map[string]*aclUser
+	// sessions holds connections authenticated by AUTH, user name -> connections.
+	// a connection is authenticated as the user only while it's in the sessions of the user
+	sessions map[string]map[resp.Connection]struct{}
+}{
+	users:    make(map[string]*aclUser),
+	sessions: make(map[string]map[resp.Connection]struct{}),
+}
+
+func makeACLUser(name string) *aclUser {
+	return &aclUser{
+		name:     name,
+		allowed:  make(map[string]bool),
+		cmdRules: []string{"-@all"},
+	}
+}
+
+// makeDefaultUser returns a user that can do anything without password
+func makeDefaultUser() *aclUser {
+	u := makeACLUser(defaultUser)
+	for _, rule := range []string{"on", "nopass", "~*", "+@all"} {
+		_ = u.applyRule(rule)
+	}
+	return u
+}
+
+func (u *aclUser) clone() *aclUser {
+	c := *u
+	c.passwords = append([]string(nil), u.passwords...)
+	c.cmdRules = append([]string(nil), u.cmdRules...)
+	c.keyPatterns = append([]string(nil), u.keyPatterns...)
+	c.patterns = append([]*wildcard.Pattern(nil), u.patterns...)
+	c.allowed = make(map[string]bool, len(u.allowed))
+	for k, v := range u.allowed {
+		c.allowed[k] = v
+	}
+	return &c
+}
+
+func hashPassword(passwd string) string {
+	sum := sha256.Sum256([]byte(passwd))
+	return hex.EncodeToString(sum[:])
+}
+
+func isPasswordHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func (u *aclUser) addPasswordHash(h string) {
+	u.nopass = false
+	for _, p := range u.passwords {
+		if p == h {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, h)
+}
+
+func (u *aclUser) removePasswordHash(h string) error {
+	for i, p := range u.passwords {
+		if p == h {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such password")
+}
+
+func (u *aclUser) addKeyPattern(pattern string) {
+	for _, p := range u.keyPatterns {
+		if p == pattern {
+			return
+		}
+	}
+	u.keyPatterns = append(u.keyPatterns, pattern)
+	u.patterns = append(u.patterns, wildcard.CompilePattern(pattern))
+}
+
+func (u *aclUser) setAllCommands(allow bool) {
+	u.allowed = make(map[string]bool)
+	if allow {
+		for name := range cmdTable {
+			u.allowed[name] = true
+		}
+		for name := range extraCommandCategories {
+			u.allowed[name] = true
+		}
+		u.cmdRules = []string{"+@all"}
+	} else {
+		u.cmdRules = []string{"-@all"}
+	}
+}
+
+// applyRule changes the user according to an ACL rule, such as `on`, `>password`, `~key*` or `+@read`
+func (u *aclUser) applyRule(rule string) error {
+	if rule == "" {
+		return errors.New("Syntax error")
+	}
+	lower := strings.ToLower(rule)
+	switch lower {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		u.addKeyPattern("*")
+		return nil
+	case "resetkeys":
+		u.keyPatterns = nil
+		u.patterns = nil
+		return nil
+	case "allcommands", "+@all":
+		u.setAllCommands(true)
+		return nil
+	case "nocommands", "-@all":
+		u.setAllCommands(false)
+		return nil
+	case "reset":
+		u.enabled = false
+		u.nopass = false
+		u.passwords = nil
+		u.keyPatterns = nil
+		u.patterns = nil
+		u.setAllCommands(false)
+		return nil
+	}
+	switch rule[0] {
+	case '>':
+		u.addPasswordHash(hashPassword(rule[1:]))
+	case '<':
+		return u.removePasswordHash(hashPassword(rule[1:]))
+	case '#':
+		if !isPasswordHash(lower[1:]) {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.addPasswordHash(lower[1:])
+	case '!':
+		return u.removePasswordHash(lower[1:])
+	case '~':
+		u.addKeyPattern(rule[1:])
+	case '+', '-':
+		allow := rule[0] == '+'
+		var cmds []string
+		if strings.HasPrefix(lower[1:], "@") {
+			var ok bool
+			cmds, ok = commandsInCategory(lower[2:])
+			if !ok {
+				return errors.New("Unknown command or category name in ACL")
+			}
+		} else {
+			if !isKnownCommand(lower[1:]) {
+				return errors.New("Unknown command or category name in ACL")
+			}
+			cmds = []string{lower[1:]}
+		}
+		for _, cmd := range cmds {
+			if allow {
+				u.allowed[cmd] = true
+			} else {
+				delete(u.allowed, cmd)
+			}
+		}
+		u.cmdRules = append(u.cmdRules, lower)
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+func (u *aclUser) checkPassword(passwd string) bool {
+	if u.nopass {
+		return true
+	}
+	h := hashPassword(passwd)
+	for _, p := range u.passwords {
+		if p == h {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) canExec(cmdName string) bool {
+	return u.allowed[cmdName]
+}
+
+func (u *aclUser) canAccessKey(key string) bool {
+	for _, pattern := range u.patterns {
+		if pattern.IsMatch(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns rules which can rebuild the user, such as `on nopass ~* +@all`
+func (u *aclUser) describe() string {
+	rules := make([]string, 0)
+	if u.enabled {
+		rules = append(rules, "on")
+	} else {
+		rules = append(rules, "off")
+	}
+	if u.nopass {
+		rules = append(rules, "nopass")
+	}
+	for _, p := range u.passwords {
+		rules = append(rules, "#"+p)
+	}
+	for _, p := range u.keyPatterns {
+		rules = append(rules, "~"+p)
+	}
+	rules = append(rules, u.cmdRules...)
+	return strings.Join(rules, " ")
+}
+
+func isKnownCommand(name string) bool {
+	if _, ok := cmdTable[name]; ok {
+		return true
+	}
+	_, ok := extraCommandCategories[name]
+	return ok
+}
+
+func commandCategories(name string) []string {
+	if cmd, ok := cmdTable[name]; ok {
+		return cmd.categories
+	}
+	return extraCommandCategories[name]
+}
+
+// commandsInCategory returns all commands in the given category, ok is false if the category is unknown
+func commandsInCategory(category string) (cmds []string, ok bool) {
+	check := func(name string, categories []string) {
+		for _, c := range categories {
+			if c == category {
+				cmds = append(cmds, name)
+				ok = true
+				return
+			}
+		}
+	}
+	for name, cmd := range cmdTable {
+		check(name, cmd.categories)
+	}
+	for name, categories := range extraCommandCategories {
+		check(name, categories)
+	}
+	sort.Strings(cmds)
+	return cmds, ok
+}
+
+func allCategories() []string {
+	set := make(map[string]struct{})
+	for name := range cmdTable {
+		for _, c := range commandCategories(name) {
+			set[c] = struct{}{}
+		}
+	}
+	for _, categories := range extraCommandCategories {
+		for _, c := range categories {
+			set[c] = struct{}{}
+		}
+	}
+	result := make([]string, 0, len(set))
+	for c := range set {
+		result = append(result, c)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// currentUser returns the user of connection, returns nil if the connection isn't authenticated.
+// caller should hold aclUsers.mu
+func currentUser(c resp.Connection) *aclUser {
+	name := c.GetUser()
+	if name == "" {
+		u := aclUsers.users[defaultUser]
+		if u != nil && u.enabled && u.nopass {
+			return u
+		}
+		return nil
+	}
+	if _, ok := aclUsers.sessions[name][c]; !ok {
+		// the session is invalidated by ACL DELUSER, a new user of the same name can't take it over
+		return nil
+	}
+	return aclUsers.users[name]
+}
+
+// addSession records that the connection is authenticated as the user, caller should hold aclUsers.mu exclusively
+func addSession(c resp.Connection, name string) {
+	removeSession(c)
+	if aclUsers.sessions[name] == nil {
+		aclUsers.sessions[name] = make(map[resp.Connection]struct{})
+	}
+	aclUsers.sessions[name][c] = struct{}{}
+	c.SetUser(name)
+}
+
+// removeSession forgets the connection, caller should hold aclUsers.mu exclusively
+func removeSession(c resp.Connection) {
+	name := c.GetUser()
+	if conns, ok := aclUsers.sessions[name]; ok {
+		delete(conns, c)
+		if len(conns) == 0 {
+			delete(aclUsers.sessions, name)
+		}
+	}
+}
+
+// closeSession forgets the connection after it's closed
+func closeSession(c resp.Connection) {
+	aclUsers.mu.Lock()
+	removeSession(c)
+	aclUsers.mu.Unlock()
+}
+
+// SetupACL initializes users by requirepass and aclfile, it should be called before serving clients
+func SetupACL() error {
+	users := map[string]*aclUser{defaultUser: makeDefaultUser()}
+	if config.Properties.RequirePass != "" {
+		u := users[defaultUser]
+		_ = u.applyRule("resetpass")
+		_ = u.applyRule(">" + config.Properties.RequirePass)
+	}
+	if config.Properties.AclFile != "" {
+		loaded, err := loadACLFile(config.Properties.AclFile)
+		if err != nil {
+			return err
+		}
+		for name, u := range loaded {
+			users[name] = u
+		}
+	}
+	aclUsers.mu.Lock()
+	aclUsers.users = users
+	aclUsers.mu.Unlock()
+	return nil
+}
+
+// loadACLFile reads users from aclfile, a missing file is regarded as empty
+func loadACLFile(filename string) (map[string]*aclUser, error) {
+	users := make(map[string]*aclUser)
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "user" {
+			return nil, fmt.Errorf("%s:%d: should start with user keyword", filename, lineNum)
+		}
+		name := fields[1]
+		if _, ok := users[name]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate user '%s'", filename, lineNum, name)
+		}
+		u := makeACLUser(name)
+		for _, rule := range fields[2:] {
+			if err := u.applyRule(rule); err != nil {
+				return nil, fmt.Errorf("%s:%d: error in user rule '%s': %v", filename, lineNum, rule, err)
+			}
+		}
+		users[name] = u
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// saveACLFile rewrites aclfile, writes a temp file at first then renames it to avoid partial file
+func saveACLFile(filename string) error {
+	var sb strings.Builder
+	for _, name := range sortedUserNames() {
+		sb.WriteString("user " + name + " " + aclUsers.users[name].describe() + "\n")
+	}
+	tmpFilename := filename + ".tmp"
+	if err := os.WriteFile(tmpFilename, []byte(sb.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+// execACL executes ACL subcommands
+func execACL(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("acl")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "setuser":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply("acl|setuser")
+		}
+		return aclSetUser(args)
+	case "getuser":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("acl|getuser")
+		}
+		return aclGetUser(string(args[0]))
+	case "deluser":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply("acl|deluser")
+		}
+		return aclDelUser(args)
+	case "list":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|list")
+		}
+		return aclList()
+	case "users":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|users")
+		}
+		return aclUserNames()
+	case "whoami":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|whoami")
+		}
+		name := c.GetUser()
+		if name == "" {
+			name = defaultUser
+		}
+		return reply.MakeBulkReply([]byte(name))
+	case "cat":
+		if len(args) > 1 {
+			return reply.MakeArgNumErrReply("acl|cat")
+		}
+		return aclCat(args)
+	case "save":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|save")
+		}
+		return aclSave()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try ACL HELP.")
+}
+
+// aclSetUser creates or modifies a user, nothing is changed if any rule is invalid
+func aclSetUser(args [][]byte) resp.Reply {
+	name := string(args[0])
+	aclUsers.mu.Lock()
+	defer aclUsers.mu.Unlock()
+	u, ok := aclUsers.users[name]
+	if ok {
+		u = u.clone()
+	} else {
+		u = makeACLUser(name)
+	}
+	for _, rule := range args[1:] {
+		if err := u.applyRule(string(rule)); err != nil {
+			return reply.MakeErrReply(fmt.Sprintf("ERR Error in ACL SETUSER modifier '%s': %v", string(rule), err))
+		}
+	}
+	aclUsers.users[name] = u
+	return reply.MakeOKReply()
+}
+
+func aclGetUser(name string) resp.Reply {
+	aclUsers.mu.RLock()
+	defer aclUsers.mu.RUnlock()
+	u, ok := aclUsers.users[name]
+	if !ok {
+		return reply.MakeNullBulkReply()
+	}
+	flags := make([][]byte, 0, 2)
+	if u.enabled {
+		flags = append(flags, []byte("on"))
+	} else {
+		flags = append(flags, []byte("off"))
+	}
+	if u.nopass {
+		flags = append(flags, []byte("nopass"))
+	}
+	passwords := make([][]byte, len(u.passwords))
+	for i, p := range u.passwords {
+		passwords[i] = []byte(p)
+	}
+	keys := make([][]byte, len(u.keyPatterns))
+	for i, p := range u.keyPatterns {
+		keys[i] = []byte(p)
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("flags")),
+		reply.MakeMultiBulkReply(flags),
+		reply.MakeBulkReply([]byte("passwords")),
+		reply.MakeMultiBulkReply(passwords),
+		reply.MakeBulkReply([]byte("commands")),
+		reply.MakeBulkReply([]byte(strings.Join(u.cmdRules, " "))),
+		reply.MakeBulkReply([]byte("keys")),
+		reply.MakeMultiBulkReply(keys),
+	})
+}
+
+// aclDelUser deletes users and disconnects the clients authenticated as them, like redis
+func aclDelUser(args [][]byte) resp.Reply {
+	for _, arg := range args {
+		if string(arg) == defaultUser {
+			return reply.MakeErrReply("ERR The 'default' user cannot be removed")
+		}
+	}
+	deleted := 0
+	var conns []resp.Connection
+	aclUsers.mu.Lock()
+	for _, arg := range args {
+		name := string(arg)
+		if _, ok := aclUsers.users[name]; ok {
+			delete(aclUsers.users, name)
+			deleted++
+		}
+		// sessions are invalidated immediately, so that they can't be taken over by a new user of the same name
+		for c := range aclUsers.sessions[name] {
+			conns = append(conns, c)
+		}
+		delete(aclUsers.sessions, name)
+	}
+	aclUsers.mu.Unlock()
+	for _, c := range conns {
+		// closing waits for pending replies, it shouldn't block the caller
+		go func(c resp.Connection) {
+			_ = c.Close()
+		}(c)
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+func sortedUserNames() []string {
+	names := make([]string, 0, len(aclUsers.users))
+	for name := range aclUsers.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func aclList() resp.Reply {
+	aclUsers.mu.RLock()
+	defer aclUsers.mu.RUnlock()
+	names := sortedUserNames()
+	result := make([][]byte, len(names))
+	for i, name := range names {
+		result[i] = []byte("user " + name + " " + aclUsers.users[name].describe())
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+func aclUserNames() resp.Reply {
+	aclUsers.mu.RLock()
+	defer aclUsers.mu.RUnlock()
+	names := sortedUserNames()
+	result := make([][]byte, len(names))
+	for i, name := range names {
+		result[i] = []byte(name)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+func aclCat(args [][]byte) resp.Reply {
+	var names []string
+	if len(args) == 0 {
+		names = allCategories()
+	} else {
+		category := strings.ToLower(string(args[0]))
+		cmds, ok := commandsInCategory(category)
+		if !ok {
+			return reply.MakeErrReply("ERR Unknown category '" + category + "'")
+		}
+		names = cmds
+	}
+	result := make([][]byte, len(names))
+	for i, name := range names {
+		result[i] = []byte(name)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+func aclSave() resp.Reply {
+	if config.Properties.AclFile == "" {
+		return reply.MakeErrReply("ERR This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command")
+	}
+	aclUsers.mu.RLock()
+	defer aclUsers.mu.RUnlock()
+	if err := saveACLFile(config.Properties.AclFile); err != nil {
+		logger.Error("save acl file failed: " + err.Error())
+		return reply.MakeErrReply("ERR There was an error trying to save the ACLs. Please check the server logs for more information")
+	}
+	return reply.MakeOKReply()
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"go-redis/config"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"testing"
+	"time"
+)
+
+// setupACLConfig resets users to the default user without password
+func setupACLConfig(t *testing.T) {
+	backup := config.Properties
+	config.Properties = config.DefaultProperties()
+	if err := SetupACL(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		config.Properties = backup
+		_ = SetupACL()
+	})
+}
+
+func TestACLDelUser_Sessions(t *testing.T) {
+	setupACLConfig(t)
+	admin := makeTestConn(t)
+	for _, user := range []string{"alice", "bob"} {
+		result := execACL(admin, utils.ToCmdLine("SETUSER", user, "on", ">"+user+"-pass", "~*", "+@all"))
+		if reply.IsErrorReply(result) {
+			t.Fatal(string(result.ToBytes()))
+		}
+	}
+	alice, bob := makeTestConn(t), makeTestConn(t)
+	if result := Auth(alice, utils.ToCmdLine("alice", "alice-pass")); reply.IsErrorReply(result) {
+		t.Fatal(string(result.ToBytes()))
+	}
+	if result := Auth(bob, utils.ToCmdLine("bob", "bob-pass")); reply.IsErrorReply(result) {
+		t.Fatal(string(result.ToBytes()))
+	}
+
+	result := execACL(admin, utils.ToCmdLine("DELUSER", "alice"))
+	if intReply, ok := result.(*reply.IntReply); !ok || intReply.Code != 1 {
+		t.Fatalf("expected 1 user deleted, actually %q", result.ToBytes())
+	}
+	// a new user of the same name doesn't take over the session
+	execACL(admin, utils.ToCmdLine("SETUSER", "alice", "on", "nopass", "~*", "+@all"))
+	if errReply := Authorize(alice, utils.ToCmdLine("GET", "k")); errReply == nil {
+		t.Error("session of the deleted user should be invalidated")
+	}
+	if errReply := Authorize(bob, utils.ToCmdLine("GET", "k")); errReply != nil {
+		t.Errorf("session of other users shouldn't be affected, actually %q", errReply.ToBytes())
+	}
+	// the client is disconnected
+	deadline := time.Now().Add(time.Second)
+	for alice.Write([]byte("+PONG\r\n")) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("client of the deleted user is not disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAuthorize_KeyPatterns(t *testing.T) {
+	setupACLConfig(t)
+	admin := makeTestConn(t)
+	result := execACL(admin, utils.ToCmdLine("SETUSER", "alice", "on", "nopass", "+@all",
+		"~user:*", "~cache:?", "~obj:[ab]", "~k[0-2]", "~tmp[^x]", `~lit\*`))
+	if reply.IsErrorReply(result) {
+		t.Fatal(string(result.ToBytes()))
+	}
+	alice := makeTestConn(t)
+	if result := Auth(alice, utils.ToCmdLine("alice", "")); reply.IsErrorReply(result) {
+		t.Fatal(string(result.ToBytes()))
+	}
+
+	tests := []struct {
+		cmdLine []string
+		allowed bool
+	}{
+		{[]string{"GET", "user:1"}, true},
+		{[]string{"GET", "user:"}, true},
+		{[]string{"GET", "user"}, false},
+		{[]string{"GET", "other:user:1"}, false},
+		{[]string{"GET", "cache:a"}, true},
+		{[]string{"GET", "cache:"}, false},
+		{[]string{"GET", "cache:ab"}, false},
+		{[]string{"GET", "obj:a"}, true},
+		{[]string{"GET", "obj:c"}, false},
+		{[]string{"GET", "k1"}, true},
+		{[]string{"GET", "k3"}, false},
+		{[]string{"GET", "tmpa"}, true},
+		{[]string{"GET", "tmpx"}, false},
+		{[]string{"GET", "lit*"}, true},
+		{[]string{"GET", "literal"}, false},
+		// every key of the command must be allowed
+		{[]string{"MSET", "user:1", "v", "k0", "v"}, true},
+		{[]string{"MSET", "user:1", "v", "k9", "v"}, false},
+		{[]string{"RENAME", "user:1", "secret"}, false},
+		{[]string{"WATCH", "user:1", "secret"}, false},
+		{[]string{"DEL", "k2", "cache:z"}, true},
+		// commands without keys are not limited by key patterns
+		{[]string{"PING"}, true},
+	}
+	for _, tt := range tests {
+		errReply := Authorize(alice, utils.ToCmdLine(tt.cmdLine...))
+		if tt.allowed && errReply != nil {
+			t.Errorf("%v: expected allowed, actually %q", tt.cmdLine, errReply.ToBytes())
+		} else if !tt.allowed && (errReply == nil || errReply.Error() != "NOPERM No permissions to access a key") {
+			t.Errorf("%v: expected no permissions to access a key, actually %v", tt.cmdLine, errReply)
+		}
+	}
+
+	// resetkeys denies every key, allkeys allows every key
+	execACL(admin, utils.ToCmdLine("SETUSER", "alice", "resetkeys"))
+	if errReply := Authorize(alice, utils.ToCmdLine("GET", "user:1")); errReply == nil {
+		t.Error("expected key denied after resetkeys")
+	}
+	execACL(admin, utils.ToCmdLine("SETUSER", "alice", "allkeys"))
+	if errReply := Authorize(alice, utils.ToCmdLine("GET", "any")); errReply != nil {
+		t.Errorf("expected key allowed after allkeys, actually %q", errReply.ToBytes())
+	}
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"fmt"
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// defaultUser is used by connections which haven't called AUTH, it's protected by requirepass
+const defaultUser = "default"
+
+// Auth validates client's password, supports `AUTH password` and `AUTH username password`
+func Auth(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgNumErrReply("auth")
+	}
+	username := defaultUser
+	passwd := string(args[0])
+	if len(args) == 2 {
+		username = string(args[0])
+		passwd = string(args[1])
+	}
+
+	aclUsers.mu.Lock()
+	defer aclUsers.mu.Unlock()
+	u, ok := aclUsers.users[username]
+	if len(args) == 1 && ok && u.nopass {
+		return reply.MakeErrReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	if !ok || !u.enabled || !u.checkPassword(passwd) {
+		return reply.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	addSession(c, username)
+	return reply.MakeOKReply()
+}
+
+// serverVersion is the redis version reported by HELLO
+const serverVersion = "7.0.0"
+
+// Hello implements HELLO [protover [AUTH username password] [SETNAME clientname]],
+// it switches protocol version and returns information of the server
+func Hello(c resp.Connection, args [][]byte) resp.Reply {
+	protocol := c.GetProtocol()
+	if len(args) > 0 {
+		ver, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return reply.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if ver != resp.Resp2 && ver != resp.Resp3 {
+			return reply.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+		protocol = ver
+	}
+	var authArgs [][]byte
+	name, setName := "", false
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "auth":
+			if i+2 >= len(args) {
+				return reply.MakeErrReply("ERR Syntax error in HELLO option 'auth'")
+			}
+			authArgs = args[i+1 : i+3]
+			i += 2
+		case "setname":
+			if i+1 >= len(args) {
+				return reply.MakeErrReply("ERR Syntax error in HELLO option 'setname'")
+			}
+			name, setName = string(args[i+1]), true
+			if strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r > '~' }) {
+				return reply.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+			}
+			i++
+		default:
+			return reply.MakeErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+		}
+	}
+	if authArgs != nil {
+		if r := Auth(c, authArgs); reply.IsErrorReply(r) {
+			return r
+		}
+	}
+	if !IsAuthenticated(c) {
+		return reply.MakeErrReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+	if setName {
+		c.SetName(name)
+	}
+	c.SetProtocol(protocol)
+
+	mode := "standalone"
+	if config.Properties.Self != "" && len(config.Properties.Peers) > 0 {
+		mode = "cluster"
+	}
+	fields := []struct {
+		key   string
+		value resp.Reply
+	}{
+		{"server", reply.MakeBulkReply([]byte("redis"))},
+		{"version", reply.MakeBulkReply([]byte(serverVersion))},
+		{"proto", reply.MakeIntReply(int64(protocol))},
+		{"mode", reply.MakeBulkReply([]byte(mode))},
+		{"role", reply.MakeBulkReply([]byte("master"))},
+		{"modules", reply.MakeEmptyMultiBulkReply()},
+	}
+	keys := make([]resp.Reply, len(fields))
+	values := make([]resp.Reply, len(fields))
+	for i, field := range fields {
+		keys[i] = reply.MakeBulkReply([]byte(field.key))
+		values[i] = field.value
+	}
+	return reply.MakeMapReply(keys, values)
+}
+
+// IsAuthenticated tells whether the connection is allowed to execute commands
+func IsAuthenticated(c resp.Connection) bool {
+	aclUsers.mu.RLock()
+	defer aclUsers.mu.RUnlock()
+	return currentUser(c) != nil
+}
+
+// Authorize checks whether the user of connection can execute the command and access its keys,
+// returns nil if allowed
+func Authorize(c resp.Connection, cmdLine [][]byte) resp.ErrorReply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	aclUsers.mu.RLock()
+	defer aclUsers.mu.RUnlock()
+	u := currentUser(c)
+	if u == nil {
+		return reply.MakeErrReply("NOAUTH Authentication required")
+	}
+	if !isKnownCommand(cmdName) {
+		// let database reply unknown command
+		return nil
+	}
+	var errReply resp.ErrorReply
+	if !u.canExec(cmdName) {
+		errReply = reply.MakeErrReply(fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", u.name, cmdName))
+	} else {
+		for _, key := range commandKeys(cmdName, cmdLine) {
+			if !u.canAccessKey(key) {
+				errReply = reply.MakeErrReply("NOPERM No permissions to access a key")
+				break
+			}
+		}
+	}
+	if errReply != nil && c.InMultiState() {
+		// the rejected command won't be queued, so the transaction should be aborted
+		c.AddTxError(errReply)
+	}
+	return errReply
+}
+
+// commandKeys returns keys accessed by the command
+func commandKeys(cmdName string, cmdLine [][]byte) []string {
+	if cmdName == "watch" {
+		_, keys := readAllKeys(cmdLine[1:])
+		return keys
+	}
+	cmd, ok := cmdTable[cmdName]
+	if !ok || !validateArity(cmd.arity, cmdLine) {
+		return nil
+	}
+	writeKeys, readKeys := cmd.prepare(cmdLine[1:])
+	return append(writeKeys, readKeys...)
+}
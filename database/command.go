@@ -6,18 +6,81 @@ import (
 
 var cmdTable = make(map[string]*command)
 
+// lockAllCommands modify every key of the db, so they hold all locks of the db instead of locks of their keys
+var lockAllCommands = map[string]bool{
+	"flushdb": true,
+}
+
 type command struct {
 	executor ExecFunc
-	arity    int // allow number of args, arity < 0 means len(args) >= -arity
+	prepare  PreFunc // return related keys command
+	arity    int     // allow number of args, arity < 0 means len(args) >= -arity
+	// acl categories of command, such as "read", "write", "string"
+	categories []string
 }
 
 // RegisterCommand registers a new command
 // arity means allowed number of cmdArgs, arity < 0 means len(args) >= -arity.
 // for example: the arity of `get` is 2, `mget` is -2
-func RegisterCommand(name string, executor ExecFunc, arity int) {
+// categories are used by ACL, for example: `+@read` allows all commands in category "read"
+func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, arity int, categories ...string) {
 	name = strings.ToLower(name)
 	cmdTable[name] = &command{
-		executor: executor,
-		arity:    arity,
+		executor:   executor,
+		prepare:    prepare,
+		arity:      arity,
+		categories: categories,
+	}
+}
+
+/* ---- prepare functions ---- */
+
+func noPrepare(args [][]byte) ([]string, []string) {
+	return nil, nil
+}
+
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	key := string(args[0])
+	return []string{key}, nil
+}
+
+func readFirstKey(args [][]byte) ([]string, []string) {
+	key := string(args[0])
+	return nil, []string{key}
+}
+
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return keys, nil
+}
+
+func readAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return nil, keys
+}
+
+// writeEvenKeys returns keys of key-value pairs, such as MSET k1 v1 k2 v2
+func writeEvenKeys(args [][]byte) ([]string, []string) {
+	size := len(args) / 2
+	keys := make([]string, size)
+	for i := 0; i < size; i++ {
+		keys[i] = string(args[2*i])
+	}
+	return keys, nil
+}
+
+// writeFirstReadOthers returns the destination key as write key and source keys as read keys, such as SINTERSTORE
+func writeFirstReadOthers(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	keys := make([]string, len(args)-1)
+	for i, v := range args[1:] {
+		keys[i] = string(v)
 	}
+	return []string{dest}, keys
 }
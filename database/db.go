@@ -5,8 +5,18 @@ import (
 	"go-redis/interface/database"
 	"go-redis/interface/datastruct"
 	"go-redis/interface/resp"
+	"go-redis/lib/sync/lock"
 	"go-redis/resp/reply"
 	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// expireSweepInterval is the period of the active expiry sweeper
+	expireSweepInterval = time.Second
+	// lockerSize is the number of slots in the key lock table
+	lockerSize = 1024
 )
 
 /*----------子库----------*/
@@ -14,29 +24,100 @@ import (
 type DB struct {
 	index int
 	// key -> DataEntity
-	data   datastruct.Dict
-	addAof func(CmdLine)
+	data datastruct.Dict
+	// key -> expire time (time.Time)
+	ttlMap datastruct.Dict
+	// key -> version (uint64), used by WATCH
+	versionMap datastruct.Dict
+	// versionSeq generates version codes which are never reused
+	versionSeq *uint64
+	// key level locks, used for atomicity of commands and transactions
+	locker *lock.Locks
+	// addAof writes the given command lines into aof as a whole
+	addAof func(...CmdLine)
+	// getDB returns the db of given index, used to check keys watched in other dbs. nil if there are no other dbs
+	getDB func(int) *DB
+	// dirty counts commands changing data since the latest rdb save
+	dirty *int64
+	// snapshots are the running snapshots of rdb save and aof rewrite, nil if no snapshot is being dumped
+	snapshots *atomic.Pointer[[]*snapshot]
+	// closed to stop the expiry sweeper
+	stopSweep chan struct{}
 }
 
 // ExecFunc is interface for command executor
 // args don't include cmd line
 type ExecFunc func(db *DB, args [][]byte) resp.Reply
 
+// PreFunc analyses command line when queued command to `multi`
+// returns related write keys and read keys
+type PreFunc func(args [][]byte) ([]string, []string)
+
 // CmdLine is alias for [][]byte, represents a command line
 type CmdLine = [][]byte
 
 // makeDB create DB instance
 func makeDB() *DB {
 	db := &DB{
-		data:   dict.MakeSyncDict(),
-		addAof: func(line CmdLine) {},
+		data:       dict.MakeSyncDict(),
+		ttlMap:     dict.MakeSyncDict(),
+		versionMap: dict.MakeSyncDict(),
+		versionSeq: new(uint64),
+		locker:     lock.Make(lockerSize),
+		addAof:     func(lines ...CmdLine) {},
+		dirty:      new(int64),
+		snapshots:  &atomic.Pointer[[]*snapshot]{},
+		stopSweep:  make(chan struct{}),
 	}
+	go db.sweepExpired()
 	return db
 }
 
+// Close stops background jobs of db
+func (db *DB) Close() {
+	close(db.stopSweep)
+}
+
 // Exec executes command within one database
 func (db *DB) Exec(c resp.Connection, cmdLine [][]byte) resp.Reply {
 	//获取协议头
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	// 事务相关命令
+	switch cmdName {
+	case "multi":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return startMulti(c)
+	case "discard":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return discardMulti(c)
+	case "exec":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execMulti(db, c)
+	case "watch":
+		if len(cmdLine) < 2 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return watch(db, c, cmdLine[1:])
+	case "unwatch":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return unwatch(c)
+	}
+	if c != nil && c.InMultiState() {
+		return enqueueCmd(c, cmdLine)
+	}
+	return db.execNormalCommand(cmdLine)
+}
+
+// execNormalCommand executes a command out of transaction, holding locks of its keys
+func (db *DB) execNormalCommand(cmdLine [][]byte) resp.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	// 查表获取cmd结构体{执行函数，参数个数}
 	cmd, ok := cmdTable[cmdName]
@@ -46,8 +127,47 @@ func (db *DB) Exec(c resp.Connection, cmdLine [][]byte) resp.Reply {
 	if !validateArity(cmd.arity, cmdLine) {
 		return reply.MakeArgNumErrReply(cmdName)
 	}
-	cmdFunc := cmd.executor
-	return cmdFunc(db, cmdLine[1:])
+
+	writeKeys, readKeys := cmd.prepare(cmdLine[1:])
+	if lockAllCommands[cmdName] {
+		db.locker.LockAll()
+		defer db.locker.UnLockAll()
+	} else {
+		db.locker.RWLocks(writeKeys, readKeys)
+		defer db.locker.RWUnLocks(writeKeys, readKeys)
+	}
+	db.beforeWrite(writeKeys)
+	result := db.execCommand(cmd, cmdLine[1:])
+	db.addVersion(writeKeys...)
+	return result
+}
+
+// execCommand runs the executor of cmd, a command writing aof is counted as a change for rdb save rules
+func (db *DB) execCommand(cmd *command, args [][]byte) resp.Reply {
+	changed := false
+	execDB := *db
+	execDB.addAof = func(lines ...CmdLine) {
+		changed = true
+		db.addAof(lines...)
+	}
+	result := cmd.executor(&execDB, args)
+	if changed {
+		atomic.AddInt64(db.dirty, 1)
+	}
+	return result
+}
+
+// execWithLock executes a command while the caller already holds locks of its keys
+func (db *DB) execWithLock(cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	return db.execCommand(cmd, cmdLine[1:])
 }
 
 func validateArity(arity int, cmdArgs [][]byte) bool {
@@ -68,6 +188,11 @@ func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 	if !ok {
 		return nil, false
 	}
+	if db.IsExpired(key) {
+		// lazy expiry
+		db.removeExpired(key)
+		return nil, false
+	}
 	entity, _ := raw.(*database.DataEntity) // 空接口取出时需要显式转换为具体类型
 	return entity, true
 }
@@ -79,24 +204,27 @@ func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
 
 // PutIfExists edit an existing DataEntity
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
+	db.expireIfNeeded(key)
 	return db.data.PutIfExists(key, entity)
 }
 
 // PutIfAbsent insert an DataEntity only if the key not exists
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
+	db.expireIfNeeded(key)
 	return db.data.PutIfAbsent(key, entity)
 }
 
 // Remove the given key from db
 func (db *DB) Remove(key string) {
 	db.data.Remove(key)
+	db.ttlMap.Remove(key)
 }
 
 // Removes the given keys from db
 func (db *DB) Removes(keys ...string) int {
 	deleted := 0
 	for _, key := range keys {
-		_, exists := db.data.Get(key)
+		_, exists := db.GetEntity(key)
 		if exists {
 			db.Remove(key)
 			deleted++
@@ -105,8 +233,114 @@ func (db *DB) Removes(keys ...string) int {
 	return deleted
 }
 
+// ForEach traverses all the unexpired keys in db
+func (db *DB) ForEach(cb func(key string, entity *database.DataEntity, expiration *time.Time) bool) {
+	db.data.ForEach(func(key string, raw interface{}) bool {
+		if db.IsExpired(key) {
+			return true
+		}
+		entity, _ := raw.(*database.DataEntity)
+		var expiration *time.Time
+		if expireTime, ok := db.TTL(key); ok {
+			expiration = &expireTime
+		}
+		return cb(key, entity, expiration)
+	})
+}
+
 // Flush clean database
 func (db *DB) Flush() {
+	keys := db.data.Keys()
 	db.data.Clear()
+	db.ttlMap.Clear()
+	// every removed key is regarded as modified
+	db.addVersion(keys...)
+}
+
+/* ---- Version Functions ---- */
+
+// addVersion marks the given keys as modified
+func (db *DB) addVersion(keys ...string) {
+	for _, key := range keys {
+		db.versionMap.Put(key, atomic.AddUint64(db.versionSeq, 1))
+	}
+}
+
+// GetVersion returns version code of the given key, 0 means never modified
+func (db *DB) GetVersion(key string) uint64 {
+	raw, ok := db.versionMap.Get(key)
+	if !ok {
+		return 0
+	}
+	return raw.(uint64)
+}
+
+/* ---- TTL Functions ---- */
+
+// Expire sets the expire time of key
+func (db *DB) Expire(key string, expireTime time.Time) {
+	db.ttlMap.Put(key, expireTime)
+}
 
+// Persist cancels the expire time of key
+func (db *DB) Persist(key string) {
+	db.ttlMap.Remove(key)
+}
+
+// TTL returns the expire time of key, ok is false if the key has no ttl
+func (db *DB) TTL(key string) (expireTime time.Time, ok bool) {
+	raw, exists := db.ttlMap.Get(key)
+	if !exists {
+		return time.Time{}, false
+	}
+	return raw.(time.Time), true
+}
+
+// IsExpired check whether a key is expired
+func (db *DB) IsExpired(key string) bool {
+	expireTime, ok := db.TTL(key)
+	if !ok {
+		return false
+	}
+	return time.Now().After(expireTime)
+}
+
+// expireIfNeeded removes the key if it is expired
+func (db *DB) expireIfNeeded(key string) {
+	if db.IsExpired(key) {
+		db.removeExpired(key)
+	}
+}
+
+// removeExpired removes an expired key, WATCH regards it as modified
+func (db *DB) removeExpired(key string) {
+	db.Remove(key)
+	db.addVersion(key)
+}
+
+// sweepExpired periodically removes expired keys which are never accessed again
+func (db *DB) sweepExpired() {
+	ticker := time.NewTicker(expireSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.stopSweep:
+			return
+		case <-ticker.C:
+			expired := make([]string, 0)
+			now := time.Now()
+			db.ttlMap.ForEach(func(key string, val interface{}) bool {
+				if now.After(val.(time.Time)) {
+					expired = append(expired, key)
+				}
+				return true
+			})
+			for _, key := range expired {
+				// the key may be rewritten concurrently, so check it again while holding its lock
+				db.locker.Lock(key)
+				db.expireIfNeeded(key)
+				db.locker.UnLock(key)
+			}
+		}
+	}
 }
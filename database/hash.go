@@ -0,0 +1,391 @@
+package database
+
+import (
+	Dict "go-redis/datastruct/dict"
+	"go-redis/interface/database"
+	"go-redis/interface/datastruct"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"math"
+	"strconv"
+)
+
+// 把val断言为hash
+func (db *DB) getAsDict(key string) (datastruct.Dict, resp.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	dict, ok := entity.Data.(datastruct.Dict)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return dict, nil
+}
+
+func (db *DB) getOrInitDict(key string) (dict datastruct.Dict, inited bool, errReply resp.ErrorReply) {
+	dict, errReply = db.getAsDict(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if dict == nil {
+		dict = Dict.MakeSimpleDict()
+		db.PutEntity(key, &database.DataEntity{
+			Data: dict,
+		})
+		inited = true
+	}
+	return dict, inited, nil
+}
+
+// execHSet sets field in hash table
+// HSET key field value [field value ...]
+func execHSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hset")
+	}
+	key := string(args[0])
+
+	dict, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	result := 0
+	for i := 1; i < len(args); i += 2 {
+		result += dict.Put(string(args[i]), args[i+1])
+	}
+	db.addAof(utils.ToCmdLine2("hset", args...))
+	return reply.MakeIntReply(int64(result))
+}
+
+// execHMSet sets multi fields in hash table
+func execHMSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hmset")
+	}
+	key := string(args[0])
+
+	dict, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	for i := 1; i < len(args); i += 2 {
+		dict.Put(string(args[i]), args[i+1])
+	}
+	db.addAof(utils.ToCmdLine2("hmset", args...))
+	return &reply.OKReply{}
+}
+
+// execHSetNX sets field in hash table only if field not exists
+func execHSetNX(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	value := args[2]
+
+	dict, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	result := dict.PutIfAbsent(field, value)
+	if result > 0 {
+		db.addAof(utils.ToCmdLine2("hsetnx", args...))
+	}
+	return reply.MakeIntReply(int64(result))
+}
+
+// execHGet gets field value of hash table
+func execHGet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return &reply.NullBulkReply{}
+	}
+
+	raw, exists := dict.Get(field)
+	if !exists {
+		return &reply.NullBulkReply{}
+	}
+	value, _ := raw.([]byte)
+	return reply.MakeBulkReply(value)
+}
+
+// execHExists checks if a hash field exists
+func execHExists(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	_, exists := dict.Get(field)
+	if exists {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// execHDel deletes a hash field
+func execHDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	fields := make([]string, len(args)-1)
+	fieldArgs := args[1:]
+	for i, v := range fieldArgs {
+		fields[i] = string(v)
+	}
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	deleted := 0
+	for _, field := range fields {
+		result := dict.Remove(field)
+		deleted += result
+	}
+	if dict.Len() == 0 {
+		db.Remove(key)
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine2("hdel", args...))
+	}
+
+	return reply.MakeIntReply(int64(deleted))
+}
+
+// execHLen gets number of fields in hash table
+func execHLen(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(dict.Len()))
+}
+
+// execHStrlen returns the string length of the value associated with field in the hash stored at key
+func execHStrlen(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	raw, exists := dict.Get(field)
+	if exists {
+		value, _ := raw.([]byte)
+		return reply.MakeIntReply(int64(len(value)))
+	}
+	return reply.MakeIntReply(0)
+}
+
+// execHMGet gets multi fields in hash table
+func execHMGet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	size := len(args) - 1
+	fields := make([]string, size)
+	for i := 0; i < size; i++ {
+		fields[i] = string(args[i+1])
+	}
+
+	result := make([][]byte, size)
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return reply.MakeMultiBulkReply(result)
+	}
+
+	for i, field := range fields {
+		value, ok := dict.Get(field)
+		if !ok {
+			result[i] = nil
+		} else {
+			bytes, _ := value.([]byte)
+			result[i] = bytes
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execHKeys gets all field names in hash table
+func execHKeys(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	fields := make([][]byte, dict.Len())
+	i := 0
+	dict.ForEach(func(key string, val interface{}) bool {
+		fields[i] = []byte(key)
+		i++
+		return true
+	})
+	return reply.MakeMultiBulkReply(fields[:i])
+}
+
+// execHVals gets all field value in hash table
+func execHVals(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	values := make([][]byte, dict.Len())
+	i := 0
+	dict.ForEach(func(key string, val interface{}) bool {
+		values[i], _ = val.([]byte)
+		i++
+		return true
+	})
+	return reply.MakeMultiBulkReply(values[:i])
+}
+
+// execHGetAll gets all key-value entries in hash table
+func execHGetAll(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return reply.MakeMapReply(nil, nil)
+	}
+
+	size := dict.Len()
+	fields := make([]resp.Reply, 0, size)
+	values := make([]resp.Reply, 0, size)
+	dict.ForEach(func(key string, val interface{}) bool {
+		value, _ := val.([]byte)
+		fields = append(fields, reply.MakeBulkReply([]byte(key)))
+		values = append(values, reply.MakeBulkReply(value))
+		return true
+	})
+	return reply.MakeMapReply(fields, values)
+}
+
+// execHIncrBy increments the integer value of a hash field by the given number
+func execHIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	rawDelta := string(args[2])
+	delta, err := strconv.ParseInt(rawDelta, 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	dict, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	value, exists := dict.Get(field)
+	if !exists {
+		// store the canonical form, such as "5" for "+5" or "05"
+		dict.Put(field, []byte(strconv.FormatInt(delta, 10)))
+		db.addAof(utils.ToCmdLine2("hincrby", args...))
+		return reply.MakeIntReply(delta)
+	}
+	val, err := strconv.ParseInt(string(value.([]byte)), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR hash value is not an integer")
+	}
+	if (delta > 0 && val > math.MaxInt64-delta) || (delta < 0 && val < math.MinInt64-delta) {
+		return reply.MakeErrReply("ERR increment or decrement would overflow")
+	}
+	val += delta
+	dict.Put(field, []byte(strconv.FormatInt(val, 10)))
+	db.addAof(utils.ToCmdLine2("hincrby", args...))
+	return reply.MakeIntReply(val)
+}
+
+// execHIncrByFloat increments the float value of a hash field by the given number
+func execHIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	rawDelta := string(args[2])
+	delta, err := strconv.ParseFloat(rawDelta, 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return reply.MakeErrReply("ERR value is not a valid float")
+	}
+
+	dict, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	val := float64(0)
+	value, exists := dict.Get(field)
+	if exists {
+		val, err = strconv.ParseFloat(string(value.([]byte)), 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR hash value is not a float")
+		}
+	}
+	sum := val + delta
+	if math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return reply.MakeErrReply("ERR increment would produce NaN or Infinity")
+	}
+	result := []byte(strconv.FormatFloat(sum, 'f', -1, 64))
+	dict.Put(field, result)
+	// log the result rather than the delta, so that reloading won't accumulate float errors
+	db.addAof(utils.ToCmdLine2("hset", args[0], args[1], result))
+	return reply.MakeBulkReply(result)
+}
+
+func init() {
+	RegisterCommand("HSet", execHSet, writeFirstKey, -4, "hash", "write")
+	RegisterCommand("HMSet", execHMSet, writeFirstKey, -4, "hash", "write")
+	RegisterCommand("HSetNX", execHSetNX, writeFirstKey, 4, "hash", "write")
+	RegisterCommand("HGet", execHGet, readFirstKey, 3, "hash", "read")
+	RegisterCommand("HExists", execHExists, readFirstKey, 3, "hash", "read")
+	RegisterCommand("HDel", execHDel, writeFirstKey, -3, "hash", "write")
+	RegisterCommand("HLen", execHLen, readFirstKey, 2, "hash", "read")
+	RegisterCommand("HStrlen", execHStrlen, readFirstKey, 3, "hash", "read")
+	RegisterCommand("HMGet", execHMGet, readFirstKey, -3, "hash", "read")
+	RegisterCommand("HKeys", execHKeys, readFirstKey, 2, "hash", "read")
+	RegisterCommand("HVals", execHVals, readFirstKey, 2, "hash", "read")
+	RegisterCommand("HGetAll", execHGetAll, readFirstKey, 2, "hash", "read")
+	RegisterCommand("HIncrBy", execHIncrBy, writeFirstKey, 4, "hash", "write")
+	RegisterCommand("HIncrByFloat", execHIncrByFloat, writeFirstKey, 4, "hash", "write")
+}
@@ -1,10 +1,17 @@
 package database
 
 import (
+	List "go-redis/datastruct/list"
+	HashSet "go-redis/datastruct/set"
+	SortedSet "go-redis/datastruct/sortedset"
+	"go-redis/interface/datastruct"
 	"go-redis/interface/resp"
 	"go-redis/lib/utils"
 	"go-redis/lib/wildcard"
 	"go-redis/resp/reply"
+	"math"
+	"strconv"
+	"time"
 )
 
 // execDel removes a key from db
@@ -50,10 +57,25 @@ func execType(db *DB, args [][]byte) resp.Reply {
 	switch entity.Data.(type) {
 	case []byte:
 		return reply.MakeStatusReply("string")
+	case *List.QuickList:
+		return reply.MakeStatusReply("list")
+	case datastruct.Dict:
+		return reply.MakeStatusReply("hash")
+	case *HashSet.Set:
+		return reply.MakeStatusReply("set")
+	case *SortedSet.SortedSet:
+		return reply.MakeStatusReply("zset")
 	}
 	return &reply.UnknownErrReply{}
 }
 
+// prepareRename locks both source and destination keys
+func prepareRename(args [][]byte) ([]string, []string) {
+	src := string(args[0])
+	dest := string(args[1])
+	return []string{src, dest}, nil
+}
+
 // execRename a key
 func execRename(db *DB, args [][]byte) resp.Reply {
 	if len(args) != 2 {
@@ -66,8 +88,12 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	if !ok {
 		return reply.MakeErrReply("no such key")
 	}
+	expireTime, hasTTL := db.TTL(src)
+	db.Removes(src, dest) // clean src and dest with their ttl
 	db.PutEntity(dest, entity)
-	db.Remove(src)
+	if hasTTL {
+		db.Expire(dest, expireTime)
+	}
 	db.addAof(utils.ToCmdLine2("rename", args...))
 	return reply.MakeOKReply()
 }
@@ -86,8 +112,12 @@ func execRenameNx(db *DB, args [][]byte) resp.Reply {
 	if !ok {
 		return reply.MakeErrReply("no such key")
 	}
+	expireTime, hasTTL := db.TTL(src)
 	db.Removes(src, dest) // clean src and dest with their ttl
 	db.PutEntity(dest, entity)
+	if hasTTL {
+		db.Expire(dest, expireTime)
+	}
 	db.addAof(utils.ToCmdLine2("renamenx", args...))
 	return reply.MakeIntReply(1)
 }
@@ -97,7 +127,7 @@ func execKeys(db *DB, args [][]byte) resp.Reply {
 	pattern := wildcard.CompilePattern(string(args[0]))
 	result := make([][]byte, 0)
 	db.data.ForEach(func(key string, val interface{}) bool {
-		if pattern.IsMatch(key) {
+		if pattern.IsMatch(key) && !db.IsExpired(key) {
 			result = append(result, []byte(key))
 		}
 		return true
@@ -105,12 +135,162 @@ func execKeys(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeMultiBulkReply(result)
 }
 
+// toExpireAtCmd makes a pexpireat command line which records an absolute expire time
+func toExpireAtCmd(key string, expireTime time.Time) CmdLine {
+	return utils.ToCmdLine("pexpireat", key, strconv.FormatInt(expireTime.UnixMilli(), 10))
+}
+
+// expireAt sets the expire time of an existing key, a time in the past removes the key
+func expireAt(db *DB, key string, expireTime time.Time) resp.Reply {
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	if !expireTime.After(time.Now()) {
+		db.Remove(key)
+		db.addAof(utils.ToCmdLine("del", key))
+		return reply.MakeIntReply(1)
+	}
+	db.Expire(key, expireTime)
+	db.addAof(toExpireAtCmd(key, expireTime))
+	return reply.MakeIntReply(1)
+}
+
+// parseExpireArg parses a integer argument of expire family commands
+func parseExpireArg(arg []byte) (int64, resp.Reply) {
+	val, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return val, nil
+}
+
+// makeExpireTime converts the argument of expire family commands to the expiration time.
+// unit is the number of milliseconds of the argument, it's relative to now if relative is true.
+// Like redis, the argument is invalid if the unix time in milliseconds overflows
+func makeExpireTime(cmdName string, when int64, unit int64, relative bool) (time.Time, resp.Reply) {
+	errReply := reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	if when > math.MaxInt64/unit || when < math.MinInt64/unit {
+		return time.Time{}, errReply
+	}
+	when *= unit
+	if relative {
+		now := time.Now().UnixMilli()
+		if (when > 0 && now > math.MaxInt64-when) || (when < 0 && now < math.MinInt64-when) {
+			return time.Time{}, errReply
+		}
+		when += now
+	}
+	return time.UnixMilli(when), nil
+}
+
+// execExpire sets a key's time to live in seconds
+func execExpire(db *DB, args [][]byte) resp.Reply {
+	ttl, errReply := parseExpireArg(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	expireTime, errReply := makeExpireTime("expire", ttl, 1000, true)
+	if errReply != nil {
+		return errReply
+	}
+	return expireAt(db, string(args[0]), expireTime)
+}
+
+// execPExpire sets a key's time to live in milliseconds
+func execPExpire(db *DB, args [][]byte) resp.Reply {
+	ttl, errReply := parseExpireArg(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	expireTime, errReply := makeExpireTime("pexpire", ttl, 1, true)
+	if errReply != nil {
+		return errReply
+	}
+	return expireAt(db, string(args[0]), expireTime)
+}
+
+// execExpireAt sets the expiration for a key as a UNIX timestamp in seconds
+func execExpireAt(db *DB, args [][]byte) resp.Reply {
+	raw, errReply := parseExpireArg(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	expireTime, errReply := makeExpireTime("expireat", raw, 1000, false)
+	if errReply != nil {
+		return errReply
+	}
+	return expireAt(db, string(args[0]), expireTime)
+}
+
+// execPExpireAt sets the expiration for a key as a UNIX timestamp in milliseconds
+func execPExpireAt(db *DB, args [][]byte) resp.Reply {
+	raw, errReply := parseExpireArg(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	return expireAt(db, string(args[0]), time.UnixMilli(raw))
+}
+
+// execTTL returns a key's remaining time to live in seconds
+func execTTL(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(-2)
+	}
+	expireTime, ok := db.TTL(key)
+	if !ok {
+		return reply.MakeIntReply(-1)
+	}
+	// computed in milliseconds, the expiration may be too far for time.Duration
+	ttl := expireTime.UnixMilli() - time.Now().UnixMilli()
+	return reply.MakeIntReply((ttl + 500) / 1000)
+}
+
+// execPTTL returns a key's remaining time to live in milliseconds
+func execPTTL(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(-2)
+	}
+	expireTime, ok := db.TTL(key)
+	if !ok {
+		return reply.MakeIntReply(-1)
+	}
+	return reply.MakeIntReply(expireTime.UnixMilli() - time.Now().UnixMilli())
+}
+
+// execPersist removes expiration from a key
+func execPersist(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	_, ok := db.TTL(key)
+	if !ok {
+		return reply.MakeIntReply(0)
+	}
+	db.Persist(key)
+	db.addAof(utils.ToCmdLine2("persist", args...))
+	return reply.MakeIntReply(1)
+}
+
 func init() {
-	RegisterCommand("Del", execDel, -2)
-	RegisterCommand("Exists", execExists, -2)
-	RegisterCommand("Keys", execKeys, 2)
-	RegisterCommand("FlushDB", execFlushDB, -1)
-	RegisterCommand("Type", execType, 2)
-	RegisterCommand("Rename", execRename, 3)
-	RegisterCommand("RenameNx", execRenameNx, 3)
+	RegisterCommand("Del", execDel, writeAllKeys, -2, "keyspace", "write")
+	RegisterCommand("Exists", execExists, readAllKeys, -2, "keyspace", "read")
+	RegisterCommand("Keys", execKeys, noPrepare, 2, "keyspace", "read", "dangerous")
+	RegisterCommand("FlushDB", execFlushDB, noPrepare, -1, "keyspace", "write", "dangerous")
+	RegisterCommand("Type", execType, readFirstKey, 2, "keyspace", "read")
+	RegisterCommand("Rename", execRename, prepareRename, 3, "keyspace", "write")
+	RegisterCommand("RenameNx", execRenameNx, prepareRename, 3, "keyspace", "write")
+	RegisterCommand("Expire", execExpire, writeFirstKey, 3, "keyspace", "write")
+	RegisterCommand("PExpire", execPExpire, writeFirstKey, 3, "keyspace", "write")
+	RegisterCommand("ExpireAt", execExpireAt, writeFirstKey, 3, "keyspace", "write")
+	RegisterCommand("PExpireAt", execPExpireAt, writeFirstKey, 3, "keyspace", "write")
+	RegisterCommand("TTL", execTTL, readFirstKey, 2, "keyspace", "read")
+	RegisterCommand("PTTL", execPTTL, readFirstKey, 2, "keyspace", "read")
+	RegisterCommand("Persist", execPersist, writeFirstKey, 2, "keyspace", "write")
 }
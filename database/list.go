@@ -0,0 +1,462 @@
+package database
+
+import (
+	List "go-redis/datastruct/list"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// 把val断言为list
+func (db *DB) getAsList(key string) (*List.QuickList, resp.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	list, ok := entity.Data.(*List.QuickList)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return list, nil
+}
+
+func (db *DB) getOrInitList(key string) (list *List.QuickList, isNew bool, errReply resp.ErrorReply) {
+	list, errReply = db.getAsList(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	isNew = false
+	if list == nil {
+		list = List.MakeQuickList()
+		db.PutEntity(key, &database.DataEntity{
+			Data: list,
+		})
+		isNew = true
+	}
+	return list, isNew, nil
+}
+
+// normalizeRange converts redis style [start, stop] (negative index allowed) into [start, stop)
+// ok is false if the range is empty
+func normalizeRange(start int64, stop int64, size int64) (int, int, bool) {
+	if start < 0 {
+		start = size + start
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop < 0 {
+		stop = size + stop
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start >= size || start > stop {
+		return 0, 0, false
+	}
+	return int(start), int(stop) + 1, true
+}
+
+// execLIndex gets element of list at given list
+func execLIndex(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	key := string(args[0])
+	index64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	index := int(index64)
+
+	// get entity
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &reply.NullBulkReply{}
+	}
+
+	size := list.Len() // assert: size > 0
+	if index < -1*size {
+		return &reply.NullBulkReply{}
+	} else if index < 0 {
+		index = size + index
+	} else if index >= size {
+		return &reply.NullBulkReply{}
+	}
+
+	val, _ := list.Get(index).([]byte)
+	return reply.MakeBulkReply(val)
+}
+
+// execLLen gets length of list
+func execLLen(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	size := int64(list.Len())
+	return reply.MakeIntReply(size)
+}
+
+// popList removes count elements from head or tail of list, returns nil if the key does not exist
+func popList(db *DB, args [][]byte, cmdName string, fromHead bool) resp.Reply {
+	key := string(args[0])
+	count := 1
+	withCount := len(args) == 2
+	if withCount {
+		count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count64 < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(count64)
+	} else if len(args) > 2 {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		if withCount {
+			// like redis, null array rather than empty array
+			return reply.MakeNullMultiBulkReply()
+		}
+		return &reply.NullBulkReply{}
+	}
+
+	if count > list.Len() {
+		count = list.Len()
+	}
+	popped := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		var val interface{}
+		if fromHead {
+			val = list.Remove(0)
+		} else {
+			val = list.RemoveLast()
+		}
+		popped = append(popped, val.([]byte))
+	}
+	if list.Len() == 0 {
+		db.Remove(key)
+	}
+	if count > 0 {
+		db.addAof(utils.ToCmdLine2(cmdName, args...))
+	}
+	if withCount {
+		return reply.MakeMultiBulkReply(popped)
+	}
+	return reply.MakeBulkReply(popped[0])
+}
+
+// execLPop removes the first element of list, and return it
+func execLPop(db *DB, args [][]byte) resp.Reply {
+	return popList(db, args, "lpop", true)
+}
+
+// execRPop removes last element of list then return it
+func execRPop(db *DB, args [][]byte) resp.Reply {
+	return popList(db, args, "rpop", false)
+}
+
+// execLPush inserts element at head of list
+func execLPush(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	// get or init entity
+	list, _, errReply := db.getOrInitList(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	// insert
+	for _, value := range values {
+		list.Insert(0, value)
+	}
+
+	db.addAof(utils.ToCmdLine2("lpush", args...))
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execLPushX inserts element at head of list, only if list exists
+func execLPushX(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	// get or init entity
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	// insert
+	for _, value := range values {
+		list.Insert(0, value)
+	}
+	db.addAof(utils.ToCmdLine2("lpushx", args...))
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execRPush inserts element at last of list
+func execRPush(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	key := string(args[0])
+	values := args[1:]
+
+	// get or init entity
+	list, _, errReply := db.getOrInitList(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	// put list
+	for _, value := range values {
+		list.Add(value)
+	}
+	db.addAof(utils.ToCmdLine2("rpush", args...))
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execRPushX inserts element at last of list only if list exists
+func execRPushX(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	// get or init entity
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	// put list
+	for _, value := range values {
+		list.Add(value)
+	}
+	db.addAof(utils.ToCmdLine2("rpushx", args...))
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execLRange gets elements of list in given range
+func execLRange(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	key := string(args[0])
+	start64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	stop64, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	// get data
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	start, stop, ok := normalizeRange(start64, stop64, int64(list.Len()))
+	if !ok {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	// assert: start in [0, size - 1], stop in [start, size]
+	slice := list.Range(start, stop)
+	result := make([][]byte, len(slice))
+	for i, raw := range slice {
+		bytes, _ := raw.([]byte)
+		result[i] = bytes
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execLRem removes element of list at specified index
+func execLRem(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	key := string(args[0])
+	count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	count := int(count64)
+	value := args[2]
+
+	// get data entity
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	var removed int
+	if count == 0 {
+		removed = list.RemoveAllByVal(func(a interface{}) bool {
+			return utils.Equals(a, value)
+		})
+	} else if count > 0 {
+		removed = list.RemoveByVal(func(a interface{}) bool {
+			return utils.Equals(a, value)
+		}, count)
+	} else {
+		removed = list.ReverseRemoveByVal(func(a interface{}) bool {
+			return utils.Equals(a, value)
+		}, -count)
+	}
+
+	if list.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2("lrem", args...))
+	}
+
+	return reply.MakeIntReply(int64(removed))
+}
+
+// execLSet puts element at specified index of list
+func execLSet(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	key := string(args[0])
+	index64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	index := int(index64)
+	value := args[2]
+
+	// get data
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeErrReply("ERR no such key")
+	}
+
+	size := list.Len() // assert: size > 0
+	if index < -1*size {
+		return reply.MakeErrReply("ERR index out of range")
+	} else if index < 0 {
+		index = size + index
+	} else if index >= size {
+		return reply.MakeErrReply("ERR index out of range")
+	}
+
+	list.Set(index, value)
+	db.addAof(utils.ToCmdLine2("lset", args...))
+	return &reply.OKReply{}
+}
+
+// execLTrim trims a list so that it will contain only the specified range of elements
+func execLTrim(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	key := string(args[0])
+	start64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	stop64, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &reply.OKReply{}
+	}
+
+	start, stop, ok := normalizeRange(start64, stop64, int64(list.Len()))
+	if !ok {
+		db.Remove(key)
+		db.addAof(utils.ToCmdLine2("ltrim", args...))
+		return &reply.OKReply{}
+	}
+	// remove tail first, so that index of head elements won't change
+	for list.Len() > stop {
+		list.RemoveLast()
+	}
+	for i := 0; i < start; i++ {
+		list.Remove(0)
+	}
+	db.addAof(utils.ToCmdLine2("ltrim", args...))
+	return &reply.OKReply{}
+}
+
+// execLInsert inserts element before or after the pivot element
+func execLInsert(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	where := strings.ToUpper(string(args[1]))
+	if where != "BEFORE" && where != "AFTER" {
+		return &reply.SyntaxErrReply{}
+	}
+	pivot := args[2]
+	value := args[3]
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	pivotIndex := -1
+	list.ForEach(func(i int, v interface{}) bool {
+		if utils.Equals(v, pivot) {
+			pivotIndex = i
+			return false
+		}
+		return true
+	})
+	if pivotIndex < 0 {
+		return reply.MakeIntReply(-1)
+	}
+	if where == "AFTER" {
+		pivotIndex++
+	}
+	list.Insert(pivotIndex, value)
+	db.addAof(utils.ToCmdLine2("linsert", args...))
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+func init() {
+	RegisterCommand("LPush", execLPush, writeFirstKey, -3, "list", "write")
+	RegisterCommand("LPushX", execLPushX, writeFirstKey, -3, "list", "write")
+	RegisterCommand("RPush", execRPush, writeFirstKey, -3, "list", "write")
+	RegisterCommand("RPushX", execRPushX, writeFirstKey, -3, "list", "write")
+	RegisterCommand("LPop", execLPop, writeFirstKey, -2, "list", "write")
+	RegisterCommand("RPop", execRPop, writeFirstKey, -2, "list", "write")
+	RegisterCommand("LRem", execLRem, writeFirstKey, 4, "list", "write")
+	RegisterCommand("LLen", execLLen, readFirstKey, 2, "list", "read")
+	RegisterCommand("LIndex", execLIndex, readFirstKey, 3, "list", "read")
+	RegisterCommand("LSet", execLSet, writeFirstKey, 4, "list", "write")
+	RegisterCommand("LRange", execLRange, readFirstKey, 4, "list", "read")
+	RegisterCommand("LTrim", execLTrim, writeFirstKey, 4, "list", "write")
+	RegisterCommand("LInsert", execLInsert, writeFirstKey, 5, "list", "write")
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"testing"
+)
+
+func TestPopList(t *testing.T) {
+	db := makeDB()
+	defer db.Close()
+	db.Exec(nil, utils.ToCmdLine("RPUSH", "list", "a", "b", "c"))
+
+	tests := []struct {
+		cmdLine []string
+		resp2   string
+		resp3   string
+	}{
+		{[]string{"LPOP", "missing"}, "$-1\r\n", "_\r\n"},
+		{[]string{"LPOP", "missing", "2"}, "*-1\r\n", "_\r\n"},
+		{[]string{"RPOP", "missing", "0"}, "*-1\r\n", "_\r\n"},
+		{[]string{"LPOP", "list", "0"}, "*0\r\n", "*0\r\n"},
+		{[]string{"LPOP", "list"}, "$1\r\na\r\n", "$1\r\na\r\n"},
+		{[]string{"RPOP", "list", "5"}, "*2\r\n$1\r\nc\r\n$1\r\nb\r\n", "*2\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		// the key is removed after the last element is popped
+		{[]string{"RPOP", "list", "1"}, "*-1\r\n", "_\r\n"},
+		{[]string{"LPOP", "list", "-1"}, "-ERR value is out of range, must be positive\r\n",
+			"-ERR value is out of range, must be positive\r\n"},
+	}
+	for _, tt := range tests {
+		result := db.Exec(nil, utils.ToCmdLine(tt.cmdLine...))
+		if actual := string(reply.Encode(result, resp.Resp2)); actual != tt.resp2 {
+			t.Errorf("%v: expected %q, actually %q", tt.cmdLine, tt.resp2, actual)
+		}
+		if actual := string(reply.Encode(result, resp.Resp3)); actual != tt.resp3 {
+			t.Errorf("%v with RESP3: expected %q, actually %q", tt.cmdLine, tt.resp3, actual)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"go-redis/aof"
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/rdb"
+	"go-redis/resp/reply"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultDbFilename = "dump.rdb"
+	// saveCronInterval is the period of checking save rules
+	saveCronInterval = time.Second
+	// saveRetryDelay is the minimum interval of retrying a failed auto save
+	saveRetryDelay = 5 * time.Second
+	// shutdownSaveWait is the interval of checking whether the background saving is finished before shutdown
+	shutdownSaveWait = 10 * time.Millisecond
+)
+
+// saveRule triggers BGSAVE if there are at least `changes` changes in `seconds` seconds
+type saveRule struct {
+	seconds int64
+	changes int64
+}
+
+// parseSaveRules parses save rules like "900 1 300 10"
+func parseSaveRules(value string) ([]saveRule, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 1 && fields[0] == `""` {
+		return nil, nil
+	}
+	if len(fields)%2 != 0 {
+		return nil, errors.New("save rules must be pairs of <seconds> <changes>")
+	}
+	rules := make([]saveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil || seconds <= 0 {
+			return nil, errors.New("invalid save seconds: " + fields[i])
+		}
+		changes, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil || changes < 0 {
+			return nil, errors.New("invalid save changes: " + fields[i+1])
+		}
+		rules = append(rules, saveRule{seconds: seconds, changes: changes})
+	}
+	return rules, nil
+}
+
+func rdbFilename() string {
+	if config.Properties.DbFilename == "" {
+		return defaultDbFilename
+	}
+	return config.Properties.DbFilename
+}
+
+// dirty returns the number of changes since the latest save
+func (mdb *StandaloneDatabase) dirty() int64 {
+	var sum int64
+	for _, db := range mdb.dbSet {
+		sum += atomic.LoadInt64(db.dirty)
+	}
+	return sum
+}
+
+// saveRDB dumps the snapshot into rdb file, writes are not blocked meanwhile
+func (mdb *StandaloneDatabase) saveRDB(snap *snapshot) error {
+	defer mdb.releaseSnapshot(snap)
+
+	filename := rdbFilename()
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// remove the temp file if it's not renamed
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}()
+	if err := writeSnapshot(tmpFile, snap); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), filename); err != nil {
+		return err
+	}
+	for i, db := range mdb.dbSet {
+		atomic.AddInt64(db.dirty, -snap.dirties[i])
+	}
+	mdb.lastSave.Store(time.Now().Unix())
+	return nil
+}
+
+func writeSnapshot(file *os.File, snap *snapshot) error {
+	encoder := rdb.NewEncoder(file)
+	if err := encoder.WriteHeader(); err != nil {
+		return err
+	}
+	if err := encoder.WriteAuxFields(false); err != nil {
+		return err
+	}
+	// sizes of databases for RESIZEDB
+	keyCounts, ttlCounts := snap.sizes()
+	dbIndex := -1
+	for _, entry := range snap.entries {
+		obj := entry.get()
+		if obj.DB != dbIndex {
+			if err := encoder.WriteDBHeader(obj.DB, keyCounts[obj.DB], ttlCounts[obj.DB]); err != nil {
+				return err
+			}
+			dbIndex = obj.DB
+		}
+		if err := encoder.WriteObject(obj); err != nil {
+			return err
+		}
+	}
+	return encoder.WriteEnd()
+}
+
+// loadRDB loads the rdb file into databases at startup, a missing file is regarded as empty
+func (mdb *StandaloneDatabase) loadRDB() error {
+	err := mdb.ImportRDB(rdbFilename())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ImportRDB loads a rdb file into databases, such as a dump.rdb of redis.
+// Existing keys are overwritten, the imported keys are written into aof if it's enabled
+func (mdb *StandaloneDatabase) ImportRDB(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	now := time.Now()
+	decoder := rdb.NewDecoder(file)
+	return decoder.Parse(func(o *rdb.Object) bool {
+		if o.DB >= len(mdb.dbSet) {
+			logger.Warn(fmt.Sprintf("db index %d is out of range, key %s skipped", o.DB, o.Key))
+			return true
+		}
+		if o.Expiration != nil && o.Expiration.Before(now) {
+			return true
+		}
+		mdb.dbSet[o.DB].importObject(o)
+		return true
+	})
+}
+
+// ImportDump loads a rdb file into the databases configured by config.Properties and persists the result,
+// by aof if it's enabled, otherwise by saving the rdb file of dbfilename. It's used to seed the server offline
+func ImportDump(filename string) error {
+	mdb := NewStandaloneDatabase()
+	defer mdb.Close()
+	if err := mdb.ImportRDB(filename); err != nil {
+		return err
+	}
+	if mdb.aofHandler != nil {
+		// imported keys are queued into aof, they are written when it's closed
+		return nil
+	}
+	return mdb.saveRDB(mdb.takeSnapshot())
+}
+
+// importObject puts the rdb object into db
+func (db *DB) importObject(o *rdb.Object) {
+	db.locker.Lock(o.Key)
+	defer db.locker.UnLock(o.Key)
+	db.beforeWrite([]string{o.Key})
+	entity := rdb.ObjectToEntity(o)
+	db.PutEntity(o.Key, entity)
+	lines := aof.ObjectToCmds(o)
+	if o.Expiration != nil {
+		db.Expire(o.Key, *o.Expiration)
+	} else {
+		db.Persist(o.Key)
+	}
+	db.addVersion(o.Key)
+	db.addAof(lines...)
+	atomic.AddInt64(db.dirty, 1)
+}
+
+// execSave saves databases synchronously
+func (mdb *StandaloneDatabase) execSave() resp.Reply {
+	if !mdb.saving.CompareAndSwap(false, true) {
+		return reply.MakeErrReply("ERR Background save already in progress")
+	}
+	defer mdb.saving.Store(false)
+	if err := mdb.saveRDB(mdb.takeSnapshot()); err != nil {
+		logger.Error("saving failed: " + err.Error())
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+	return reply.MakeOKReply()
+}
+
+// execBgSave saves databases in background
+func (mdb *StandaloneDatabase) execBgSave() resp.Reply {
+	if !mdb.bgSave() {
+		return reply.MakeErrReply("ERR Background save already in progress")
+	}
+	return reply.MakeStatusReply("Background saving started")
+}
+
+// bgSave starts saving in background, returns false if another saving is in progress
+func (mdb *StandaloneDatabase) bgSave() bool {
+	if !mdb.saving.CompareAndSwap(false, true) {
+		return false
+	}
+	mdb.lastSaveTry.Store(time.Now().Unix())
+	// the snapshot is taken before returning, so the dump doesn't contain later writes
+	snap := mdb.takeSnapshot()
+	go func() {
+		defer mdb.saving.Store(false)
+		if err := mdb.saveRDB(snap); err != nil {
+			mdb.lastSaveFailed.Store(true)
+			logger.Error("background saving failed: " + err.Error())
+			return
+		}
+		mdb.lastSaveFailed.Store(false)
+		logger.Info("background saving terminated with success")
+	}()
+	return true
+}
+
+// execLastSave returns the unix time of the latest successful save
+func (mdb *StandaloneDatabase) execLastSave() resp.Reply {
+	return reply.MakeIntReply(mdb.lastSave.Load())
+}
+
+// saveCron starts BGSAVE when any of the save rules is satisfied
+func (mdb *StandaloneDatabase) saveCron(rules []saveRule) {
+	ticker := time.NewTicker(saveCronInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mdb.stopCron:
+			return
+		case <-ticker.C:
+			if mdb.saving.Load() {
+				continue
+			}
+			now := time.Now().Unix()
+			if mdb.lastSaveFailed.Load() && now-mdb.lastSaveTry.Load() < int64(saveRetryDelay/time.Second) {
+				continue
+			}
+			dirty := mdb.dirty()
+			elapsed := now - mdb.lastSave.Load()
+			for _, rule := range rules {
+				if dirty >= rule.changes && dirty > 0 && elapsed >= rule.seconds {
+					logger.Info(fmt.Sprintf("%d changes in %d seconds. Saving...", rule.changes, rule.seconds))
+					mdb.bgSave()
+					break
+				}
+			}
+		}
+	}
+}
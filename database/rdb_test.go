@@ -0,0 +1,253 @@
+package database
+
+import (
+	"go-redis/config"
+	"go-redis/lib/utils"
+	"go-redis/rdb"
+	"go-redis/resp/reply"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupRDBConfig puts data files in a temporary directory, save rules are disabled by default
+func setupRDBConfig(t *testing.T, appendOnly bool) {
+	dir := t.TempDir()
+	backup := config.Properties
+	config.Properties = config.DefaultProperties()
+	config.Properties.DbFilename = filepath.Join(dir, "dump.rdb")
+	config.Properties.AppendOnly = appendOnly
+	config.Properties.AppendFilename = filepath.Join(dir, "appendonly.aof")
+	config.Properties.AppendFsync = "always"
+	t.Cleanup(func() {
+		config.Properties = backup
+	})
+}
+
+func testObjects() []*rdb.Object {
+	expiration := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	expired := time.Now().Add(-time.Hour)
+	return []*rdb.Object{
+		{Key: "str", Type: rdb.StringType, String: []byte("hello")},
+		// encoded as integers
+		{Key: "int", Type: rdb.StringType, String: []byte("-12345")},
+		// compressed by lzf
+		{Key: "long", Type: rdb.StringType, String: []byte(strings.Repeat("abcdefgh", 100)), Expiration: &expiration},
+		{Key: "list", Type: rdb.ListType, List: [][]byte{[]byte("a"), []byte("1"), []byte("a")}},
+		{Key: "set", Type: rdb.SetType, Set: [][]byte{[]byte("1"), []byte("a"), []byte("b")}},
+		{Key: "hash", Type: rdb.HashType, Hash: map[string][]byte{"f1": []byte("v1"), "f2": []byte("100")}},
+		{Key: "zset", Type: rdb.ZSetType, ZSet: []*rdb.ZMember{{Member: "a", Score: 1.5}, {Member: "b", Score: -2}}},
+		{DB: 1, Key: "str", Type: rdb.StringType, String: []byte("db1"), Expiration: &expiration},
+		{DB: 1, Key: "expired", Type: rdb.StringType, String: []byte("gone"), Expiration: &expired},
+	}
+}
+
+// writeTestRDB encodes objects into a rdb file, objects must be sorted by db
+func writeTestRDB(t *testing.T, objects []*rdb.Object) string {
+	filename := filepath.Join(t.TempDir(), "import.rdb")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	encoder := rdb.NewEncoder(file)
+	if err := encoder.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.WriteAuxFields(false); err != nil {
+		t.Fatal(err)
+	}
+	dbIndex := -1
+	for _, o := range objects {
+		if o.DB != dbIndex {
+			if err := encoder.WriteDBHeader(o.DB, 0, 0); err != nil {
+				t.Fatal(err)
+			}
+			dbIndex = o.DB
+		}
+		if err := encoder.WriteObject(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.WriteEnd(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// normalize sorts members of set and sorted set, so that objects can be compared
+func normalize(o *rdb.Object) *rdb.Object {
+	sort.Slice(o.Set, func(i, j int) bool {
+		return string(o.Set[i]) < string(o.Set[j])
+	})
+	sort.Slice(o.ZSet, func(i, j int) bool {
+		return o.ZSet[i].Member < o.ZSet[j].Member
+	})
+	return o
+}
+
+// checkImported verifies values and ttls of the objects in mdb
+func checkImported(t *testing.T, mdb *StandaloneDatabase, objects []*rdb.Object) {
+	t.Helper()
+	now := time.Now()
+	for _, expected := range objects {
+		db := mdb.dbSet[expected.DB]
+		entity, exists := db.GetEntity(expected.Key)
+		if expected.Expiration != nil && expected.Expiration.Before(now) {
+			if exists {
+				t.Errorf("db %d, %s: expired key shouldn't be imported", expected.DB, expected.Key)
+			}
+			continue
+		}
+		if !exists {
+			t.Errorf("db %d, %s: key is not imported", expected.DB, expected.Key)
+			continue
+		}
+		actual := normalize(rdb.EntityToObject(expected.Key, entity))
+		actual.DB = expected.DB
+		want := normalize(&rdb.Object{
+			DB: expected.DB, Key: expected.Key, Type: expected.Type, String: expected.String,
+			List: expected.List, Set: expected.Set, Hash: expected.Hash, ZSet: expected.ZSet,
+		})
+		if !reflect.DeepEqual(actual, want) {
+			t.Errorf("db %d, %s: expected %+v, actually %+v", expected.DB, expected.Key, want, actual)
+		}
+
+		result := db.Exec(nil, utils.ToCmdLine("PTTL", expected.Key))
+		pttl, ok := result.(*reply.IntReply)
+		if !ok {
+			t.Errorf("db %d, %s: expected integer of PTTL, actually %q", expected.DB, expected.Key, result.ToBytes())
+			continue
+		}
+		if expected.Expiration == nil {
+			if pttl.Code != -1 {
+				t.Errorf("db %d, %s: expected no ttl, actually %d", expected.DB, expected.Key, pttl.Code)
+			}
+			continue
+		}
+		remaining := time.Until(*expected.Expiration).Milliseconds()
+		if diff := pttl.Code - remaining; diff > 1000 || diff < -1000 {
+			t.Errorf("db %d, %s: expected pttl about %d, actually %d", expected.DB, expected.Key, remaining, pttl.Code)
+		}
+	}
+}
+
+func TestImportRDB(t *testing.T) {
+	setupRDBConfig(t, false)
+	objects := testObjects()
+	filename := writeTestRDB(t, objects)
+
+	mdb := NewStandaloneDatabase()
+	defer mdb.Close()
+	// existing keys are overwritten
+	mdb.dbSet[0].Exec(nil, utils.ToCmdLine("SET", "list", "old"))
+	if err := mdb.ImportRDB(filename); err != nil {
+		t.Fatal(err)
+	}
+	checkImported(t, mdb, objects)
+}
+
+func TestImportDump(t *testing.T) {
+	for _, appendOnly := range []bool{false, true} {
+		setupRDBConfig(t, appendOnly)
+		objects := testObjects()
+		if err := ImportDump(writeTestRDB(t, objects)); err != nil {
+			t.Fatalf("appendonly %v: %v", appendOnly, err)
+		}
+		// the imported data is loaded by the server at startup
+		mdb := NewStandaloneDatabase()
+		checkImported(t, mdb, objects)
+		mdb.Close()
+	}
+}
+
+func TestImportRDB_Corrupted(t *testing.T) {
+	setupRDBConfig(t, false)
+	filename := writeTestRDB(t, testObjects())
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flip a byte of the checksum
+	data[len(data)-1] ^= 0xFF
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mdb := NewStandaloneDatabase()
+	defer mdb.Close()
+	if err := mdb.ImportRDB(filename); err == nil {
+		t.Error("expected checksum error")
+	}
+}
+
+func TestDirty(t *testing.T) {
+	setupRDBConfig(t, true)
+	mdb := NewStandaloneDatabase()
+	c := makeTestConn(t)
+	tests := []struct {
+		name    string
+		cmdLine []string
+		changes int64
+	}{
+		{"write", []string{"SET", "k", "v"}, 1},
+		// written into aof as SET and PEXPIREAT
+		{"write with ttl", []string{"SET", "k", "v", "EX", "100"}, 1},
+		{"read", []string{"GET", "k"}, 0},
+		{"nothing changed", []string{"DEL", "missing"}, 0},
+		{"multiple keys", []string{"MSET", "a", "1", "b", "2"}, 1},
+		// queued commands are counted by EXEC rather than MULTI and EXEC wrapping them in aof
+		{"multi", []string{"MULTI"}, 0},
+		{"queued", []string{"INCR", "a"}, 0},
+		{"queued", []string{"GET", "a"}, 0},
+		{"queued", []string{"EXPIRE", "a", "100"}, 0},
+		{"exec", []string{"EXEC"}, 2},
+	}
+	for _, tt := range tests {
+		before := mdb.dirty()
+		if result := mdb.Exec(c, utils.ToCmdLine(tt.cmdLine...)); reply.IsErrorReply(result) {
+			t.Fatalf("%s: %q", tt.name, result.ToBytes())
+		}
+		if changes := mdb.dirty() - before; changes != tt.changes {
+			t.Errorf("%s: expected %d changes, actually %d", tt.name, tt.changes, changes)
+		}
+	}
+
+	mdb.Close()
+
+	// data loaded at startup isn't dirty
+	mdb = NewStandaloneDatabase()
+	defer mdb.Close()
+	if dirty := mdb.dirty(); dirty != 0 {
+		t.Errorf("expected no changes after loading, actually %d", dirty)
+	}
+}
+
+func TestAutoAofRewrite(t *testing.T) {
+	setupRDBConfig(t, true)
+	config.Properties.AutoAofRewritePercentage = 100
+	config.Properties.AutoAofRewriteMinSize = 1
+	mdb := NewStandaloneDatabase()
+	defer mdb.Close()
+	mdb.dbSet[0].Exec(nil, utils.ToCmdLine("SET", "k", "v"))
+
+	// the threshold is checked periodically rather than by the write
+	pattern := filepath.Join(filepath.Dir(config.Properties.AppendFilename), "*", "*.base.*")
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("aof is not rewritten after the threshold is reached")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,371 @@
+package database
+
+import (
+	HashSet "go-redis/datastruct/set"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"strconv"
+)
+
+// 把val断言为set
+func (db *DB) getAsSet(key string) (*HashSet.Set, resp.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	set, ok := entity.Data.(*HashSet.Set)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return set, nil
+}
+
+func (db *DB) getOrInitSet(key string) (set *HashSet.Set, inited bool, errReply resp.ErrorReply) {
+	set, errReply = db.getAsSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if set == nil {
+		set = HashSet.Make()
+		db.PutEntity(key, &database.DataEntity{
+			Data: set,
+		})
+		inited = true
+	}
+	return set, inited, nil
+}
+
+// getAsSets returns sets bound to the given keys, nil stands for a missing key
+func (db *DB) getAsSets(keys [][]byte) ([]*HashSet.Set, resp.ErrorReply) {
+	sets := make([]*HashSet.Set, len(keys))
+	for i, key := range keys {
+		set, errReply := db.getAsSet(string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+// setToReply returns members of set, they're encoded as set in RESP3
+func setToReply(set *HashSet.Set) resp.Reply {
+	members := set.ToSlice()
+	result := make([]resp.Reply, len(members))
+	for i, member := range members {
+		result[i] = reply.MakeBulkReply([]byte(member))
+	}
+	return reply.MakeSetReply(result)
+}
+
+// storeSet puts the result set to dest key, an empty result removes the dest key
+func (db *DB) storeSet(dest string, set *HashSet.Set) {
+	if set.Len() == 0 {
+		db.Remove(dest)
+		return
+	}
+	db.PutEntity(dest, &database.DataEntity{
+		Data: set,
+	})
+	db.Persist(dest)
+}
+
+// execSAdd adds members into set
+func execSAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	members := args[1:]
+
+	// get or init entity
+	set, _, errReply := db.getOrInitSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	counter := 0
+	for _, member := range members {
+		counter += set.Add(string(member))
+	}
+	db.addAof(utils.ToCmdLine2("sadd", args...))
+	return reply.MakeIntReply(int64(counter))
+}
+
+// execSIsMember checks if the given value is member of set
+func execSIsMember(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	member := string(args[1])
+
+	// get set
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	has := set.Has(member)
+	if has {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// execSMIsMember checks if the given values are members of set
+func execSMIsMember(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	members := args[1:]
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	result := make([]resp.Reply, len(members))
+	for i, member := range members {
+		if set.Has(string(member)) {
+			result[i] = reply.MakeIntReply(1)
+		} else {
+			result[i] = reply.MakeIntReply(0)
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execSRem removes a member from set
+func execSRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	members := args[1:]
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	counter := 0
+	for _, member := range members {
+		counter += set.Remove(string(member))
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+	}
+	if counter > 0 {
+		db.addAof(utils.ToCmdLine2("srem", args...))
+	}
+	return reply.MakeIntReply(int64(counter))
+}
+
+// execSPop removes one or more random members from set
+func execSPop(db *DB, args [][]byte) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgNumErrReply("spop")
+	}
+	key := string(args[0])
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		if len(args) == 2 {
+			return &reply.EmptyMultiBulkReply{}
+		}
+		return &reply.NullBulkReply{}
+	}
+
+	count := 1
+	if len(args) == 2 {
+		count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count64 < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(count64)
+	}
+	if count > set.Len() {
+		count = set.Len()
+	}
+
+	members := set.RandomDistinctMembers(count)
+	removed := make([][]byte, len(members))
+	for i, member := range members {
+		set.Remove(member)
+		removed[i] = []byte(member)
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(removed) > 0 {
+		// log the chosen members, so that reloading won't pick different ones
+		db.addAof(utils.ToCmdLine2("srem", append([][]byte{args[0]}, removed...)...))
+	}
+
+	if len(args) == 1 {
+		return reply.MakeBulkReply(removed[0])
+	}
+	return reply.MakeMultiBulkReply(removed)
+}
+
+// execSCard gets the number of members in a set
+func execSCard(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	// get or init entity
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(set.Len()))
+}
+
+// execSMembers gets all members in a set
+func execSMembers(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	// get or init entity
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeSetReply(nil)
+	}
+	return setToReply(set)
+}
+
+// execSInter intersect multiple sets
+func execSInter(db *DB, args [][]byte) resp.Reply {
+	sets, errReply := db.getAsSets(args)
+	if errReply != nil {
+		return errReply
+	}
+	return setToReply(HashSet.Intersect(sets...))
+}
+
+// execSInterStore intersects multiple sets and store the result in a key
+func execSInterStore(db *DB, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	sets, errReply := db.getAsSets(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	result := HashSet.Intersect(sets...)
+	db.storeSet(dest, result)
+	db.addAof(utils.ToCmdLine2("sinterstore", args...))
+	return reply.MakeIntReply(int64(result.Len()))
+}
+
+// execSUnion adds multiple sets
+func execSUnion(db *DB, args [][]byte) resp.Reply {
+	sets, errReply := db.getAsSets(args)
+	if errReply != nil {
+		return errReply
+	}
+	return setToReply(HashSet.Union(sets...))
+}
+
+// execSUnionStore adds multiple sets and store the result in a key
+func execSUnionStore(db *DB, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	sets, errReply := db.getAsSets(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	result := HashSet.Union(sets...)
+	db.storeSet(dest, result)
+	db.addAof(utils.ToCmdLine2("sunionstore", args...))
+	return reply.MakeIntReply(int64(result.Len()))
+}
+
+// execSDiff subtracts multiple sets
+func execSDiff(db *DB, args [][]byte) resp.Reply {
+	sets, errReply := db.getAsSets(args)
+	if errReply != nil {
+		return errReply
+	}
+	return setToReply(HashSet.Diff(sets...))
+}
+
+// execSDiffStore subtracts multiple sets and store the result in a key
+func execSDiffStore(db *DB, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	sets, errReply := db.getAsSets(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	result := HashSet.Diff(sets...)
+	db.storeSet(dest, result)
+	db.addAof(utils.ToCmdLine2("sdiffstore", args...))
+	return reply.MakeIntReply(int64(result.Len()))
+}
+
+// maxRandomMemberCount is the max number of repeated members returned by SRANDMEMBER with a negative count
+const maxRandomMemberCount = 1 << 20
+
+// execSRandMember gets random members from set
+func execSRandMember(db *DB, args [][]byte) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgNumErrReply("srandmember")
+	}
+	key := string(args[0])
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		if len(args) == 2 {
+			return &reply.EmptyMultiBulkReply{}
+		}
+		return &reply.NullBulkReply{}
+	}
+	if len(args) == 1 {
+		// get a random member
+		members := set.RandomMembers(1)
+		return reply.MakeBulkReply([]byte(members[0]))
+	}
+	count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if count64 < -maxRandomMemberCount {
+		// members are allocated before replying, math.MinInt64 can't be negated either
+		return reply.MakeErrReply("ERR value is out of range")
+	}
+	count := int(count64)
+	var members []string
+	if count > 0 {
+		// distinct members, at most the size of set
+		members = set.RandomDistinctMembers(count)
+	} else if count < 0 {
+		// members may be repeated
+		members = set.RandomMembers(-count)
+	}
+	result := make([][]byte, len(members))
+	for i, v := range members {
+		result[i] = []byte(v)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+func init() {
+	RegisterCommand("SAdd", execSAdd, writeFirstKey, -3, "set", "write")
+	RegisterCommand("SIsMember", execSIsMember, readFirstKey, 3, "set", "read")
+	RegisterCommand("SMIsMember", execSMIsMember, readFirstKey, -3, "set", "read")
+	RegisterCommand("SRem", execSRem, writeFirstKey, -3, "set", "write")
+	RegisterCommand("SPop", execSPop, writeFirstKey, -2, "set", "write")
+	RegisterCommand("SCard", execSCard, readFirstKey, 2, "set", "read")
+	RegisterCommand("SMembers", execSMembers, readFirstKey, 2, "set", "read")
+	RegisterCommand("SInter", execSInter, readAllKeys, -2, "set", "read")
+	RegisterCommand("SInterStore", execSInterStore, writeFirstReadOthers, -3, "set", "write")
+	RegisterCommand("SUnion", execSUnion, readAllKeys, -2, "set", "read")
+	RegisterCommand("SUnionStore", execSUnionStore, writeFirstReadOthers, -3, "set", "write")
+	RegisterCommand("SDiff", execSDiff, readAllKeys, -2, "set", "read")
+	RegisterCommand("SDiffStore", execSDiffStore, writeFirstReadOthers, -3, "set", "write")
+	RegisterCommand("SRandMember", execSRandMember, readFirstKey, -2, "set", "read")
+}
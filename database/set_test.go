@@ -0,0 +1,44 @@
+package database
+
+import (
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"strconv"
+	"testing"
+)
+
+func TestSRandMember_Count(t *testing.T) {
+	db := makeDB()
+	defer db.Close()
+	db.Exec(nil, utils.ToCmdLine("SADD", "s", "a", "b", "c"))
+
+	tests := []struct {
+		count int64
+		len   int
+	}{
+		{2, 2},
+		{10, 3},
+		{-10, 10},
+		{0, 0},
+		{-maxRandomMemberCount, maxRandomMemberCount},
+	}
+	for _, tt := range tests {
+		result := db.Exec(nil, utils.ToCmdLine("SRANDMEMBER", "s", strconv.FormatInt(tt.count, 10)))
+		multiBulk, ok := result.(*reply.MultiBulkReply)
+		if !ok {
+			t.Errorf("count %d: expected multi bulk, actually %q", tt.count, result.ToBytes())
+			continue
+		}
+		if len(multiBulk.Args) != tt.len {
+			t.Errorf("count %d: expected %d members, actually %d", tt.count, tt.len, len(multiBulk.Args))
+		}
+	}
+
+	// too many members to allocate, and math.MinInt64 which can't be negated
+	for _, count := range []string{"-9223372036854775808", "-1099511627776"} {
+		result := db.Exec(nil, utils.ToCmdLine("SRANDMEMBER", "s", count))
+		if string(result.ToBytes()) != "-ERR value is out of range\r\n" {
+			t.Errorf("count %s: expected out of range error, actually %q", count, result.ToBytes())
+		}
+	}
+}
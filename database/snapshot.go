@@ -0,0 +1,203 @@
+package database
+
+import (
+	"go-redis/aof"
+	"go-redis/interface/database"
+	"go-redis/rdb"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// snapshot is a point-in-time view of all databases used by rdb persistence and aof rewrite.
+// Taking a snapshot only blocks writing while the keys are collected, the values are serialized later.
+// Before a writer modifies a value which has not been dumped yet, it saves the old value into the snapshot (copy-on-write)
+type snapshot struct {
+	entries []*snapshotEntry
+	// entity -> entry, it's read-only after the snapshot is taken
+	pending map[*database.DataEntity]*snapshotEntry
+	// dirty counters of databases when the snapshot is taken
+	dirties []int64
+}
+
+type snapshotEntry struct {
+	mu         sync.Mutex
+	dbIndex    int
+	key        string
+	entity     *database.DataEntity
+	expiration *time.Time
+	// object is the value at the moment of the snapshot, it's set once the entry is dumped or copied by a writer
+	object *rdb.Object
+}
+
+// takeSnapshot collects keys of all databases, writes are blocked until it returns
+func (mdb *StandaloneDatabase) takeSnapshot() *snapshot {
+	mdb.lockAll()
+	defer mdb.unlockAll()
+	return mdb.collectSnapshot()
+}
+
+// takeAofSnapshot implements aof.SnapshotMaker, onTaken is called before writes are resumed
+func (mdb *StandaloneDatabase) takeAofSnapshot(onTaken func() error) (aof.Snapshot, error) {
+	mdb.lockAll()
+	defer mdb.unlockAll()
+	snap := mdb.collectSnapshot()
+	if err := onTaken(); err != nil {
+		mdb.releaseSnapshot(snap)
+		return nil, err
+	}
+	return &aofSnapshot{mdb: mdb, snap: snap}, nil
+}
+
+func (mdb *StandaloneDatabase) lockAll() {
+	for _, db := range mdb.dbSet {
+		db.locker.LockAll()
+	}
+}
+
+func (mdb *StandaloneDatabase) unlockAll() {
+	for i := len(mdb.dbSet) - 1; i >= 0; i-- {
+		mdb.dbSet[i].locker.UnLockAll()
+	}
+}
+
+// collectSnapshot starts copy-on-write for a new snapshot, the caller must hold all the locks
+func (mdb *StandaloneDatabase) collectSnapshot() *snapshot {
+	snap := &snapshot{
+		pending: make(map[*database.DataEntity]*snapshotEntry),
+		dirties: make([]int64, len(mdb.dbSet)),
+	}
+	for i, db := range mdb.dbSet {
+		dbIndex := db.index
+		snap.dirties[i] = atomic.LoadInt64(db.dirty)
+		db.ForEach(func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			entry := &snapshotEntry{
+				dbIndex:    dbIndex,
+				key:        key,
+				entity:     entity,
+				expiration: expiration,
+			}
+			snap.entries = append(snap.entries, entry)
+			snap.pending[entity] = entry
+			return true
+		})
+	}
+	for _, db := range mdb.dbSet {
+		db.updateSnapshots(func(snaps []*snapshot) []*snapshot {
+			return append(snaps, snap)
+		})
+	}
+	return snap
+}
+
+// releaseSnapshot stops copy-on-write after the snapshot is dumped
+func (mdb *StandaloneDatabase) releaseSnapshot(snap *snapshot) {
+	for _, db := range mdb.dbSet {
+		db.updateSnapshots(func(snaps []*snapshot) []*snapshot {
+			remaining := make([]*snapshot, 0, len(snaps))
+			for _, s := range snaps {
+				if s != snap {
+					remaining = append(remaining, s)
+				}
+			}
+			return remaining
+		})
+	}
+}
+
+// updateSnapshots replaces the running snapshots with the result of update, the slice is never modified in place
+func (db *DB) updateSnapshots(update func([]*snapshot) []*snapshot) {
+	for {
+		old := db.snapshots.Load()
+		var snaps []*snapshot
+		if old != nil {
+			snaps = append(snaps, *old...)
+		}
+		snaps = update(snaps)
+		var updated *[]*snapshot
+		if len(snaps) > 0 {
+			updated = &snaps
+		}
+		if db.snapshots.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+// sizes returns the number of keys and the number of keys with ttl in each db
+func (snap *snapshot) sizes() (keyCounts map[int]int, ttlCounts map[int]int) {
+	keyCounts = make(map[int]int)
+	ttlCounts = make(map[int]int)
+	for _, entry := range snap.entries {
+		keyCounts[entry.dbIndex]++
+		if entry.expiration != nil {
+			ttlCounts[entry.dbIndex]++
+		}
+	}
+	return keyCounts, ttlCounts
+}
+
+// get returns the value of entry at the moment of the snapshot, later writes to the entity don't copy it anymore
+func (entry *snapshotEntry) get() *rdb.Object {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.object == nil {
+		entry.object = rdb.EntityToObject(entry.key, entry.entity)
+	}
+	entry.entity = nil
+	obj := entry.object
+	obj.DB = entry.dbIndex
+	obj.Expiration = entry.expiration
+	return obj
+}
+
+// beforeWrite saves values of the given keys into the running snapshots before they are modified.
+// The caller must hold write locks of the keys
+func (db *DB) beforeWrite(keys []string) {
+	snaps := db.snapshots.Load()
+	if snaps == nil {
+		return
+	}
+	for _, key := range keys {
+		raw, ok := db.data.Get(key)
+		if !ok {
+			continue
+		}
+		for _, snap := range *snaps {
+			entry := snap.pending[raw.(*database.DataEntity)]
+			if entry == nil {
+				continue
+			}
+			entry.mu.Lock()
+			if entry.object == nil {
+				entry.object = rdb.EntityToObject(entry.key, entry.entity)
+			}
+			entry.mu.Unlock()
+		}
+	}
+}
+
+// aofSnapshot is the snapshot dumped by aof rewrite
+type aofSnapshot struct {
+	mdb  *StandaloneDatabase
+	snap *snapshot
+}
+
+// ForEach traverses objects in the snapshot in order of db index
+func (s *aofSnapshot) ForEach(cb func(obj *rdb.Object) bool) {
+	for _, entry := range s.snap.entries {
+		if !cb(entry.get()) {
+			return
+		}
+	}
+}
+
+// Sizes returns the number of keys and the number of keys with ttl in each db
+func (s *aofSnapshot) Sizes() (keyCounts map[int]int, ttlCounts map[int]int) {
+	return s.snap.sizes()
+}
+
+// Release stops copy-on-write after the snapshot is dumped
+func (s *aofSnapshot) Release() {
+	s.mdb.releaseSnapshot(s.snap)
+}
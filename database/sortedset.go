@@ -0,0 +1,499 @@
+package database
+
+import (
+	SortedSet "go-redis/datastruct/sortedset"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 把val断言为sorted set
+func (db *DB) getAsSortedSet(key string) (*SortedSet.SortedSet, resp.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	sortedSet, ok := entity.Data.(*SortedSet.SortedSet)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return sortedSet, nil
+}
+
+func (db *DB) getOrInitSortedSet(key string) (sortedSet *SortedSet.SortedSet, inited bool, errReply resp.ErrorReply) {
+	sortedSet, errReply = db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if sortedSet == nil {
+		sortedSet = SortedSet.Make()
+		db.PutEntity(key, &database.DataEntity{
+			Data: sortedSet,
+		})
+		inited = true
+	}
+	return sortedSet, inited, nil
+}
+
+// parseScore parses score argument, accepting +inf and -inf
+func parseScore(raw []byte) (float64, bool) {
+	score, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+	return score, true
+}
+
+const (
+	zaddUpsert = iota // default
+	zaddInsert        // zadd nx
+	zaddUpdate        // zadd xx
+)
+
+// execZAdd adds members into sorted set
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func execZAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	nx, xx, gt, lt, ch, incr := false, false, false, false, false, false
+
+	// parse options
+	i := 1
+	for ; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		if arg == "NX" {
+			nx = true
+		} else if arg == "XX" {
+			xx = true
+		} else if arg == "GT" {
+			gt = true
+		} else if arg == "LT" {
+			lt = true
+		} else if arg == "CH" {
+			ch = true
+		} else if arg == "INCR" {
+			incr = true
+		} else {
+			break
+		}
+	}
+	if nx && xx {
+		return reply.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (gt && lt) || ((gt || lt) && nx) {
+		return reply.MakeErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	policy := zaddUpsert
+	if nx {
+		policy = zaddInsert
+	} else if xx {
+		policy = zaddUpdate
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return &reply.SyntaxErrReply{}
+	}
+	if incr && len(pairs) != 2 {
+		return reply.MakeErrReply("ERR INCR option supports a single increment-element pair")
+	}
+
+	size := len(pairs) / 2
+	elements := make([]*SortedSet.Element, size)
+	for j := 0; j < size; j++ {
+		score, ok := parseScore(pairs[2*j])
+		if !ok {
+			return reply.MakeErrReply("ERR value is not a valid float")
+		}
+		elements[j] = &SortedSet.Element{
+			Member: string(pairs[2*j+1]),
+			Score:  score,
+		}
+	}
+
+	// get or init entity
+	sortedSet, _, errReply := db.getOrInitSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	added, changed := 0, 0
+	var incrResult resp.Reply = &reply.NullBulkReply{}
+	for _, e := range elements {
+		score := e.Score
+		old, exists := sortedSet.Get(e.Member)
+		if (exists && policy == zaddInsert) || (!exists && policy == zaddUpdate) {
+			continue
+		}
+		if exists {
+			if incr {
+				score = old.Score + score
+				if math.IsNaN(score) {
+					return reply.MakeErrReply("ERR resulting score is not a number (NaN)")
+				}
+			}
+			if (gt && score <= old.Score) || (lt && score >= old.Score) {
+				continue
+			}
+			if score != old.Score {
+				changed++
+			}
+		} else {
+			added++
+		}
+		sortedSet.Add(e.Member, score)
+		if incr {
+			incrResult = reply.MakeDoubleReply(score)
+		}
+	}
+	if sortedSet.Len() == 0 {
+		// nothing is inserted into a new sorted set
+		db.Remove(key)
+	}
+	if added > 0 || changed > 0 {
+		db.addAof(utils.ToCmdLine2("zadd", args...))
+	}
+
+	if incr {
+		return incrResult
+	}
+	if ch {
+		return reply.MakeIntReply(int64(added + changed))
+	}
+	return reply.MakeIntReply(int64(added))
+}
+
+// execZScore gets score of a member in sortedset
+func execZScore(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	key := string(args[0])
+	member := string(args[1])
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return &reply.NullBulkReply{}
+	}
+
+	element, exists := sortedSet.Get(member)
+	if !exists {
+		return &reply.NullBulkReply{}
+	}
+	return reply.MakeDoubleReply(element.Score)
+}
+
+func rank(db *DB, args [][]byte, desc bool) resp.Reply {
+	// parse args
+	key := string(args[0])
+	member := string(args[1])
+
+	// get entity
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return &reply.NullBulkReply{}
+	}
+
+	r := sortedSet.GetRank(member, desc)
+	if r < 0 {
+		return &reply.NullBulkReply{}
+	}
+	return reply.MakeIntReply(r)
+}
+
+// execZRank gets index of a member in sortedset, ascending order, start from 0
+func execZRank(db *DB, args [][]byte) resp.Reply {
+	return rank(db, args, false)
+}
+
+// execZRevRank gets index of a member in sortedset, descending order, start from 0
+func execZRevRank(db *DB, args [][]byte) resp.Reply {
+	return rank(db, args, true)
+}
+
+// execZCard gets number of members in sortedset
+func execZCard(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	key := string(args[0])
+
+	// get entity
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	return reply.MakeIntReply(sortedSet.Len())
+}
+
+func elementsToReply(elements []*SortedSet.Element, withScores bool) resp.Reply {
+	if withScores {
+		// pairs of member and score in RESP3
+		members := make([]resp.Reply, len(elements))
+		scores := make([]resp.Reply, len(elements))
+		for i, element := range elements {
+			members[i] = reply.MakeBulkReply([]byte(element.Member))
+			scores[i] = reply.MakeDoubleReply(element.Score)
+		}
+		return reply.MakePairsReply(members, scores)
+	}
+	result := make([][]byte, len(elements))
+	for i, element := range elements {
+		result[i] = []byte(element.Member)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+func rangeByRank(db *DB, args [][]byte, cmdName string, desc bool) resp.Reply {
+	if len(args) != 3 && len(args) != 4 {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	withScores := false
+	if len(args) == 4 {
+		if strings.ToUpper(string(args[3])) != "WITHSCORES" {
+			return &reply.SyntaxErrReply{}
+		}
+		withScores = true
+	}
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	// get data
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	from, to, ok := normalizeRange(start, stop, sortedSet.Len())
+	if !ok {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	slice := sortedSet.RangeByRank(int64(from), int64(to), desc)
+	return elementsToReply(slice, withScores)
+}
+
+// execZRange gets members in range, sort by score in ascending order
+func execZRange(db *DB, args [][]byte) resp.Reply {
+	return rangeByRank(db, args, "zrange", false)
+}
+
+// execZRevRange gets members in range, sort by score in descending order
+func execZRevRange(db *DB, args [][]byte) resp.Reply {
+	return rangeByRank(db, args, "zrevrange", true)
+}
+
+// execZCount gets number of members which score within given range
+func execZCount(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	min, err := SortedSet.ParseScoreBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+
+	max, err := SortedSet.ParseScoreBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+
+	// get data
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	return reply.MakeIntReply(sortedSet.Count(min, max))
+}
+
+// rangeByScore parses `min max [WITHSCORES] [LIMIT offset count]`, `min` and `max` are swapped by caller for rev commands
+func rangeByScore(db *DB, key string, rawMin []byte, rawMax []byte, options [][]byte, desc bool) resp.Reply {
+	min, err := SortedSet.ParseScoreBorder(string(rawMin))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	max, err := SortedSet.ParseScoreBorder(string(rawMax))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+
+	withScores := false
+	var offset int64 = 0
+	var limit int64 = -1
+	for i := 0; i < len(options); i++ {
+		s := strings.ToUpper(string(options[i]))
+		if s == "WITHSCORES" {
+			withScores = true
+		} else if s == "LIMIT" {
+			if len(options) < i+3 {
+				return &reply.SyntaxErrReply{}
+			}
+			offset, err = strconv.ParseInt(string(options[i+1]), 10, 64)
+			if err != nil {
+				return reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			limit, err = strconv.ParseInt(string(options[i+2]), 10, 64)
+			if err != nil {
+				return reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			i += 2
+		} else {
+			return &reply.SyntaxErrReply{}
+		}
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	slice := sortedSet.RangeByScore(min, max, offset, limit, desc)
+	return elementsToReply(slice, withScores)
+}
+
+// execZRangeByScore gets members which score within given range, in ascending order
+func execZRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return rangeByScore(db, string(args[0]), args[1], args[2], args[3:], false)
+}
+
+// execZRevRangeByScore gets members which score within given range, in descending order
+func execZRevRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return rangeByScore(db, string(args[0]), args[2], args[1], args[3:], true)
+}
+
+// execZRemRangeByRank removes members within given indexes
+func execZRemRangeByRank(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	// get data
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	from, to, ok := normalizeRange(start, stop, sortedSet.Len())
+	if !ok {
+		return reply.MakeIntReply(0)
+	}
+	removed := sortedSet.RemoveByRank(int64(from), int64(to))
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2("zremrangebyrank", args...))
+	}
+	return reply.MakeIntReply(removed)
+}
+
+// execZRem removes given members
+func execZRem(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	key := string(args[0])
+	fields := make([]string, len(args)-1)
+	fieldArgs := args[1:]
+	for i, v := range fieldArgs {
+		fields[i] = string(v)
+	}
+
+	// get entity
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	var deleted int64 = 0
+	for _, field := range fields {
+		if sortedSet.Remove(field) {
+			deleted++
+		}
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine2("zrem", args...))
+	}
+	return reply.MakeIntReply(deleted)
+}
+
+// execZIncrBy increments the score of a member
+func execZIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	delta, ok := parseScore(args[1])
+	if !ok {
+		return reply.MakeErrReply("ERR value is not a valid float")
+	}
+	member := string(args[2])
+
+	// get or init entity
+	sortedSet, _, errReply := db.getOrInitSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	score := delta
+	element, exists := sortedSet.Get(member)
+	if exists {
+		score = element.Score + delta
+		if math.IsNaN(score) {
+			return reply.MakeErrReply("ERR resulting score is not a number (NaN)")
+		}
+	}
+	sortedSet.Add(member, score)
+	db.addAof(utils.ToCmdLine2("zincrby", args...))
+	return reply.MakeDoubleReply(score)
+}
+
+func init() {
+	RegisterCommand("ZAdd", execZAdd, writeFirstKey, -4, "sortedset", "write")
+	RegisterCommand("ZScore", execZScore, readFirstKey, 3, "sortedset", "read")
+	RegisterCommand("ZIncrBy", execZIncrBy, writeFirstKey, 4, "sortedset", "write")
+	RegisterCommand("ZRank", execZRank, readFirstKey, 3, "sortedset", "read")
+	RegisterCommand("ZRevRank", execZRevRank, readFirstKey, 3, "sortedset", "read")
+	RegisterCommand("ZCount", execZCount, readFirstKey, 4, "sortedset", "read")
+	RegisterCommand("ZCard", execZCard, readFirstKey, 2, "sortedset", "read")
+	RegisterCommand("ZRange", execZRange, readFirstKey, -4, "sortedset", "read")
+	RegisterCommand("ZRevRange", execZRevRange, readFirstKey, -4, "sortedset", "read")
+	RegisterCommand("ZRangeByScore", execZRangeByScore, readFirstKey, -4, "sortedset", "read")
+	RegisterCommand("ZRevRangeByScore", execZRevRangeByScore, readFirstKey, -4, "sortedset", "read")
+	RegisterCommand("ZRem", execZRem, writeFirstKey, -3, "sortedset", "write")
+	RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, writeFirstKey, 4, "sortedset", "write")
+}
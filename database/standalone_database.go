@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"go-redis/aof"
 	"go-redis/config"
+	"go-redis/interface/database"
 	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/resp/reply"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // StandaloneDatabase is a set of multiple database set
@@ -17,6 +20,13 @@ type StandaloneDatabase struct {
 	dbSet []*DB
 	// handle aof persistence
 	aofHandler *aof.AofHandler
+
+	// rdb persistence
+	saving         atomic.Bool
+	lastSave       atomic.Int64 // unix time of the latest successful save
+	lastSaveTry    atomic.Int64 // unix time of the latest background save
+	lastSaveFailed atomic.Bool
+	stopCron       chan struct{}
 }
 
 // NewStandaloneDatabase creates a redis database,
@@ -29,25 +39,49 @@ func NewStandaloneDatabase() *StandaloneDatabase {
 	for i := range mdb.dbSet {
 		singleDB := makeDB()
 		singleDB.index = i
+		singleDB.getDB = mdb.getDB
 		mdb.dbSet[i] = singleDB
 	}
+	mdb.lastSave.Store(time.Now().Unix())
 	if config.Properties.AppendOnly {
-		aofHandler, err := aof.NewAOFHandler(mdb)
+		aofHandler, err := aof.NewAOFHandler(mdb, mdb.takeAofSnapshot)
 		if err != nil {
 			panic(err)
 		}
 		mdb.aofHandler = aofHandler
-		for _, db := range mdb.dbSet {
-			// avoid closure
-			singleDB := db
-			singleDB.addAof = func(line CmdLine) {
-				mdb.aofHandler.AddAof(singleDB.index, line)
+	} else if err := mdb.loadRDB(); err != nil {
+		panic(err)
+	}
+	for _, db := range mdb.dbSet {
+		// avoid closure
+		singleDB := db
+		// data loaded from aof or rdb has been persisted
+		atomic.StoreInt64(singleDB.dirty, 0)
+		singleDB.addAof = func(lines ...CmdLine) {
+			if mdb.aofHandler != nil {
+				mdb.aofHandler.AddAof(singleDB.index, lines...)
 			}
 		}
 	}
+	rules, err := parseSaveRules(config.Properties.Save)
+	if err != nil {
+		panic(err)
+	}
+	if len(rules) > 0 {
+		mdb.stopCron = make(chan struct{})
+		go mdb.saveCron(rules)
+	}
 	return mdb
 }
 
+// persistenceCommands are executed by StandaloneDatabase rather than a single db
+var persistenceCommands = map[string]bool{
+	"save":         true,
+	"bgsave":       true,
+	"lastsave":     true,
+	"bgrewriteaof": true,
+}
+
 // Exec executes command
 // parameter `cmdLine` contains command and its arguments, for example: "set key value"
 func (mdb *StandaloneDatabase) Exec(c resp.Connection, cmdLine [][]byte) (result resp.Reply) {
@@ -58,26 +92,122 @@ func (mdb *StandaloneDatabase) Exec(c resp.Connection, cmdLine [][]byte) (result
 	}()
 	// 获取协议头 检查是否是切换数据库请求
 	cmdName := strings.ToLower(string(cmdLine[0]))
+	// 认证
+	if cmdName == "auth" {
+		return Auth(c, cmdLine[1:])
+	}
+	if cmdName == "hello" {
+		return Hello(c, cmdLine[1:])
+	}
 	// 切换子库
 	if cmdName == "select" {
+		if c != nil && c.InMultiState() {
+			errReply := reply.MakeErrReply("ERR SELECT inside MULTI is not allowed")
+			c.AddTxError(errReply)
+			return errReply
+		}
 		if len(cmdLine) != 2 {
 			return reply.MakeArgNumErrReply("select")
 		}
 		return execSelect(c, mdb, cmdLine[1:])
 	}
+	// persistence commands are not queued, the queued commands are executed by a single db
+	if persistenceCommands[cmdName] && c != nil && c.InMultiState() {
+		errReply := reply.MakeErrReply("ERR " + strings.ToUpper(cmdName) + " inside MULTI is not allowed")
+		c.AddTxError(errReply)
+		return errReply
+	}
+	if cmdName == "bgrewriteaof" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return mdb.bgRewriteAof()
+	}
+	// rdb persistence
+	if cmdName == "save" || cmdName == "bgsave" || cmdName == "lastsave" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		switch cmdName {
+		case "save":
+			return mdb.execSave()
+		case "bgsave":
+			return mdb.execBgSave()
+		}
+		return mdb.execLastSave()
+	}
+	if cmdName == "acl" {
+		if c != nil && c.InMultiState() {
+			errReply := reply.MakeErrReply("ERR ACL inside MULTI is not allowed")
+			c.AddTxError(errReply)
+			return errReply
+		}
+		return execACL(c, cmdLine[1:])
+	}
 	// 获取子库
 	dbIndex := c.GetDBIndex()
 	selectedDB := mdb.dbSet[dbIndex]
 	// 在子库上执行cmd
-	return selectedDB.Exec(c, cmdLine)
+	result = selectedDB.Exec(c, cmdLine)
+	if mdb.aofHandler != nil {
+		// wait for fsync after locks of keys are released, so that writers of the same keys share fsync
+		if err := mdb.aofHandler.WaitFsync(); err != nil {
+			return reply.MakeErrReply("ERR failed to persist the command: " + err.Error())
+		}
+	}
+	return result
 }
 
-// Close graceful shutdown database
-func (mdb *StandaloneDatabase) Close() {
+// PrepareShutdown saves a snapshot according to the mode, it waits for the background saving in progress
+func (mdb *StandaloneDatabase) PrepareShutdown(mode database.SaveMode) error {
+	// stopCron is created only if save rules are configured
+	save := mode == database.SaveForced || (mode == database.SaveDefault && mdb.stopCron != nil)
+	if !save {
+		return nil
+	}
+	for !mdb.saving.CompareAndSwap(false, true) {
+		time.Sleep(shutdownSaveWait)
+	}
+	defer mdb.saving.Store(false)
+	logger.Info("saving the final RDB snapshot before exiting")
+	if err := mdb.saveRDB(mdb.takeSnapshot()); err != nil {
+		logger.Error("error trying to save the DB, can't exit: " + err.Error())
+		return err
+	}
+	return nil
+}
 
+// Close graceful shutdown database, the commands in aof queue are written and fsynced
+func (mdb *StandaloneDatabase) Close() {
+	if mdb.stopCron != nil {
+		close(mdb.stopCron)
+	}
+	if mdb.aofHandler != nil {
+		mdb.aofHandler.Close()
+	}
+	for _, db := range mdb.dbSet {
+		db.Close()
+	}
 }
 
 func (mdb *StandaloneDatabase) AfterClientClose(c resp.Connection) {
+	closeSession(c)
+}
+
+// getDB returns the database of given index
+func (mdb *StandaloneDatabase) getDB(dbIndex int) *DB {
+	return mdb.dbSet[dbIndex]
+}
+
+// bgRewriteAof starts aof rewrite in background
+func (mdb *StandaloneDatabase) bgRewriteAof() resp.Reply {
+	if mdb.aofHandler == nil {
+		return reply.MakeErrReply("ERR AOF is not enabled")
+	}
+	if err := mdb.aofHandler.BackgroundRewrite(); err != nil {
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+	return reply.MakeStatusReply("Background append only file rewriting started")
 }
 
 func execSelect(c resp.Connection, mdb *StandaloneDatabase, args [][]byte) resp.Reply {
@@ -7,13 +7,14 @@ import (
 	"go-redis/resp/reply"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // 把val断言为string
 func (db *DB) getAsString(key string) ([]byte, resp.Reply) {
 	entity, ok := db.GetEntity(key)
 	if !ok {
-		return nil, reply.MakeNullBulkReply()
+		return nil, nil
 	}
 	bytes, ok := entity.Data.([]byte)
 	if !ok {
@@ -42,10 +43,14 @@ func execGet(db *DB, args [][]byte) resp.Reply {
 }
 
 // execSet sets string value and time to live to the given key
+// SET key value [NX|XX] [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|KEEPTTL]
 func execSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	value := args[1]
 	policy := upsertPolicy
+	var expireTime time.Time
+	hasTTL := false
+	keepTTL := false
 	// parse options
 	if len(args) > 2 {
 		for i := 2; i < len(args); i++ {
@@ -60,6 +65,38 @@ func execSet(db *DB, args [][]byte) resp.Reply {
 					return &reply.SyntaxErrReply{}
 				}
 				policy = updatePolicy
+			} else if arg == "KEEPTTL" {
+				if hasTTL {
+					return &reply.SyntaxErrReply{}
+				}
+				keepTTL = true
+			} else if arg == "EX" || arg == "PX" || arg == "EXAT" || arg == "PXAT" {
+				if hasTTL || keepTTL || i+1 >= len(args) {
+					return &reply.SyntaxErrReply{}
+				}
+				raw, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+				if err != nil {
+					return reply.MakeErrReply("ERR value is not an integer or out of range")
+				}
+				if raw <= 0 {
+					return reply.MakeErrReply("ERR invalid expire time in 'set' command")
+				}
+				var errReply resp.Reply
+				switch arg {
+				case "EX":
+					expireTime, errReply = makeExpireTime("set", raw, 1000, true)
+				case "PX":
+					expireTime, errReply = makeExpireTime("set", raw, 1, true)
+				case "EXAT":
+					expireTime, errReply = makeExpireTime("set", raw, 1000, false)
+				case "PXAT":
+					expireTime = time.UnixMilli(raw)
+				}
+				if errReply != nil {
+					return errReply
+				}
+				hasTTL = true
+				i++ // skip next arg
 			} else {
 				return &reply.SyntaxErrReply{}
 			}
@@ -80,11 +117,20 @@ func execSet(db *DB, args [][]byte) resp.Reply {
 	case updatePolicy:
 		result = db.PutIfExists(key, entity)
 	}
-	db.addAof(utils.ToCmdLine2("set", args...))
-	if result > 0 {
-		return &reply.OKReply{}
+	if result == 0 {
+		return &reply.NullBulkReply{}
+	}
+	if hasTTL {
+		db.Expire(key, expireTime)
+		db.addAof(utils.ToCmdLine2("set", args[0], args[1]))
+		db.addAof(toExpireAtCmd(key, expireTime))
+	} else if keepTTL {
+		db.addAof(utils.ToCmdLine2("set", args[0], args[1], []byte("KEEPTTL")))
+	} else {
+		db.Persist(key)
+		db.addAof(utils.ToCmdLine2("set", args[0], args[1]))
 	}
-	return &reply.NullBulkReply{}
+	return &reply.OKReply{}
 }
 
 // execSetNX sets string if not exists
@@ -116,6 +162,7 @@ func execMSet(db *DB, args [][]byte) resp.Reply {
 	for i, key := range keys {
 		value := values[i]
 		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.Persist(key)
 	}
 	db.addAof(utils.ToCmdLine2("mset", args...))
 	return &reply.OKReply{}
@@ -185,10 +232,11 @@ func execGetSet(db *DB, args [][]byte) resp.Reply {
 		return err
 	}
 	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.Persist(key)
+	db.addAof(utils.ToCmdLine2("getset", args...))
 	if old == nil {
 		return new(reply.NullBulkReply)
 	}
-	db.addAof(utils.ToCmdLine2("getset", args...))
 	return reply.MakeBulkReply(old)
 }
 
@@ -417,19 +465,19 @@ func execGetRange(db *DB, args [][]byte) resp.Reply {
 }
 
 func init() {
-	RegisterCommand("Set", execSet, -3)
-	RegisterCommand("SetNx", execSetNX, 3)
-	RegisterCommand("MSet", execMSet, -3)
-	RegisterCommand("MGet", execMGet, -2)
-	RegisterCommand("MSetNX", execMSetNX, -3)
-	RegisterCommand("Get", execGet, 2)
-	RegisterCommand("GetSet", execGetSet, 3)
-	RegisterCommand("Incr", execIncr, 2)
-	RegisterCommand("IncrBy", execIncrBy, 3)
-	RegisterCommand("Decr", execDecr, 2)
-	RegisterCommand("DecrBy", execDecrBy, 3)
-	RegisterCommand("StrLen", execStrLen, 2)
-	RegisterCommand("Append", execAppend, 3)
-	RegisterCommand("SetRange", execSetRange, 4)
-	RegisterCommand("GetRange", execGetRange, 4)
+	RegisterCommand("Set", execSet, writeFirstKey, -3, "string", "write")
+	RegisterCommand("SetNx", execSetNX, writeFirstKey, 3, "string", "write")
+	RegisterCommand("MSet", execMSet, writeEvenKeys, -3, "string", "write")
+	RegisterCommand("MGet", execMGet, readAllKeys, -2, "string", "read")
+	RegisterCommand("MSetNX", execMSetNX, writeEvenKeys, -3, "string", "write")
+	RegisterCommand("Get", execGet, readFirstKey, 2, "string", "read")
+	RegisterCommand("GetSet", execGetSet, writeFirstKey, 3, "string", "write")
+	RegisterCommand("Incr", execIncr, writeFirstKey, 2, "string", "write")
+	RegisterCommand("IncrBy", execIncrBy, writeFirstKey, 3, "string", "write")
+	RegisterCommand("Decr", execDecr, writeFirstKey, 2, "string", "write")
+	RegisterCommand("DecrBy", execDecrBy, writeFirstKey, 3, "string", "write")
+	RegisterCommand("StrLen", execStrLen, readFirstKey, 2, "string", "read")
+	RegisterCommand("Append", execAppend, writeFirstKey, 3, "string", "write")
+	RegisterCommand("SetRange", execSetRange, writeFirstKey, 4, "string", "write")
+	RegisterCommand("GetRange", execGetRange, readFirstKey, 4, "string", "read")
 }
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"strings"
+)
+
+// startMulti starts multi-command-transaction
+func startMulti(conn resp.Connection) resp.Reply {
+	if conn.InMultiState() {
+		return reply.MakeErrReply("ERR MULTI calls can not be nested")
+	}
+	conn.SetMultiState(true)
+	return reply.MakeOKReply()
+}
+
+// enqueueCmd puts command line into `multi` pending queue
+func enqueueCmd(conn resp.Connection, cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		errReply := reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+		conn.AddTxError(errReply)
+		return errReply
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		errReply := reply.MakeArgNumErrReply(cmdName)
+		conn.AddTxError(errReply)
+		return errReply
+	}
+	conn.EnqueueCmd(cmdLine)
+	return reply.MakeQueuedReply()
+}
+
+// discardMulti drops MULTI pending commands
+func discardMulti(conn resp.Connection) resp.Reply {
+	if !conn.InMultiState() {
+		return reply.MakeErrReply("ERR DISCARD without MULTI")
+	}
+	conn.ClearQueuedCmds()
+	conn.SetMultiState(false)
+	return reply.MakeOKReply()
+}
+
+// execMulti executes multi commands transaction Atomically and Isolated
+func execMulti(db *DB, conn resp.Connection) resp.Reply {
+	if !conn.InMultiState() {
+		return reply.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer conn.SetMultiState(false)
+	if len(conn.GetTxErrors()) > 0 {
+		conn.ClearQueuedCmds()
+		return reply.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	cmdLines := conn.GetQueuedCmdLine()
+	watching := conn.GetWatching()
+	conn.ClearQueuedCmds()
+	return db.ExecMulti(watching, cmdLines)
+}
+
+// ExecMulti executes the given commands atomically, returns nil multi bulk reply if any watched key is changed
+func (db *DB) ExecMulti(watching map[int]map[string]uint64, cmdLines []CmdLine) resp.Reply {
+	// prepare
+	writeKeys := make([]string, 0) // may contains duplicate
+	readKeys := make([]string, 0)
+	lockAll := false
+	for _, cmdLine := range cmdLines {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		cmd, ok := cmdTable[cmdName]
+		if !ok {
+			continue
+		}
+		lockAll = lockAll || lockAllCommands[cmdName]
+		write, read := cmd.prepare(cmdLine[1:])
+		writeKeys = append(writeKeys, write...)
+		readKeys = append(readKeys, read...)
+	}
+	// watching keys must not be changed until exec finished
+	for key := range watching[db.index] {
+		readKeys = append(readKeys, key)
+	}
+	if lockAll {
+		db.locker.LockAll()
+		defer db.locker.UnLockAll()
+	} else {
+		db.locker.RWLocks(writeKeys, readKeys)
+		defer db.locker.RWUnLocks(writeKeys, readKeys)
+	}
+
+	if isWatchingChanged(db, watching) { // watching keys changed, abort
+		return reply.MakeNullMultiBulkReply()
+	}
+	db.beforeWrite(writeKeys)
+
+	// collect aof of all commands, so that the transaction is persisted as a whole
+	aofLines := make([]CmdLine, 0, len(cmdLines)+2)
+	aofLines = append(aofLines, utils.ToCmdLine("multi"))
+	txDB := *db
+	txDB.addAof = func(lines ...CmdLine) {
+		aofLines = append(aofLines, lines...)
+	}
+
+	results := make([]resp.Reply, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		// errors during execution don't stop the remaining commands, just like redis
+		results = append(results, txDB.execWithLock(cmdLine))
+	}
+	db.addVersion(writeKeys...)
+	if len(aofLines) > 1 {
+		aofLines = append(aofLines, utils.ToCmdLine("exec"))
+		db.addAof(aofLines...)
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// watch marks the given keys, the transaction will be aborted if any of them is changed before EXEC
+func watch(db *DB, conn resp.Connection, args [][]byte) resp.Reply {
+	if conn.InMultiState() {
+		return reply.MakeErrReply("ERR WATCH inside MULTI is not allowed")
+	}
+	watching := conn.GetWatching()
+	if watching[db.index] == nil {
+		watching[db.index] = make(map[string]uint64)
+	}
+	for _, bkey := range args {
+		key := string(bkey)
+		// a key expired before WATCH is removed now, so that its removal doesn't abort the transaction
+		db.locker.Lock(key)
+		db.expireIfNeeded(key)
+		watching[db.index][key] = db.GetVersion(key)
+		db.locker.UnLock(key)
+	}
+	return reply.MakeOKReply()
+}
+
+// unwatch forgets all watched keys
+func unwatch(conn resp.Connection) resp.Reply {
+	watching := conn.GetWatching()
+	for dbIndex := range watching {
+		delete(watching, dbIndex)
+	}
+	return reply.MakeOKReply()
+}
+
+// isWatchingChanged checks watched keys in their own db. Keys of other dbs aren't locked,
+// the transaction doesn't access them so a concurrent change can be regarded as happening after EXEC
+func isWatchingChanged(db *DB, watching map[int]map[string]uint64) bool {
+	for dbIndex, keys := range watching {
+		watchedDB := db
+		if dbIndex != db.index {
+			if db.getDB == nil {
+				return true
+			}
+			watchedDB = db.getDB(dbIndex)
+		}
+		for key, ver := range keys {
+			// like redis, a watched key expired after WATCH is regarded as changed,
+			// it's removed so that its version is updated even if it's never accessed
+			if watchedDB == db {
+				watchedDB.expireIfNeeded(key)
+			} else {
+				watchedDB.locker.Lock(key)
+				watchedDB.expireIfNeeded(key)
+				watchedDB.locker.UnLock(key)
+			}
+			if ver != watchedDB.GetVersion(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+	"net"
+	"testing"
+	"time"
+)
+
+func makeTestConn(t *testing.T) *connection.Connection {
+	server, client := net.Pipe()
+	c := connection.NewConn(server)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = c.Close()
+	})
+	return c
+}
+
+func TestExecMulti_WatchExpired(t *testing.T) {
+	tests := []struct {
+		name string
+		// expiration of the watched key is set before WATCH, the key is expired after sleep
+		beforeWatch, afterWatch time.Duration
+		aborted                 bool
+	}{
+		{"expired after watch", 0, 50 * time.Millisecond, true},
+		{"expired before watch", 50 * time.Millisecond, 0, false},
+	}
+	for _, tt := range tests {
+		db := makeDB()
+		c := makeTestConn(t)
+		db.Exec(c, utils.ToCmdLine("SET", "k", "v", "PX", "30"))
+		time.Sleep(tt.beforeWatch)
+		db.Exec(c, utils.ToCmdLine("WATCH", "k"))
+		time.Sleep(tt.afterWatch)
+		db.Exec(c, utils.ToCmdLine("MULTI"))
+		db.Exec(c, utils.ToCmdLine("SET", "other", "v"))
+		result := db.Exec(c, utils.ToCmdLine("EXEC"))
+		_, aborted := result.(*reply.NullMultiBulkReply)
+		if aborted != tt.aborted {
+			t.Errorf("%s: expected aborted %v, actually %q", tt.name, tt.aborted, result.ToBytes())
+		}
+		if _, exists := db.GetEntity("k"); exists {
+			t.Errorf("%s: expired key should be removed", tt.name)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,123 @@
+package dict
+
+import (
+	"go-redis/interface/datastruct"
+	"math/rand"
+)
+
+// SimpleDict wraps a map, it is not thread safe
+type SimpleDict struct {
+	m map[string]interface{}
+}
+
+// MakeSimpleDict makes a new map
+func MakeSimpleDict() *SimpleDict {
+	return &SimpleDict{
+		m: make(map[string]interface{}),
+	}
+}
+
+// Get returns the binding value and whether the key is exist
+func (dict *SimpleDict) Get(key string) (val interface{}, exists bool) {
+	val, ok := dict.m[key]
+	return val, ok
+}
+
+// Len returns the number of dict
+func (dict *SimpleDict) Len() int {
+	if dict.m == nil {
+		panic("m is nil")
+	}
+	return len(dict.m)
+}
+
+// Put puts key value into dict and returns the number of new inserted key-value
+func (dict *SimpleDict) Put(key string, val interface{}) (result int) {
+	_, existed := dict.m[key]
+	dict.m[key] = val
+	if existed {
+		return 0
+	}
+	return 1
+}
+
+// PutIfAbsent puts value if the key is not exists and returns the number of updated key-value
+func (dict *SimpleDict) PutIfAbsent(key string, val interface{}) (result int) {
+	_, existed := dict.m[key]
+	if existed {
+		return 0
+	}
+	dict.m[key] = val
+	return 1
+}
+
+// PutIfExists puts value if the key is exist and returns the number of inserted key-value
+func (dict *SimpleDict) PutIfExists(key string, val interface{}) (result int) {
+	_, existed := dict.m[key]
+	if existed {
+		dict.m[key] = val
+		return 1
+	}
+	return 0
+}
+
+// Remove removes the key and return the number of deleted key-value
+func (dict *SimpleDict) Remove(key string) (result int) {
+	_, existed := dict.m[key]
+	delete(dict.m, key)
+	if existed {
+		return 1
+	}
+	return 0
+}
+
+// Keys returns all keys in dict
+func (dict *SimpleDict) Keys() []string {
+	result := make([]string, len(dict.m))
+	i := 0
+	for k := range dict.m {
+		result[i] = k
+		i++
+	}
+	return result
+}
+
+// ForEach traversal the dict
+func (dict *SimpleDict) ForEach(consumer datastruct.Consumer) {
+	for k, v := range dict.m {
+		if !consumer(k, v) {
+			break
+		}
+	}
+}
+
+// RandomKeys randomly returns keys of the given number, may contain duplicated key
+func (dict *SimpleDict) RandomKeys(limit int) []string {
+	if len(dict.m) == 0 {
+		return nil
+	}
+	// order of map iteration isn't uniformly random, so keys are picked by random indexes
+	keys := dict.Keys()
+	result := make([]string, limit)
+	for i := range result {
+		result[i] = keys[rand.Intn(len(keys))]
+	}
+	return result
+}
+
+// RandomDistinctKeys randomly returns keys of the given number, won't contain duplicated key
+func (dict *SimpleDict) RandomDistinctKeys(limit int) []string {
+	keys := dict.Keys()
+	size := min(limit, len(keys))
+	// partial Fisher-Yates shuffle, the first size keys are chosen
+	for i := 0; i < size; i++ {
+		j := i + rand.Intn(len(keys)-i)
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+	return keys[:size]
+}
+
+// Clear removes all keys in dict
+func (dict *SimpleDict) Clear() {
+	*dict = *MakeSimpleDict()
+}
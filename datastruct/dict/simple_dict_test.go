@@ -0,0 +1,65 @@
+package dict
+
+import (
+	"strconv"
+	"testing"
+)
+
+func makeTestDict(size int) *SimpleDict {
+	dict := MakeSimpleDict()
+	for i := 0; i < size; i++ {
+		dict.Put("k"+strconv.Itoa(i), i)
+	}
+	return dict
+}
+
+// checkUniform checks each key is picked about the same times
+func checkUniform(t *testing.T, counts map[string]int, keys int, samples int) {
+	t.Helper()
+	if len(counts) != keys {
+		t.Fatalf("expected %d keys picked, actually %d", keys, len(counts))
+	}
+	expected := samples / keys
+	for key, count := range counts {
+		if count < expected*3/4 || count > expected*5/4 {
+			t.Errorf("key %s is picked %d times, expected about %d", key, count, expected)
+		}
+	}
+}
+
+func TestSimpleDict_RandomKeys(t *testing.T) {
+	dict := makeTestDict(3)
+	counts := make(map[string]int)
+	for _, key := range dict.RandomKeys(30000) {
+		counts[key]++
+	}
+	checkUniform(t, counts, 3, 30000)
+
+	if keys := MakeSimpleDict().RandomKeys(3); len(keys) != 0 {
+		t.Errorf("expected no keys of empty dict, actually %v", keys)
+	}
+}
+
+func TestSimpleDict_RandomDistinctKeys(t *testing.T) {
+	dict := makeTestDict(10)
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		keys := dict.RandomDistinctKeys(3)
+		if len(keys) != 3 {
+			t.Fatalf("expected 3 keys, actually %d", len(keys))
+		}
+		seen := make(map[string]bool)
+		for _, key := range keys {
+			if seen[key] {
+				t.Fatalf("duplicated key %s in %v", key, keys)
+			}
+			seen[key] = true
+			counts[key]++
+		}
+	}
+	checkUniform(t, counts, 10, 30000)
+
+	if keys := dict.RandomDistinctKeys(20); len(keys) != 10 {
+		t.Errorf("expected all the 10 keys, actually %d", len(keys))
+	}
+}
@@ -86,8 +86,7 @@ func (dict *SyncDict) Keys() []string {
 // ForEach traversal the dict
 func (dict *SyncDict) ForEach(consumer datastruct.Consumer) {
 	dict.m.Range(func(key, value interface{}) bool {
-		consumer(key.(string), value)
-		return true
+		return consumer(key.(string), value)
 	})
 }
 
@@ -122,6 +121,9 @@ func (dict *SyncDict) RandomDistinctKeys(limit int) []string {
 
 // Clear removes all keys in dict
 func (dict *SyncDict) Clear() {
-	// 旧dict交给gc处理
-	*dict = *MakeSyncDict()
+	// 不能直接替换sync.Map, 否则会和并发的读写产生竞争
+	dict.m.Range(func(key, value interface{}) bool {
+		dict.m.Delete(key)
+		return true
+	})
 }
@@ -0,0 +1,264 @@
+package list
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// makeTestList creates a list of 0, 1, ..., size-1 and its expected content
+func makeTestList(size int) (*QuickList, []interface{}) {
+	ql := MakeQuickList()
+	expected := make([]interface{}, 0, size)
+	for i := 0; i < size; i++ {
+		ql.Add(i)
+		expected = append(expected, i)
+	}
+	return ql, expected
+}
+
+// checkList checks elements and pages of ql, no page is empty or larger than pageSize
+func checkList(t *testing.T, ql *QuickList, expected []interface{}) {
+	t.Helper()
+	if ql.Len() != len(expected) {
+		t.Fatalf("expected length %d, actually %d", len(expected), ql.Len())
+	}
+	total := 0
+	for n := ql.data.Front(); n != nil; n = n.Next() {
+		page := n.Value.([]interface{})
+		if len(page) == 0 || len(page) > pageSize {
+			t.Fatalf("page of %d elements in list", len(page))
+		}
+		total += len(page)
+	}
+	if total != len(expected) {
+		t.Fatalf("expected %d elements in pages, actually %d", len(expected), total)
+	}
+	ql.ForEach(func(i int, actual interface{}) bool {
+		if actual != expected[i] {
+			t.Fatalf("index %d: expected %v, actually %v", i, expected[i], actual)
+		}
+		return true
+	})
+	// find searches from front or back depending on the index
+	for i := range expected {
+		if actual := ql.Get(i); actual != expected[i] {
+			t.Fatalf("get %d: expected %v, actually %v", i, expected[i], actual)
+		}
+	}
+}
+
+func insertAt(s []interface{}, index int, val interface{}) []interface{} {
+	s = append(s, nil)
+	copy(s[index+1:], s[index:])
+	s[index] = val
+	return s
+}
+
+func removeAt(s []interface{}, index int) []interface{} {
+	return append(s[:index], s[index+1:]...)
+}
+
+func TestQuickList_Add(t *testing.T) {
+	for _, size := range []int{0, 1, pageSize - 1, pageSize, pageSize + 1, 3 * pageSize} {
+		ql, expected := makeTestList(size)
+		checkList(t, ql, expected)
+		if pages := (size + pageSize - 1) / pageSize; ql.data.Len() != pages {
+			t.Errorf("size %d: expected %d pages, actually %d", size, pages, ql.data.Len())
+		}
+	}
+}
+
+func TestQuickList_InsertSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		index int
+	}{
+		{"head", 0},
+		{"end of first half", pageSize/2 - 1},
+		{"start of second half", pageSize / 2},
+		{"last of page", pageSize - 1},
+		{"tail", pageSize},
+	}
+	for _, tt := range tests {
+		ql, expected := makeTestList(pageSize)
+		ql.Insert(tt.index, -1)
+		expected = insertAt(expected, tt.index, -1)
+		checkList(t, ql, expected)
+		if ql.data.Len() != 2 {
+			t.Errorf("%s: expected 2 pages after inserting into a full page, actually %d", tt.name, ql.data.Len())
+		}
+		// following inserts go into half pages without split
+		ql.Insert(tt.index, -2)
+		expected = insertAt(expected, tt.index, -2)
+		checkList(t, ql, expected)
+		if ql.data.Len() != 2 {
+			t.Errorf("%s: expected 2 pages, actually %d", tt.name, ql.data.Len())
+		}
+	}
+}
+
+func TestQuickList_InsertSecondPage(t *testing.T) {
+	// the full page in the middle is split, pages behind it are kept
+	ql, expected := makeTestList(3 * pageSize)
+	for _, index := range []int{pageSize, 2*pageSize - 1, pageSize + pageSize/2} {
+		ql.Insert(index, -index)
+		expected = insertAt(expected, index, -index)
+		checkList(t, ql, expected)
+	}
+	ql.Add(-1)
+	expected = append(expected, -1)
+	checkList(t, ql, expected)
+}
+
+func TestQuickList_RemovePage(t *testing.T) {
+	tests := []struct {
+		name string
+		// index returns the index to remove at the i-th time
+		index func(ql *QuickList, i int) int
+	}{
+		{"head", func(ql *QuickList, i int) int { return 0 }},
+		{"tail", func(ql *QuickList, i int) int { return ql.Len() - 1 }},
+		{"first of second page", func(ql *QuickList, i int) int { return pageSize }},
+		{"last of first page", func(ql *QuickList, i int) int { return pageSize - 1 - i }},
+	}
+	for _, tt := range tests {
+		// removing every element of a page drops the page
+		ql, expected := makeTestList(3 * pageSize)
+		for i := 0; i < pageSize; i++ {
+			index := tt.index(ql, i)
+			if removed := ql.Remove(index); removed != expected[index] {
+				t.Fatalf("%s: expected %v removed, actually %v", tt.name, expected[index], removed)
+			}
+			expected = removeAt(expected, index)
+		}
+		checkList(t, ql, expected)
+		if ql.data.Len() != 2 {
+			t.Errorf("%s: expected 2 pages, actually %d", tt.name, ql.data.Len())
+		}
+	}
+}
+
+func TestQuickList_RemoveLast(t *testing.T) {
+	ql, expected := makeTestList(pageSize + 1)
+	for len(expected) > 0 {
+		if removed := ql.RemoveLast(); removed != expected[len(expected)-1] {
+			t.Fatalf("expected %v removed, actually %v", expected[len(expected)-1], removed)
+		}
+		expected = expected[:len(expected)-1]
+		if len(expected) == pageSize {
+			checkList(t, ql, expected)
+		}
+	}
+	checkList(t, ql, expected)
+	if ql.RemoveLast() != nil {
+		t.Error("expected nil from empty list")
+	}
+	// the list is still usable after all pages are removed
+	ql.Add(1)
+	checkList(t, ql, []interface{}{1})
+}
+
+func TestQuickList_RemoveByVal(t *testing.T) {
+	isOdd := func(a interface{}) bool {
+		return a.(int)%2 == 1
+	}
+	filter := func(s []interface{}, count int, reverse bool) []interface{} {
+		var result []interface{}
+		removed := 0
+		for i := range s {
+			if reverse {
+				i = len(s) - 1 - i
+			}
+			if isOdd(s[i]) && (count <= 0 || removed < count) {
+				removed++
+				continue
+			}
+			result = append(result, s[i])
+		}
+		if reverse {
+			for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+				result[i], result[j] = result[j], result[i]
+			}
+		}
+		return result
+	}
+
+	size := 2*pageSize + 3
+	ql, expected := makeTestList(size)
+	if removed := ql.RemoveByVal(isOdd, 10); removed != 10 {
+		t.Errorf("expected 10 removed, actually %d", removed)
+	}
+	expected = filter(expected, 10, false)
+	checkList(t, ql, expected)
+
+	if removed := ql.ReverseRemoveByVal(isOdd, 10); removed != 10 {
+		t.Errorf("expected 10 removed, actually %d", removed)
+	}
+	expected = filter(expected, 10, true)
+	checkList(t, ql, expected)
+
+	if removed := ql.RemoveAllByVal(isOdd); removed != size/2-20 {
+		t.Errorf("expected %d removed, actually %d", size/2-20, removed)
+	}
+	expected = filter(expected, 0, false)
+	checkList(t, ql, expected)
+
+	// every page is emptied
+	all := func(a interface{}) bool { return true }
+	if removed := ql.ReverseRemoveByVal(all, len(expected)); removed != len(expected) {
+		t.Errorf("expected %d removed, actually %d", len(expected), removed)
+	}
+	checkList(t, ql, nil)
+	if ql.data.Len() != 0 {
+		t.Errorf("expected no pages, actually %d", ql.data.Len())
+	}
+}
+
+func TestQuickList_Range(t *testing.T) {
+	ql, expected := makeTestList(2*pageSize + 1)
+	tests := [][2]int{
+		{0, 1},
+		{pageSize - 1, pageSize + 1},
+		{pageSize, 2 * pageSize},
+		{0, len(expected)},
+		{len(expected) - 1, len(expected)},
+	}
+	for _, tt := range tests {
+		actual := ql.Range(tt[0], tt[1])
+		if len(actual) != tt[1]-tt[0] {
+			t.Fatalf("range [%d, %d): expected %d elements, actually %d", tt[0], tt[1], tt[1]-tt[0], len(actual))
+		}
+		for i, val := range actual {
+			if val != expected[tt[0]+i] {
+				t.Fatalf("range [%d, %d): index %d expected %v, actually %v", tt[0], tt[1], i, expected[tt[0]+i], val)
+			}
+		}
+	}
+}
+
+func TestQuickList_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ql, expected := makeTestList(0)
+	for i := 0; i < 20000; i++ {
+		switch op := r.Intn(10); {
+		case op < 4:
+			index := r.Intn(len(expected) + 1)
+			ql.Insert(index, i)
+			expected = insertAt(expected, index, i)
+		case op < 6:
+			ql.Add(i)
+			expected = append(expected, i)
+		case op < 8 && len(expected) > 0:
+			index := r.Intn(len(expected))
+			if removed := ql.Remove(index); removed != expected[index] {
+				t.Fatalf("remove %d: expected %v, actually %v", index, expected[index], removed)
+			}
+			expected = removeAt(expected, index)
+		case len(expected) > 0:
+			index := r.Intn(len(expected))
+			ql.Set(index, -i)
+			expected[index] = -i
+		}
+	}
+	checkList(t, ql, expected)
+}
@@ -0,0 +1,85 @@
+package sortedset
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+/*
+ * ScoreBorder is a struct represents `min` `max` parameter of redis command `ZRANGEBYSCORE`
+ * can accept:
+ *   int or float value, such as 2.718, 2, -2.718, -2 ...
+ *   exclusive int or float value, such as (2.718, (2, (-2.718, (-2 ...
+ *   infinity: +inf, -inf， inf(same as +inf)
+ */
+
+const (
+	scoreNegativeInf int8 = -1
+	scorePositiveInf int8 = 1
+)
+
+// ScoreBorder represents range of a float value, including: <, <=, >, >=, +inf, -inf
+type ScoreBorder struct {
+	Inf     int8
+	Value   float64
+	Exclude bool
+}
+
+// satisfyMin returns true if value is not less than the border, which is used as the lower bound
+func (border *ScoreBorder) satisfyMin(value float64) bool {
+	if border.Inf == scoreNegativeInf {
+		return true
+	} else if border.Inf == scorePositiveInf {
+		return false
+	}
+	if border.Exclude {
+		return value > border.Value
+	}
+	return value >= border.Value
+}
+
+// satisfyMax returns true if value is not greater than the border, which is used as the upper bound
+func (border *ScoreBorder) satisfyMax(value float64) bool {
+	if border.Inf == scorePositiveInf {
+		return true
+	} else if border.Inf == scoreNegativeInf {
+		return false
+	}
+	if border.Exclude {
+		return value < border.Value
+	}
+	return value <= border.Value
+}
+
+var positiveInfBorder = &ScoreBorder{
+	Inf: scorePositiveInf,
+}
+
+var negativeInfBorder = &ScoreBorder{
+	Inf: scoreNegativeInf,
+}
+
+// ParseScoreBorder creates ScoreBorder from redis arguments
+func ParseScoreBorder(s string) (*ScoreBorder, error) {
+	if s == "inf" || s == "+inf" {
+		return positiveInfBorder, nil
+	}
+	if s == "-inf" {
+		return negativeInfBorder, nil
+	}
+	exclude := false
+	if len(s) > 0 && s[0] == '(' {
+		exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	// NaN can't be compared with scores
+	if err != nil || math.IsNaN(value) {
+		return nil, errors.New("ERR min or max is not a float")
+	}
+	return &ScoreBorder{
+		Value:   value,
+		Exclude: exclude,
+	}, nil
+}
@@ -0,0 +1,55 @@
+package sortedset
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseScoreBorder(t *testing.T) {
+	tests := []struct {
+		s       string
+		ok      bool
+		min     []float64 // values satisfying the border as min
+		notMin  []float64
+		exclude bool
+	}{
+		{"1.5", true, []float64{1.5, 2}, []float64{1}, false},
+		{"(1.5", true, []float64{2}, []float64{1.5, 1}, true},
+		{"-inf", true, []float64{math.Inf(-1), -1e300}, nil, false},
+		{"+inf", true, nil, []float64{1e300}, false},
+		{"inf", true, nil, []float64{1e300}, false},
+		{"(-2", true, []float64{-1}, []float64{-2}, true},
+		{"nan", false, nil, nil, false},
+		{"NaN", false, nil, nil, false},
+		{"(nan", false, nil, nil, false},
+		{"(", false, nil, nil, false},
+		{"", false, nil, nil, false},
+		{"abc", false, nil, nil, false},
+	}
+	for _, tt := range tests {
+		border, err := ParseScoreBorder(tt.s)
+		if !tt.ok {
+			if err == nil || err.Error() != "ERR min or max is not a float" {
+				t.Errorf("%q: expected not a float, actually %v", tt.s, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.s, err)
+			continue
+		}
+		if border.Exclude != tt.exclude {
+			t.Errorf("%q: expected exclude %v, actually %v", tt.s, tt.exclude, border.Exclude)
+		}
+		for _, v := range tt.min {
+			if !border.satisfyMin(v) {
+				t.Errorf("%q: %v should satisfy the min border", tt.s, v)
+			}
+		}
+		for _, v := range tt.notMin {
+			if border.satisfyMin(v) {
+				t.Errorf("%q: %v shouldn't satisfy the min border", tt.s, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// sortElements sorts elements by score then member, as the order of skiplist
+func sortElements(elements []Element) {
+	sort.Slice(elements, func(i, j int) bool {
+		a, b := elements[i], elements[j]
+		return a.Score < b.Score || (a.Score == b.Score && a.Member < b.Member)
+	})
+}
+
+// checkSkiplist checks order, backward pointers and spans of every level
+func checkSkiplist(t *testing.T, sl *skiplist, expected []Element) {
+	t.Helper()
+	if sl.length != int64(len(expected)) {
+		t.Fatalf("expected length %d, actually %d", len(expected), sl.length)
+	}
+	rankOf := make(map[*node]int64)
+	var prev *node
+	var rank int64
+	for n := sl.header.level[0].forward; n != nil; n = n.level[0].forward {
+		if rank >= int64(len(expected)) || n.Element != expected[rank] {
+			t.Fatalf("rank %d: unexpected %+v", rank+1, n.Element)
+		}
+		if n.backward != prev {
+			t.Fatalf("rank %d: wrong backward pointer", rank+1)
+		}
+		rank++
+		rankOf[n] = rank
+		prev = n
+	}
+	if sl.tail != prev {
+		t.Fatal("wrong tail")
+	}
+	for level := int16(0); level < sl.level; level++ {
+		var from int64
+		for n := sl.header; n != nil; n = n.level[level].forward {
+			next := n.level[level].forward
+			to := sl.length
+			if next != nil {
+				to = rankOf[next]
+			}
+			if next != nil && n.level[level].span != to-from {
+				t.Fatalf("level %d, rank %d: expected span %d, actually %d", level, from, to-from, n.level[level].span)
+			}
+			from = to
+		}
+	}
+	for level := sl.level; level < maxLevel; level++ {
+		if sl.header.level[level].forward != nil {
+			t.Fatalf("level %d is used above the level of skiplist %d", level, sl.level)
+		}
+	}
+}
+
+func TestSkiplist_Rank(t *testing.T) {
+	sl := makeSkiplist()
+	members := make(map[string]float64)
+	for i := 0; i < 5000; i++ {
+		member := "m" + strconv.Itoa(rand.Intn(1000))
+		if score, ok := members[member]; ok && rand.Intn(2) == 0 {
+			if !sl.remove(member, score) {
+				t.Fatalf("%s is not removed", member)
+			}
+			delete(members, member)
+			continue
+		}
+		if score, ok := members[member]; ok {
+			sl.remove(member, score)
+		}
+		// few distinct scores, so that members with the same score are ordered by member
+		score := float64(rand.Intn(50))
+		sl.insert(member, score)
+		members[member] = score
+	}
+	if sl.remove("missing", 0) {
+		t.Error("missing member is removed")
+	}
+
+	expected := make([]Element, 0, len(members))
+	for member, score := range members {
+		expected = append(expected, Element{Member: member, Score: score})
+	}
+	sortElements(expected)
+	checkSkiplist(t, sl, expected)
+	for i, e := range expected {
+		rank := int64(i + 1)
+		if actual := sl.getRank(e.Member, e.Score); actual != rank {
+			t.Errorf("%s: expected rank %d, actually %d", e.Member, rank, actual)
+		}
+		if n := sl.getByRank(rank); n == nil || n.Element != e {
+			t.Errorf("rank %d: expected %+v, actually %+v", rank, e, n)
+		}
+	}
+	if rank := sl.getRank("missing", 1); rank != 0 {
+		t.Errorf("expected rank 0 of missing member, actually %d", rank)
+	}
+	if n := sl.getByRank(int64(len(expected)) + 1); n != nil {
+		t.Errorf("expected nil out of range, actually %+v", n.Element)
+	}
+}
+
+// makeTestSkiplist inserts members "a" to "j" with scores 1, 1, 2, 2, ..., 5, 5
+func makeTestSkiplist() (*skiplist, []Element) {
+	sl := makeSkiplist()
+	var elements []Element
+	for i := 0; i < 10; i++ {
+		e := Element{Member: string(rune('a' + i)), Score: float64(i/2 + 1)}
+		elements = append(elements, e)
+	}
+	// inserted out of order
+	for _, i := range rand.Perm(len(elements)) {
+		sl.insert(elements[i].Member, elements[i].Score)
+	}
+	return sl, elements
+}
+
+func TestSkiplist_RemoveRangeByRank(t *testing.T) {
+	tests := []struct {
+		start, stop int64 // 1-based, [start, stop)
+	}{
+		{1, 2},
+		{1, 11},
+		{10, 11},
+		{3, 5},
+		{5, 100},
+		{11, 12},
+	}
+	for _, tt := range tests {
+		sl, elements := makeTestSkiplist()
+		removed := sl.RemoveRangeByRank(tt.start, tt.stop)
+		from, to := min(tt.start-1, 10), min(tt.stop-1, 10)
+		if int64(len(removed)) != to-from {
+			t.Fatalf("[%d, %d): expected %d removed, actually %d", tt.start, tt.stop, to-from, len(removed))
+		}
+		for i, e := range removed {
+			if *e != elements[from+int64(i)] {
+				t.Errorf("[%d, %d): expected %+v removed, actually %+v", tt.start, tt.stop, elements[from+int64(i)], *e)
+			}
+		}
+		checkSkiplist(t, sl, append(elements[:from:from], elements[to:]...))
+	}
+}
+
+func TestSkiplist_ScoreRange(t *testing.T) {
+	sl, elements := makeTestSkiplist()
+	set := &SortedSet{skiplist: sl, dict: make(map[string]*Element)}
+	for i := range elements {
+		set.dict[elements[i].Member] = &elements[i]
+	}
+	border := func(s string) *ScoreBorder {
+		b, err := ParseScoreBorder(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	tests := []struct {
+		min, max string
+		// expected members in range
+		members string
+	}{
+		{"-inf", "+inf", "abcdefghij"},
+		{"1", "1", "ab"},
+		{"(1", "2", "cd"},
+		{"1", "(2", "ab"},
+		{"(1", "(3", "cd"},
+		{"2.5", "4.5", "efgh"},
+		{"5", "+inf", "ij"},
+		{"(5", "+inf", ""},
+		{"-inf", "(1", ""},
+		{"0", "0.5", ""},
+		{"6", "7", ""},
+		{"3", "2", ""},
+		{"(3", "3", ""},
+		{"+inf", "+inf", ""},
+		{"-inf", "-inf", ""},
+	}
+	for _, tt := range tests {
+		min, max := border(tt.min), border(tt.max)
+		first, last := sl.getFirstInScoreRange(min, max), sl.getLastInScoreRange(min, max)
+		if tt.members == "" {
+			if first != nil || last != nil {
+				t.Errorf("[%s, %s]: expected empty range, actually %v and %v", tt.min, tt.max, first, last)
+			}
+		} else if first == nil || last == nil ||
+			first.Member != tt.members[:1] || last.Member != tt.members[len(tt.members)-1:] {
+			t.Errorf("[%s, %s]: expected %s to %s, actually %v and %v",
+				tt.min, tt.max, tt.members[:1], tt.members[len(tt.members)-1:], first, last)
+		}
+		if count := set.Count(min, max); count != int64(len(tt.members)) {
+			t.Errorf("[%s, %s]: expected count %d, actually %d", tt.min, tt.max, len(tt.members), count)
+		}
+
+		// offset and limit are applied in the order of range
+		for _, desc := range []bool{false, true} {
+			expected := []byte(tt.members)
+			if desc {
+				sort.Slice(expected, func(i, j int) bool { return expected[i] > expected[j] })
+			}
+			for _, offset := range []int64{0, 1, 3} {
+				for _, limit := range []int64{-1, 1, 2} {
+					want := ""
+					if int(offset) < len(expected) {
+						want = string(expected[offset:])
+						if limit >= 0 && int(limit) < len(want) {
+							want = want[:limit]
+						}
+					}
+					actual := ""
+					for _, e := range set.RangeByScore(min, max, offset, limit, desc) {
+						actual += e.Member
+					}
+					if actual != want {
+						t.Errorf("[%s, %s] offset %d limit %d desc %v: expected %q, actually %q",
+							tt.min, tt.max, offset, limit, desc, want, actual)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package sortedset
+
+import "strconv"
+
+// SortedSet is a set which keys sorted by bound score
+type SortedSet struct {
+	dict     map[string]*Element
+	skiplist *skiplist
+}
+
+// Make makes a new SortedSet
+func Make() *SortedSet {
+	return &SortedSet{
+		dict:     make(map[string]*Element),
+		skiplist: makeSkiplist(),
+	}
+}
+
+// Add puts member into set,  and returns whether has inserted new node
+func (sortedSet *SortedSet) Add(member string, score float64) bool {
+	element, ok := sortedSet.dict[member]
+	sortedSet.dict[member] = &Element{
+		Member: member,
+		Score:  score,
+	}
+	if ok {
+		if score != element.Score {
+			sortedSet.skiplist.remove(member, element.Score)
+			sortedSet.skiplist.insert(member, score)
+		}
+		return false
+	}
+	sortedSet.skiplist.insert(member, score)
+	return true
+}
+
+// Len returns number of members in set
+func (sortedSet *SortedSet) Len() int64 {
+	return int64(len(sortedSet.dict))
+}
+
+// Get returns the given member
+func (sortedSet *SortedSet) Get(member string) (element *Element, ok bool) {
+	element, ok = sortedSet.dict[member]
+	if !ok {
+		return nil, false
+	}
+	return element, true
+}
+
+// Remove removes the given member from set
+func (sortedSet *SortedSet) Remove(member string) bool {
+	v, ok := sortedSet.dict[member]
+	if ok {
+		sortedSet.skiplist.remove(member, v.Score)
+		delete(sortedSet.dict, member)
+		return true
+	}
+	return false
+}
+
+// GetRank returns the 0-based rank of the given member, sort by ascending order, rank starts from 0
+// returns -1 if the member not exists
+func (sortedSet *SortedSet) GetRank(member string, desc bool) (rank int64) {
+	element, ok := sortedSet.dict[member]
+	if !ok {
+		return -1
+	}
+	r := sortedSet.skiplist.getRank(member, element.Score)
+	if desc {
+		r = sortedSet.skiplist.length - r
+	} else {
+		r--
+	}
+	return r
+}
+
+// ForEachByRank visits each member which rank within [start, stop), sort by ascending order, rank starts from 0
+func (sortedSet *SortedSet) ForEachByRank(start int64, stop int64, desc bool, consumer func(element *Element) bool) {
+	size := sortedSet.Len()
+	if start < 0 || start >= size {
+		panic("illegal start " + strconv.FormatInt(start, 10))
+	}
+	if stop < start || stop > size {
+		panic("illegal end " + strconv.FormatInt(stop, 10))
+	}
+
+	// find start node
+	var n *node
+	if desc {
+		n = sortedSet.skiplist.tail
+		if start > 0 {
+			n = sortedSet.skiplist.getByRank(size - start)
+		}
+	} else {
+		n = sortedSet.skiplist.header.level[0].forward
+		if start > 0 {
+			n = sortedSet.skiplist.getByRank(start + 1)
+		}
+	}
+
+	sliceSize := int(stop - start)
+	for i := 0; i < sliceSize; i++ {
+		if !consumer(&n.Element) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// RangeByRank returns members which rank within [start, stop), sort by ascending order, rank starts from 0
+func (sortedSet *SortedSet) RangeByRank(start int64, stop int64, desc bool) []*Element {
+	sliceSize := int(stop - start)
+	slice := make([]*Element, sliceSize)
+	i := 0
+	sortedSet.ForEachByRank(start, stop, desc, func(element *Element) bool {
+		slice[i] = element
+		i++
+		return true
+	})
+	return slice
+}
+
+// Count returns the number of  members which score within the given border
+func (sortedSet *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
+	first := sortedSet.skiplist.getFirstInScoreRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := sortedSet.skiplist.getLastInScoreRange(min, max)
+	if last == nil {
+		return 0
+	}
+	firstRank := sortedSet.skiplist.getRank(first.Member, first.Score)
+	lastRank := sortedSet.skiplist.getRank(last.Member, last.Score)
+	return lastRank - firstRank + 1
+}
+
+// ForEachByScore visits members which score within the given border
+// limit < 0 means no limit
+func (sortedSet *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	// find start node
+	var n *node
+	if desc {
+		n = sortedSet.skiplist.getLastInScoreRange(min, max)
+	} else {
+		n = sortedSet.skiplist.getFirstInScoreRange(min, max)
+	}
+
+	for n != nil && offset > 0 {
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+		offset--
+	}
+
+	// A negative limit returns all elements from the offset
+	for i := 0; (i < int(limit) || limit < 0) && n != nil; i++ {
+		if !min.satisfyMin(n.Score) || !max.satisfyMax(n.Score) {
+			break // break loop if out of range
+		}
+		if !consumer(&n.Element) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// RangeByScore returns members which score within the given border
+// limit < 0 means no limit
+func (sortedSet *SortedSet) RangeByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool) []*Element {
+	if limit == 0 || offset < 0 {
+		return make([]*Element, 0)
+	}
+	slice := make([]*Element, 0)
+	sortedSet.ForEachByScore(min, max, offset, limit, desc, func(element *Element) bool {
+		slice = append(slice, element)
+		return true
+	})
+	return slice
+}
+
+// RemoveByRank removes member ranking within [start, stop)
+// sort by ascending order and rank starts from 0
+func (sortedSet *SortedSet) RemoveByRank(start int64, stop int64) int64 {
+	removed := sortedSet.skiplist.RemoveRangeByRank(start+1, stop+1)
+	for _, element := range removed {
+		delete(sortedSet.dict, element.Member)
+	}
+	return int64(len(removed))
+}
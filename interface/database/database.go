@@ -9,9 +9,24 @@ type CmdLine = [][]byte
 type Database interface {
 	Exec(client resp.Connection, args [][]byte) resp.Reply
 	AfterClientClose(c resp.Connection)
+	// PrepareShutdown persists data before the server exits, the shutdown is aborted if it returns error.
+	// Close is called after it
+	PrepareShutdown(mode SaveMode) error
 	Close()
 }
 
+// SaveMode decides whether to save a snapshot before shutdown
+type SaveMode int
+
+const (
+	// SaveDefault saves a snapshot only if save rules are configured
+	SaveDefault SaveMode = iota
+	// SaveForced always saves a snapshot, such as SHUTDOWN SAVE
+	SaveForced
+	// SaveDisabled never saves a snapshot, such as SHUTDOWN NOSAVE
+	SaveDisabled
+)
+
 // DataEntity stores data bound to a key, including a string, list, hash, set and so on
 type DataEntity struct {
 	Data interface{}
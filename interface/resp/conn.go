@@ -1,7 +1,36 @@
 package resp
 
+// protocol versions negotiated by HELLO
+const (
+	Resp2 = 2
+	Resp3 = 3
+)
+
 type Connection interface {
 	Write([]byte) error
+	Close() error
 	GetDBIndex() int
 	SelectDB(int)
+
+	// name of the authenticated user
+	SetUser(string)
+	GetUser() string
+
+	// protocol version, Resp2 by default
+	SetProtocol(int)
+	GetProtocol() int
+	// name set by HELLO SETNAME
+	SetName(string)
+	GetName() string
+
+	// used for multi command
+	InMultiState() bool
+	SetMultiState(bool)
+	GetQueuedCmdLine() [][][]byte
+	EnqueueCmd([][]byte)
+	ClearQueuedCmds()
+	// db index -> watched key -> version
+	GetWatching() map[int]map[string]uint64
+	AddTxError(err error)
+	GetTxErrors() []error
 }
@@ -8,3 +8,9 @@ type ErrorReply interface {
 	Error() string
 	ToBytes() []byte
 }
+
+// Resp3Reply is implemented by replies encoded differently in RESP3, ToBytes returns RESP2 encoding of them
+type Resp3Reply interface {
+	Reply
+	ToResp3Bytes() []byte
+}
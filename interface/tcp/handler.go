@@ -9,3 +9,9 @@ type Handler interface {
 	Handle(ctx context.Context, conn net.Conn)
 	Close() error
 }
+
+// Shutdowner is implemented by handlers able to stop the server, such as the SHUTDOWN command of redis
+type Shutdowner interface {
+	// ShutdownRequested is closed when the handler asks the server to shut down
+	ShutdownRequested() <-chan struct{}
+}
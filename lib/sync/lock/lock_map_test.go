@@ -0,0 +1,160 @@
+package lock
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// collidingKeys returns two different keys in the same slot
+func collidingKeys(locks *Locks) (string, string) {
+	first := "k0"
+	for i := 1; ; i++ {
+		key := "k" + strconv.Itoa(i)
+		if locks.spread(fnv32(key)) == locks.spread(fnv32(first)) {
+			return first, key
+		}
+	}
+}
+
+func TestLocks_toLockIndices(t *testing.T) {
+	locks := Make(16)
+	a, b := collidingKeys(locks)
+	keys := []string{"x", a, "y", b, "x", "z"}
+	for _, reverse := range []bool{false, true} {
+		indices := locks.toLockIndices(keys, reverse)
+		seen := make(map[uint32]bool)
+		for i, index := range indices {
+			if seen[index] {
+				t.Fatalf("duplicated index %d in %v", index, indices)
+			}
+			seen[index] = true
+			if i > 0 && (indices[i-1] < index) == reverse {
+				t.Fatalf("indices %v are not sorted, reverse %v", indices, reverse)
+			}
+		}
+		for _, key := range keys {
+			if !seen[locks.spread(fnv32(key))] {
+				t.Fatalf("index of %s is missing in %v", key, indices)
+			}
+		}
+	}
+}
+
+func TestLocks_RWLocks(t *testing.T) {
+	locks := Make(16)
+	write, read := collidingKeys(locks)
+	// the slot shared by a write key and a read key is locked exclusively
+	locks.RWLocks([]string{write}, []string{read, read})
+	if locks.table[locks.spread(fnv32(read))].TryRLock() {
+		t.Fatal("slot of write key is shared")
+	}
+	locks.RWUnLocks([]string{write}, []string{read, read})
+	mu := locks.table[locks.spread(fnv32(read))]
+	if !mu.TryLock() {
+		t.Fatal("slot is not released")
+	}
+	mu.Unlock()
+
+	// read keys are shared
+	locks.RWLocks(nil, []string{read})
+	locks.RLocks(read, write)
+	locks.RUnLocks(read, write)
+	locks.RWUnLocks(nil, []string{read})
+	if !mu.TryLock() {
+		t.Fatal("slot is not released")
+	}
+	mu.Unlock()
+
+	locks.LockAll()
+	for i, mu := range locks.table {
+		if mu.TryRLock() {
+			t.Fatalf("slot %d is not locked by LockAll", i)
+		}
+	}
+	locks.UnLockAll()
+	for i, mu := range locks.table {
+		if !mu.TryLock() {
+			t.Fatalf("slot %d is not released by UnLockAll", i)
+		}
+		mu.Unlock()
+	}
+}
+
+// TestLocks_Concurrent locks overlapping keys in random order, it deadlocks if the order of slots isn't kept
+func TestLocks_Concurrent(t *testing.T) {
+	locks := Make(8)
+	keys := make([]string, 32)
+	for i := range keys {
+		keys[i] = "k" + strconv.Itoa(i)
+	}
+	// writers of each key, -1 for each reader
+	holders := make([]int32, len(keys))
+	pick := func(r *rand.Rand, n int) []string {
+		picked := make([]string, n)
+		for i := range picked {
+			picked[i] = keys[r.Intn(len(keys))]
+		}
+		return picked
+	}
+	index := func(key string) int {
+		i, _ := strconv.Atoi(key[1:])
+		return i
+	}
+
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 2000; i++ {
+				writeKeys, readKeys := pick(r, r.Intn(4)), pick(r, r.Intn(4))
+				if r.Intn(100) == 0 {
+					locks.LockAll()
+					locks.UnLockAll()
+					continue
+				}
+				locks.RWLocks(writeKeys, readKeys)
+				written := make(map[string]bool)
+				for _, key := range writeKeys {
+					if !written[key] && atomic.AddInt32(&holders[index(key)], 1) != 1 {
+						failed.Store(true)
+					}
+					written[key] = true
+				}
+				for _, key := range readKeys {
+					if !written[key] && atomic.AddInt32(&holders[index(key)], -1) > 0 {
+						failed.Store(true)
+					}
+				}
+				for _, key := range readKeys {
+					if !written[key] {
+						atomic.AddInt32(&holders[index(key)], 1)
+					}
+				}
+				for key := range written {
+					atomic.AddInt32(&holders[index(key)], -1)
+				}
+				locks.RWUnLocks(writeKeys, readKeys)
+			}
+		}(int64(g))
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("dead lock")
+	}
+	if failed.Load() {
+		t.Error("a written key is held by others at the same time")
+	}
+}
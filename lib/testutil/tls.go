@@ -0,0 +1,107 @@
+// Package testutil provides helpers shared by tests of several packages
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"go-redis/interface/tcp"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Cert is a certificate generated for tests, its files are in a temporary directory
+type Cert struct {
+	Cert     *x509.Certificate
+	Key      *ecdsa.PrivateKey
+	CertFile string
+	KeyFile  string
+}
+
+// MakeCert creates a certificate valid for 127.0.0.1 signed by parent, parent nil means a self-signed CA
+func MakeCert(t testing.TB, name string, parent *Cert) *Cert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	c := &Cert{
+		Cert:     cert,
+		Key:      key,
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	writePEM(t, c.CertFile, "CERTIFICATE", der)
+	writePEM(t, c.KeyFile, "EC PRIVATE KEY", keyDer)
+	return c
+}
+
+func writePEM(t testing.TB, file string, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ServeFunc serves handler on listeners until closeChan is signaled, such as tcp.ListenAndServe
+type ServeFunc func(listeners []net.Listener, handler tcp.Handler, closeChan chan struct{})
+
+// StartTLSServer runs serve with handler on a TLS listener of loopback and returns its address,
+// the server is stopped when the test finishes
+func StartTLSServer(t testing.TB, tlsConfig *tls.Config, serve ServeFunc, handler tcp.Handler) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		serve([]net.Listener{tls.NewListener(listener, tlsConfig)}, handler, closeChan)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		closeChan <- struct{}{}
+		<-done
+	})
+	return listener.Addr().String()
+}
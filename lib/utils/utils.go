@@ -37,3 +37,13 @@ func BytesEquals(a []byte, b []byte) bool {
 	}
 	return true
 }
+
+// Equals check whether the given value is equal
+func Equals(a interface{}, b interface{}) bool {
+	sliceA, okA := a.([]byte)
+	sliceB, okB := b.([]byte)
+	if okA && okB {
+		return BytesEquals(sliceA, sliceB)
+	}
+	return a == b
+}
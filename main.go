@@ -2,26 +2,113 @@ package main
 
 import (
 	"fmt"
+	"go-redis/aof"
 	"go-redis/config"
+	"go-redis/database"
 	"go-redis/lib/logger"
 	"go-redis/resp/handler"
 	"go-redis/tcp"
 	"os"
+	"strconv"
+	"time"
 )
 
 const configFile string = "redis.conf"
 
-var defaultProperties = &config.ServerProperties{
-	Bind: "0.0.0.0",
-	Port: 6379,
-}
-
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	return err == nil && !info.IsDir()
 }
 
+// checkAof validates an aof file, usage: check-aof [--fix] <file>
+func checkAof(args []string) int {
+	fix := false
+	filename := ""
+	for _, arg := range args {
+		if arg == "--fix" {
+			fix = true
+		} else {
+			filename = arg
+		}
+	}
+	if filename == "" {
+		fmt.Println("Usage: check-aof [--fix] <file.aof|file.rdb>")
+		return 1
+	}
+	result, err := aof.CheckAof(filename, fix)
+	if err != nil {
+		fmt.Println("Cannot check " + filename + ": " + err.Error())
+		return 1
+	}
+	fmt.Printf("AOF analyzed: filename=%s, size=%d, ok_up_to=%d, diff=%d\n",
+		filename, result.Size, result.ValidSize, result.Size-result.ValidSize)
+	if result.Err == nil {
+		fmt.Println("AOF is valid")
+		return 0
+	}
+	fmt.Println("AOF is not valid: " + result.Err.Error())
+	if !fix {
+		fmt.Println("Use the --fix option to try fixing it.")
+		return 1
+	}
+	fmt.Printf("Successfully truncated AOF %s to %d bytes\n", filename, result.ValidSize)
+	return 0
+}
+
+// truncateAof copies aof up to a point in time, usage: truncate-aof <unix-time> <file.aof|file.manifest> <output>
+func truncateAof(args []string) int {
+	if len(args) != 3 {
+		fmt.Println("Usage: truncate-aof <unix-time> <file.aof|file.manifest> <output>")
+		return 1
+	}
+	timestamp, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || timestamp <= 0 {
+		fmt.Println("Invalid timestamp: " + args[0])
+		return 1
+	}
+	if err := aof.TruncateToTimestamp(args[1], args[2], timestamp); err != nil {
+		fmt.Println("Cannot truncate " + args[1] + ": " + err.Error())
+		return 1
+	}
+	fmt.Printf("Successfully copied AOF %s to %s up to timestamp %d\n", args[1], args[2], timestamp)
+	return 0
+}
+
+// importRdb loads a rdb file such as a dump.rdb of redis into the data files configured by redis.conf,
+// usage: import-rdb <file.rdb>
+func importRdb(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("Usage: import-rdb <file.rdb>")
+		return 1
+	}
+	setupConfig()
+	if err := database.ImportDump(args[0]); err != nil {
+		fmt.Println("Cannot import " + args[0] + ": " + err.Error())
+		return 1
+	}
+	fmt.Println("Successfully imported " + args[0])
+	return 0
+}
+
+func setupConfig() {
+	if fileExists(configFile) {
+		config.SetupConfig(configFile)
+	} else {
+		config.Properties = config.DefaultProperties()
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check-aof" {
+		os.Exit(checkAof(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "truncate-aof" {
+		os.Exit(truncateAof(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import-rdb" {
+		os.Exit(importRdb(os.Args[2:]))
+	}
+
 	logger.Setup(&logger.Settings{
 		Path:       "logs",
 		Name:       "godis",
@@ -29,19 +116,26 @@ func main() {
 		TimeFormat: "2006-01-02",
 	})
 
-	if fileExists(configFile) {
-		config.SetupConfig(configFile)
-	} else {
-		config.Properties = defaultProperties
-	}
+	setupConfig()
 
-	err := tcp.ListenAndServeWithSignal(
-		&tcp.Config{
-			Address: fmt.Sprintf("%s:%d",
-				config.Properties.Bind,
-				config.Properties.Port),
-		},
-		handler.MakeHandler())
+	cfg := &tcp.Config{
+		KeepAlive: time.Duration(config.Properties.TcpKeepalive) * time.Second,
+		Backlog:   config.Properties.TcpBacklog,
+	}
+	// port 0 disables the plaintext listener
+	if config.Properties.Port != 0 {
+		cfg.Address = fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port)
+	}
+	if config.Properties.TlsPort != 0 {
+		tlsConfig, err := tcp.MakeServerTLSConfig(config.Properties.TlsCertFile, config.Properties.TlsKeyFile,
+			config.Properties.TlsCaCertFile, config.Properties.TlsAuthClients)
+		if err != nil {
+			logger.Fatal("invalid tls config: " + err.Error())
+		}
+		cfg.TLSAddress = fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.TlsPort)
+		cfg.TLSConfig = tlsConfig
+	}
+	err := tcp.ListenAndServeWithSignal(cfg, handler.MakeHandler())
 	if err != nil {
 		logger.Error(err)
 	}
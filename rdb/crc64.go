@@ -0,0 +1,33 @@
+package rdb
+
+// crc64 of rdb file uses Jones polynomial with reflected input and output, initial value 0 and no final xor,
+// it's different from the algorithms provided by hash/crc64
+
+// crc64Poly is the reflected Jones polynomial 0xad93d23594c935a9
+const crc64Poly = 0x95ac9329ac4bc9b5
+
+var crc64Table = makeCRC64Table()
+
+func makeCRC64Table() *[256]uint64 {
+	table := new([256]uint64)
+	for i := 0; i < 256; i++ {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ crc64Poly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// crc64Update returns the result of adding p to crc
+func crc64Update(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
@@ -0,0 +1,509 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Decoder reads objects from rdb file
+type Decoder struct {
+	reader  *checksumReader
+	buf     []byte
+	version int
+	// aux holds the aux fields read, such as redis-ver and ctime
+	aux map[string]string
+}
+
+// checksumReader computes crc64 of the bytes consumed
+type checksumReader struct {
+	reader *bufio.Reader
+	crc    uint64
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.crc = crc64Update(r.crc, p[:n])
+	return n, err
+}
+
+func (r *checksumReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.crc = crc64Update(r.crc, []byte{b})
+	}
+	return b, err
+}
+
+// NewDecoder creates a decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		reader: &checksumReader{reader: bufio.NewReader(r)},
+		buf:    make([]byte, 8),
+	}
+}
+
+// Aux returns the aux field read by Parse, empty if it doesn't exist
+func (dec *Decoder) Aux(key string) string {
+	return dec.aux[key]
+}
+
+// Parse reads the whole rdb file and calls cb for each object, stops if cb returns false
+func (dec *Decoder) Parse(cb func(o *Object) bool) error {
+	if err := dec.checkHeader(); err != nil {
+		return err
+	}
+	dbIndex := 0
+	var expiration *time.Time
+	for {
+		b, err := dec.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case opCodeEOF:
+			return dec.checkChecksum()
+		case opCodeSelectDB:
+			n, err := dec.readLength()
+			if err != nil {
+				return err
+			}
+			dbIndex = int(n)
+		case opCodeResizeDB:
+			// hash table sizes are not needed
+			if err := dec.skipLengths(2); err != nil {
+				return err
+			}
+		case opCodeSlotInfo:
+			// slot id, slot size and expires slot size of cluster
+			if err := dec.skipLengths(3); err != nil {
+				return err
+			}
+		case opCodeAux:
+			key, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			value, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			if dec.aux == nil {
+				dec.aux = make(map[string]string)
+			}
+			dec.aux[string(key)] = string(value)
+		case opCodeFunction2:
+			// functions library is not supported, just skip it
+			if _, err := dec.readString(); err != nil {
+				return err
+			}
+		case opCodeIdle:
+			// lru idle time is ignored
+			if _, err := dec.readLength(); err != nil {
+				return err
+			}
+		case opCodeFreq:
+			// lfu frequency is ignored
+			if _, err := dec.reader.ReadByte(); err != nil {
+				return err
+			}
+		case opCodeFunction, opCodeModuleAux:
+			return fmt.Errorf("unsupported opcode %#x", b)
+		case opCodeExpireTimeMs:
+			if _, err := io.ReadFull(dec.reader, dec.buf[:8]); err != nil {
+				return err
+			}
+			t := time.UnixMilli(int64(binary.LittleEndian.Uint64(dec.buf[:8])))
+			expiration = &t
+		case opCodeExpireTime:
+			if _, err := io.ReadFull(dec.reader, dec.buf[:4]); err != nil {
+				return err
+			}
+			t := time.Unix(int64(binary.LittleEndian.Uint32(dec.buf[:4])), 0)
+			expiration = &t
+		default:
+			o, err := dec.readObject(b)
+			if err != nil {
+				return err
+			}
+			o.DB = dbIndex
+			o.Expiration = expiration
+			expiration = nil
+			if !cb(o) {
+				return nil
+			}
+		}
+	}
+}
+
+func (dec *Decoder) checkHeader() error {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(dec.reader, header); err != nil {
+		return err
+	}
+	if string(header[:5]) != magic {
+		return errors.New("file is not a rdb file")
+	}
+	v, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return errors.New("illegal rdb version: " + string(header[5:]))
+	}
+	if v < 1 || v > maxVersion {
+		return fmt.Errorf("unsupported rdb version %d", v)
+	}
+	dec.version = v
+	return nil
+}
+
+// checkChecksum verifies crc64 trailer, it's available since version 5 and 0 means checksum is disabled
+func (dec *Decoder) checkChecksum() error {
+	if dec.version < 5 {
+		return nil
+	}
+	computed := dec.reader.crc
+	if _, err := io.ReadFull(dec.reader, dec.buf[:8]); err != nil {
+		return err
+	}
+	checksum := binary.LittleEndian.Uint64(dec.buf[:8])
+	if checksum != 0 && checksum != computed {
+		return fmt.Errorf("wrong rdb checksum, file: %#x, computed: %#x", checksum, computed)
+	}
+	return nil
+}
+
+func (dec *Decoder) readObject(objType byte) (*Object, error) {
+	key, err := dec.readString()
+	if err != nil {
+		return nil, err
+	}
+	o := &Object{Key: string(key)}
+	switch objType {
+	case typeString:
+		o.Type = StringType
+		o.String, err = dec.readString()
+	case typeList:
+		o.Type = ListType
+		o.List, err = dec.readStrings()
+	case typeListZipList:
+		o.Type = ListType
+		o.List, err = dec.readPacked(parseZipList)
+	case typeListQuickList, typeListQuickList2:
+		o.Type = ListType
+		o.List, err = dec.readQuickList(objType == typeListQuickList2)
+	case typeSet:
+		o.Type = SetType
+		o.Set, err = dec.readStrings()
+	case typeSetIntSet:
+		o.Type = SetType
+		o.Set, err = dec.readPacked(parseIntSet)
+	case typeSetListPack:
+		o.Type = SetType
+		o.Set, err = dec.readPacked(parseListPack)
+	case typeHash:
+		o.Type = HashType
+		o.Hash, err = dec.readHash()
+	case typeHashZipMap:
+		o.Type = HashType
+		var buf []byte
+		if buf, err = dec.readString(); err == nil {
+			o.Hash, err = parseZipMap(buf)
+		}
+	case typeHashZipList, typeHashListPack:
+		o.Type = HashType
+		o.Hash, err = dec.readPackedHash(objType == typeHashListPack)
+	case typeZSet, typeZSet2:
+		o.Type = ZSetType
+		o.ZSet, err = dec.readZSet(objType == typeZSet2)
+	case typeZSetZipList, typeZSetListPack:
+		o.Type = ZSetType
+		o.ZSet, err = dec.readPackedZSet(objType == typeZSetListPack)
+	case typeModule, typeModule2:
+		return nil, fmt.Errorf("module type of key %s is not supported", o.Key)
+	case typeStreamListPacks, typeStreamListPacks2, typeStreamListPacks3:
+		return nil, fmt.Errorf("stream type of key %s is not supported", o.Key)
+	default:
+		return nil, fmt.Errorf("unknown object type %d", objType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read key %s failed: %v", o.Key, err)
+	}
+	return o, nil
+}
+
+// readLengthOrEncoding reads length encoded integer, special is true if it indicates a special encoded string
+func (dec *Decoder) readLengthOrEncoding() (length uint64, special bool, err error) {
+	b, err := dec.reader.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0: // 6 bit
+		return uint64(b & 0x3F), false, nil
+	case 1: // 14 bit
+		next, err := dec.reader.ReadByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3F)<<8 | uint64(next), false, nil
+	case 2:
+		switch b {
+		case 0x80: // 32 bit
+			if _, err := io.ReadFull(dec.reader, dec.buf[:4]); err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(dec.buf[:4])), false, nil
+		case 0x81: // 64 bit
+			if _, err := io.ReadFull(dec.reader, dec.buf[:8]); err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(dec.buf[:8]), false, nil
+		}
+	case 3:
+		return uint64(b & 0x3F), true, nil
+	}
+	return 0, false, fmt.Errorf("illegal length encoding: %x", b)
+}
+
+// readLength reads length encoded integer
+func (dec *Decoder) readLength() (uint64, error) {
+	length, special, err := dec.readLengthOrEncoding()
+	if err != nil {
+		return 0, err
+	}
+	if special {
+		return 0, errors.New("unexpected string encoding")
+	}
+	return length, nil
+}
+
+func (dec *Decoder) skipLengths(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := dec.readLength(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readString reads string which may be encoded as integer or compressed by lzf
+func (dec *Decoder) readString() ([]byte, error) {
+	length, special, err := dec.readLengthOrEncoding()
+	if err != nil {
+		return nil, err
+	}
+	if special {
+		switch length {
+		case encInt8, encInt16, encInt32:
+			size := 1 << length
+			if _, err := io.ReadFull(dec.reader, dec.buf[:size]); err != nil {
+				return nil, err
+			}
+			return []byte(strconv.FormatInt(readIntLE(dec.buf[:size], size), 10)), nil
+		case encLZF:
+			return dec.readLZFString()
+		}
+		return nil, fmt.Errorf("unknown string encoding %d", length)
+	}
+	s := make([]byte, length)
+	if _, err := io.ReadFull(dec.reader, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (dec *Decoder) readLZFString() ([]byte, error) {
+	compressedLen, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	originalLen, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	compressed := make([]byte, compressedLen)
+	if _, err := io.ReadFull(dec.reader, compressed); err != nil {
+		return nil, err
+	}
+	return lzfDecompress(compressed, int(originalLen))
+}
+
+func (dec *Decoder) readStrings() ([][]byte, error) {
+	size, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0, size)
+	for i := uint64(0); i < size; i++ {
+		v, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// readPacked reads a string and parses it as a compact encoded value
+func (dec *Decoder) readPacked(parse func([]byte) ([][]byte, error)) ([][]byte, error) {
+	buf, err := dec.readString()
+	if err != nil {
+		return nil, err
+	}
+	return parse(buf)
+}
+
+// readQuickList reads list made of ziplist nodes, or listpack and plain nodes for quicklist 2
+func (dec *Decoder) readQuickList(v2 bool) ([][]byte, error) {
+	size, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0)
+	for i := uint64(0); i < size; i++ {
+		container := uint64(quickListNodePacked)
+		if v2 {
+			if container, err = dec.readLength(); err != nil {
+				return nil, err
+			}
+		}
+		buf, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		if container == quickListNodePlain {
+			values = append(values, buf)
+			continue
+		}
+		var node [][]byte
+		if v2 {
+			node, err = parseListPack(buf)
+		} else {
+			node, err = parseZipList(buf)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, node...)
+	}
+	return values, nil
+}
+
+func (dec *Decoder) readHash() (map[string][]byte, error) {
+	size, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	hash := make(map[string][]byte, size)
+	for i := uint64(0); i < size; i++ {
+		field, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		hash[string(field)] = value
+	}
+	return hash, nil
+}
+
+// readPackedHash reads hash stored in ziplist or listpack as field, value, field, value...
+func (dec *Decoder) readPackedHash(listPack bool) (map[string][]byte, error) {
+	values, err := dec.readPackedPairs(listPack)
+	if err != nil {
+		return nil, err
+	}
+	hash := make(map[string][]byte, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		hash[string(values[i])] = values[i+1]
+	}
+	return hash, nil
+}
+
+// readPackedZSet reads sorted set stored in ziplist or listpack as member, score, member, score...
+func (dec *Decoder) readPackedZSet(listPack bool) ([]*ZMember, error) {
+	values, err := dec.readPackedPairs(listPack)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]*ZMember, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(string(values[i+1]), 64)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &ZMember{Member: string(values[i]), Score: score})
+	}
+	return members, nil
+}
+
+func (dec *Decoder) readPackedPairs(listPack bool) ([][]byte, error) {
+	parse := parseZipList
+	if listPack {
+		parse = parseListPack
+	}
+	values, err := dec.readPacked(parse)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errCorrupted
+	}
+	return values, nil
+}
+
+// readZSet reads sorted set, scores are binary double if binaryScore is true else strings
+func (dec *Decoder) readZSet(binaryScore bool) ([]*ZMember, error) {
+	size, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]*ZMember, 0, size)
+	for i := uint64(0); i < size; i++ {
+		member, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScore {
+			if _, err := io.ReadFull(dec.reader, dec.buf[:8]); err != nil {
+				return nil, err
+			}
+			score = math.Float64frombits(binary.LittleEndian.Uint64(dec.buf[:8]))
+		} else {
+			score, err = dec.readStringScore()
+			if err != nil {
+				return nil, err
+			}
+		}
+		members = append(members, &ZMember{Member: string(member), Score: score})
+	}
+	return members, nil
+}
+
+// readStringScore reads score of zset v1, which is stored as a string prefixed by its length in one byte
+func (dec *Decoder) readStringScore() (float64, error) {
+	length, err := dec.reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(dec.reader, buf); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(buf), 64)
+}
@@ -0,0 +1,317 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// redisVersion is the redis-ver aux field, rdb version 9 is used since redis 5
+	redisVersion = "5.0.0"
+	// strings longer than lzfMinLength are compressed if possible
+	lzfMinLength = 20
+	// strings not longer than intEncodingMaxLength may be encoded as integer
+	intEncodingMaxLength = 11
+)
+
+// Encoder writes objects into rdb file
+type Encoder struct {
+	writer *checksumWriter
+	buf    []byte
+}
+
+// checksumWriter computes crc64 of the bytes written
+type checksumWriter struct {
+	writer *bufio.Writer
+	crc    uint64
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	w.crc = crc64Update(w.crc, p)
+	return w.writer.Write(p)
+}
+
+func (w *checksumWriter) WriteByte(b byte) error {
+	w.crc = crc64Update(w.crc, []byte{b})
+	return w.writer.WriteByte(b)
+}
+
+// NewEncoder creates an encoder writing to w, caller should call WriteHeader at first and WriteEnd at last
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		writer: &checksumWriter{writer: bufio.NewWriter(w)},
+		buf:    make([]byte, 9),
+	}
+}
+
+// WriteHeader writes magic number and version
+func (enc *Encoder) WriteHeader() error {
+	_, err := enc.writer.Write([]byte(magic + padVersion(version)))
+	return err
+}
+
+// WriteAux writes an auxiliary field, such as redis-ver or ctime
+func (enc *Encoder) WriteAux(key string, value string) error {
+	if err := enc.writer.WriteByte(opCodeAux); err != nil {
+		return err
+	}
+	if err := enc.writeString([]byte(key)); err != nil {
+		return err
+	}
+	return enc.writeString([]byte(value))
+}
+
+func padVersion(v int) string {
+	s := strconv.Itoa(v)
+	for len(s) < 4 {
+		s = "0" + s
+	}
+	return s
+}
+
+// WriteAuxFields writes the aux fields written by redis, aofBase tells whether the file is the base of aof
+func (enc *Encoder) WriteAuxFields(aofBase bool) error {
+	aofBaseValue := "0"
+	if aofBase {
+		aofBaseValue = "1"
+	}
+	auxFields := [][2]string{
+		{"redis-ver", redisVersion},
+		{"redis-bits", strconv.Itoa(strconv.IntSize)},
+		{"ctime", strconv.FormatInt(time.Now().Unix(), 10)},
+		{"aof-base", aofBaseValue},
+	}
+	for _, aux := range auxFields {
+		if err := enc.WriteAux(aux[0], aux[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteDBHeader writes SELECTDB and RESIZEDB opcode, the following objects belong to the db
+// keyCount and ttlCount are the number of keys and keys with ttl in the db
+func (enc *Encoder) WriteDBHeader(dbIndex int, keyCount int, ttlCount int) error {
+	if err := enc.writer.WriteByte(opCodeSelectDB); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(dbIndex)); err != nil {
+		return err
+	}
+	if err := enc.writer.WriteByte(opCodeResizeDB); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(keyCount)); err != nil {
+		return err
+	}
+	return enc.writeLength(uint64(ttlCount))
+}
+
+// WriteObject writes object of any type
+func (enc *Encoder) WriteObject(obj *Object) error {
+	switch obj.Type {
+	case StringType:
+		return enc.WriteString(obj.Key, obj.String, obj.Expiration)
+	case ListType:
+		return enc.WriteList(obj.Key, obj.List, obj.Expiration)
+	case SetType:
+		return enc.WriteSet(obj.Key, obj.Set, obj.Expiration)
+	case HashType:
+		return enc.WriteHash(obj.Key, obj.Hash, obj.Expiration)
+	case ZSetType:
+		return enc.WriteZSet(obj.Key, obj.ZSet, obj.Expiration)
+	}
+	return fmt.Errorf("unknown type %s of key %s", obj.Type, obj.Key)
+}
+
+// WriteString writes a string object
+func (enc *Encoder) WriteString(key string, value []byte, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeString, expiration); err != nil {
+		return err
+	}
+	return enc.writeString(value)
+}
+
+// WriteList writes a list object
+func (enc *Encoder) WriteList(key string, values [][]byte, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeList, expiration); err != nil {
+		return err
+	}
+	return enc.writeStrings(values)
+}
+
+// WriteSet writes a set object
+func (enc *Encoder) WriteSet(key string, members [][]byte, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeSet, expiration); err != nil {
+		return err
+	}
+	return enc.writeStrings(members)
+}
+
+// WriteHash writes a hash object
+func (enc *Encoder) WriteHash(key string, hash map[string][]byte, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeHash, expiration); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(len(hash))); err != nil {
+		return err
+	}
+	for field, value := range hash {
+		if err := enc.writeString([]byte(field)); err != nil {
+			return err
+		}
+		if err := enc.writeString(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteZSet writes a sorted set object, scores are stored as binary double
+func (enc *Encoder) WriteZSet(key string, members []*ZMember, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeZSet2, expiration); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(len(members))); err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := enc.writeString([]byte(m.Member)); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(enc.buf, math.Float64bits(m.Score))
+		if _, err := enc.writer.Write(enc.buf[:8]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteEnd writes EOF opcode and checksum, then flushes buffered data
+func (enc *Encoder) WriteEnd() error {
+	if err := enc.writer.WriteByte(opCodeEOF); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(enc.buf, enc.writer.crc)
+	if _, err := enc.writer.Write(enc.buf[:8]); err != nil {
+		return err
+	}
+	return enc.writer.writer.Flush()
+}
+
+func (enc *Encoder) beginObject(key string, objType byte, expiration *time.Time) error {
+	if expiration != nil {
+		if err := enc.writer.WriteByte(opCodeExpireTimeMs); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(enc.buf, uint64(expiration.UnixMilli()))
+		if _, err := enc.writer.Write(enc.buf[:8]); err != nil {
+			return err
+		}
+	}
+	if err := enc.writer.WriteByte(objType); err != nil {
+		return err
+	}
+	return enc.writeString([]byte(key))
+}
+
+// writeLength writes length encoded integer
+func (enc *Encoder) writeLength(length uint64) error {
+	var buf []byte
+	switch {
+	case length <= 0x3F: // 6 bit
+		buf = enc.buf[:1]
+		buf[0] = byte(length)
+	case length <= 0x3FFF: // 14 bit
+		buf = enc.buf[:2]
+		buf[0] = byte(length>>8) | 0x40
+		buf[1] = byte(length)
+	case length <= math.MaxUint32: // 32 bit
+		buf = enc.buf[:5]
+		buf[0] = 0x80
+		binary.BigEndian.PutUint32(buf[1:], uint32(length))
+	default: // 64 bit
+		buf = enc.buf[:9]
+		buf[0] = 0x81
+		binary.BigEndian.PutUint64(buf[1:], length)
+	}
+	_, err := enc.writer.Write(buf)
+	return err
+}
+
+// writeString writes string, it's encoded as integer or compressed if possible
+func (enc *Encoder) writeString(s []byte) error {
+	if len(s) <= intEncodingMaxLength {
+		if ok, err := enc.tryWriteInt(s); ok || err != nil {
+			return err
+		}
+	}
+	if len(s) > lzfMinLength {
+		if compressed := lzfCompress(s); compressed != nil {
+			return enc.writeLZFString(compressed, len(s))
+		}
+	}
+	if err := enc.writeLength(uint64(len(s))); err != nil {
+		return err
+	}
+	_, err := enc.writer.Write(s)
+	return err
+}
+
+// tryWriteInt writes string as 8, 16 or 32 bit integer if it's the canonical form of an integer in range
+func (enc *Encoder) tryWriteInt(s []byte) (bool, error) {
+	v, err := strconv.ParseInt(string(s), 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != string(s) {
+		return false, nil
+	}
+	var buf []byte
+	switch {
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		buf = enc.buf[:2]
+		buf[0] = 0xC0 | encInt8
+		buf[1] = byte(v)
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		buf = enc.buf[:3]
+		buf[0] = 0xC0 | encInt16
+		binary.LittleEndian.PutUint16(buf[1:], uint16(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		buf = enc.buf[:5]
+		buf[0] = 0xC0 | encInt32
+		binary.LittleEndian.PutUint32(buf[1:], uint32(v))
+	default:
+		return false, nil
+	}
+	_, err = enc.writer.Write(buf)
+	return true, err
+}
+
+func (enc *Encoder) writeLZFString(compressed []byte, originalLen int) error {
+	if err := enc.writer.WriteByte(0xC0 | encLZF); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(len(compressed))); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(originalLen)); err != nil {
+		return err
+	}
+	_, err := enc.writer.Write(compressed)
+	return err
+}
+
+func (enc *Encoder) writeStrings(values [][]byte) error {
+	if err := enc.writeLength(uint64(len(values))); err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := enc.writeString(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package rdb
+
+import "errors"
+
+const (
+	lzfHashLog    = 14
+	lzfMaxLiteral = 1 << 5
+	lzfMaxOffset  = 1 << 13
+	lzfMaxRef     = (1 << 8) + (1 << 3)
+)
+
+var errLZFCorrupted = errors.New("lzf compressed data is corrupted")
+
+// lzfCompress compresses data in the format of liblzf, returns nil if data cannot be compressed
+func lzfCompress(in []byte) []byte {
+	if len(in) < 4 {
+		return nil
+	}
+	out := make([]byte, 0, len(in))
+	// position + 1 of the latest occurrence of 3 bytes
+	htab := make([]int, 1<<lzfHashLog)
+	litStart := 0
+	flushLiterals := func(end int) {
+		for litStart < end {
+			n := end - litStart
+			if n > lzfMaxLiteral {
+				n = lzfMaxLiteral
+			}
+			out = append(out, byte(n-1))
+			out = append(out, in[litStart:litStart+n]...)
+			litStart += n
+		}
+	}
+	i := 0
+	for i+2 < len(in) {
+		h := (uint32(in[i])<<16 | uint32(in[i+1])<<8 | uint32(in[i+2])) * 2654435761 >> (32 - lzfHashLog)
+		ref := htab[h] - 1
+		htab[h] = i + 1
+		if ref >= 0 && i-ref-1 < lzfMaxOffset &&
+			in[ref] == in[i] && in[ref+1] == in[i+1] && in[ref+2] == in[i+2] {
+			maxLen := len(in) - i
+			if maxLen > lzfMaxRef {
+				maxLen = lzfMaxRef
+			}
+			matched := 3
+			for matched < maxLen && in[ref+matched] == in[i+matched] {
+				matched++
+			}
+			flushLiterals(i)
+			offset := i - ref - 1
+			length := matched - 2
+			if length < 7 {
+				out = append(out, byte(length<<5|offset>>8))
+			} else {
+				out = append(out, byte(7<<5|offset>>8), byte(length-7))
+			}
+			out = append(out, byte(offset))
+			i += matched
+			litStart = i
+			if len(out) >= len(in) {
+				return nil
+			}
+			continue
+		}
+		i++
+	}
+	flushLiterals(len(in))
+	if len(out) >= len(in) {
+		return nil
+	}
+	return out
+}
+
+// lzfDecompress decompresses data compressed by liblzf, outLen is the length of the original data
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	i := 0
+	for i < len(in) {
+		ctrl := int(in[i])
+		i++
+		if ctrl < lzfMaxLiteral {
+			// literal run
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > outLen {
+				return nil, errLZFCorrupted
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		// back reference
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errLZFCorrupted
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errLZFCorrupted
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		length += 2
+		if ref < 0 || len(out)+length > outLen {
+			return nil, errLZFCorrupted
+		}
+		// the referenced bytes may overlap the bytes being written
+		for j := 0; j < length; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errLZFCorrupted
+	}
+	return out, nil
+}
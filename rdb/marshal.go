@@ -0,0 +1,88 @@
+package rdb
+
+import (
+	Dict "go-redis/datastruct/dict"
+	List "go-redis/datastruct/list"
+	HashSet "go-redis/datastruct/set"
+	SortedSet "go-redis/datastruct/sortedset"
+	"go-redis/interface/database"
+	"go-redis/interface/datastruct"
+)
+
+// EntityToObject converts data entity to rdb object, the result is not affected by later modification of the entity
+func EntityToObject(key string, entity *database.DataEntity) *Object {
+	obj := &Object{Key: key}
+	switch val := entity.Data.(type) {
+	case []byte:
+		// strings may be modified in place, e.g. SETRANGE
+		obj.Type = StringType
+		obj.String = append([]byte(nil), val...)
+	case *List.QuickList:
+		obj.Type = ListType
+		obj.List = make([][]byte, 0, val.Len())
+		val.ForEach(func(i int, v interface{}) bool {
+			bytes, _ := v.([]byte)
+			obj.List = append(obj.List, bytes)
+			return true
+		})
+	case datastruct.Dict:
+		obj.Type = HashType
+		obj.Hash = make(map[string][]byte, val.Len())
+		val.ForEach(func(field string, v interface{}) bool {
+			bytes, _ := v.([]byte)
+			obj.Hash[field] = bytes
+			return true
+		})
+	case *HashSet.Set:
+		obj.Type = SetType
+		obj.Set = make([][]byte, 0, val.Len())
+		val.ForEach(func(member string) bool {
+			obj.Set = append(obj.Set, []byte(member))
+			return true
+		})
+	case *SortedSet.SortedSet:
+		obj.Type = ZSetType
+		obj.ZSet = make([]*ZMember, 0, val.Len())
+		if val.Len() > 0 {
+			val.ForEachByRank(0, val.Len(), false, func(element *SortedSet.Element) bool {
+				obj.ZSet = append(obj.ZSet, &ZMember{Member: element.Member, Score: element.Score})
+				return true
+			})
+		}
+	}
+	return obj
+}
+
+// ObjectToEntity converts rdb object to data entity
+func ObjectToEntity(o *Object) *database.DataEntity {
+	var data interface{}
+	switch o.Type {
+	case StringType:
+		data = o.String
+	case ListType:
+		list := List.MakeQuickList()
+		for _, v := range o.List {
+			list.Add(v)
+		}
+		data = list
+	case HashType:
+		hash := Dict.MakeSimpleDict()
+		for field, v := range o.Hash {
+			hash.Put(field, v)
+		}
+		data = hash
+	case SetType:
+		set := HashSet.Make()
+		for _, member := range o.Set {
+			set.Add(string(member))
+		}
+		data = set
+	case ZSetType:
+		zset := SortedSet.Make()
+		for _, m := range o.ZSet {
+			zset.Add(m.Member, m.Score)
+		}
+		data = zset
+	}
+	return &database.DataEntity{Data: data}
+}
@@ -0,0 +1,98 @@
+// Package rdb encodes and decodes redis rdb files
+package rdb
+
+import "time"
+
+const (
+	magic = "REDIS"
+	// version is the version of written files, files up to maxVersion can be read
+	version    = 9
+	maxVersion = 12
+)
+
+// opcodes
+const (
+	opCodeSlotInfo     = 0xF4
+	opCodeFunction2    = 0xF5
+	opCodeFunction     = 0xF6
+	opCodeModuleAux    = 0xF7
+	opCodeIdle         = 0xF8
+	opCodeFreq         = 0xF9
+	opCodeAux          = 0xFA
+	opCodeResizeDB     = 0xFB
+	opCodeExpireTimeMs = 0xFC
+	opCodeExpireTime   = 0xFD
+	opCodeSelectDB     = 0xFE
+	opCodeEOF          = 0xFF
+)
+
+// value types
+const (
+	typeString           = 0
+	typeList             = 1
+	typeSet              = 2
+	typeZSet             = 3
+	typeHash             = 4
+	typeZSet2            = 5
+	typeModule           = 6
+	typeModule2          = 7
+	typeHashZipMap       = 9
+	typeListZipList      = 10
+	typeSetIntSet        = 11
+	typeZSetZipList      = 12
+	typeHashZipList      = 13
+	typeListQuickList    = 14
+	typeStreamListPacks  = 15
+	typeHashListPack     = 16
+	typeZSetListPack     = 17
+	typeListQuickList2   = 18
+	typeStreamListPacks2 = 19
+	typeSetListPack      = 20
+	typeStreamListPacks3 = 21
+)
+
+// special encodings of strings, they are indicated by the highest 2 bits of length
+const (
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// containers of quicklist 2 nodes
+const (
+	quickListNodePlain  = 1
+	quickListNodePacked = 2
+)
+
+// ObjectType is the type of Object
+type ObjectType string
+
+// types of Object
+const (
+	StringType ObjectType = "string"
+	ListType   ObjectType = "list"
+	SetType    ObjectType = "set"
+	HashType   ObjectType = "hash"
+	ZSetType   ObjectType = "zset"
+)
+
+// ZMember is a member of sorted set
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// Object is a key-value pair stored in rdb, only the field matching Type is set
+type Object struct {
+	DB         int
+	Key        string
+	Type       ObjectType
+	Expiration *time.Time // nil means no ttl
+
+	String []byte
+	List   [][]byte
+	Set    [][]byte
+	Hash   map[string][]byte
+	ZSet   []*ZMember
+}
@@ -0,0 +1,365 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCRC64(t *testing.T) {
+	// check value of the crc64 used by redis
+	if crc := crc64Update(0, []byte("123456789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("expected crc64 %#x, actually %#x", uint64(0xe9c6d914c4b8d9ca), crc)
+	}
+	// crc can be computed incrementally
+	if crc := crc64Update(crc64Update(0, []byte("1234")), []byte("56789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("expected incremental crc64 %#x, actually %#x", uint64(0xe9c6d914c4b8d9ca), crc)
+	}
+}
+
+func TestLZF(t *testing.T) {
+	random := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(random)
+	tests := []struct {
+		name         string
+		data         []byte
+		compressible bool
+	}{
+		{"too short", []byte("abc"), false},
+		{"repeated byte", bytes.Repeat([]byte("a"), 1000), true},
+		{"repeated pattern", []byte(strings.Repeat("hello world ", 100)), true},
+		{"long literal run", append(append([]byte(nil), random[:100]...), bytes.Repeat([]byte("x"), 100)...), true},
+		// the repeated block is 7000 bytes away
+		{"far reference", append(append([]byte(nil), random[:7000]...), random[:2000]...), true},
+		{"random", random[:1000], false},
+	}
+	for _, tt := range tests {
+		compressed := lzfCompress(tt.data)
+		if !tt.compressible {
+			if compressed != nil {
+				t.Errorf("%s: expected not compressible, actually %d bytes", tt.name, len(compressed))
+			}
+			continue
+		}
+		if compressed == nil || len(compressed) >= len(tt.data) {
+			t.Errorf("%s: expected compressed", tt.name)
+			continue
+		}
+		decompressed, err := lzfDecompress(compressed, len(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(decompressed, tt.data) {
+			t.Errorf("%s: decompressed data is different", tt.name)
+		}
+	}
+}
+
+func TestLZFDecompress(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     []byte
+		outLen int
+		out    string
+		err    error
+	}{
+		// literal run "ab" followed by reference of length 3 to offset 1
+		{"literal and reference", []byte{0x01, 'a', 'b', 0x20, 0x01}, 5, "ababa", nil},
+		// reference of length 9 overlapping the bytes being written
+		{"long reference", []byte{0x00, 'a', 0xE0, 0x00, 0x00}, 10, "aaaaaaaaaa", nil},
+		{"truncated literal", []byte{0x05, 'a', 'b'}, 6, "", errLZFCorrupted},
+		{"reference before start", []byte{0x00, 'a', 0x20, 0x05}, 4, "", errLZFCorrupted},
+		{"truncated reference", []byte{0x00, 'a', 0x20}, 4, "", errLZFCorrupted},
+		{"longer than expected", []byte{0x01, 'a', 'b'}, 1, "", errLZFCorrupted},
+		{"shorter than expected", []byte{0x01, 'a', 'b'}, 3, "", errLZFCorrupted},
+	}
+	for _, tt := range tests {
+		out, err := lzfDecompress(tt.in, tt.outLen)
+		if err != tt.err {
+			t.Errorf("%s: expected error %v, actually %v", tt.name, tt.err, err)
+			continue
+		}
+		if err == nil && string(out) != tt.out {
+			t.Errorf("%s: expected %q, actually %q", tt.name, tt.out, out)
+		}
+	}
+}
+
+func TestEncoder_WriteString(t *testing.T) {
+	long := strings.Repeat("abcd", 10)
+	binaryValue := make([]byte, 100)
+	for i := range binaryValue {
+		binaryValue[i] = byte(i)
+	}
+	tests := []struct {
+		value   string
+		encoded []byte
+	}{
+		{"", []byte{0x00}},
+		{"abc", []byte{0x03, 'a', 'b', 'c'}},
+		{"12", []byte{0xC0, 12}},
+		{"-128", []byte{0xC0, 0x80}},
+		{"-129", []byte{0xC1, 0x7F, 0xFF}},
+		{"100000", []byte{0xC2, 0xA0, 0x86, 0x01, 0x00}},
+		// not the canonical form of integer
+		{"007", []byte{0x03, '0', '0', '7'}},
+		{"+1", []byte{0x02, '+', '1'}},
+		// out of range of int32
+		{"4294967296", append([]byte{0x0A}, "4294967296"...)},
+		// 14 bit length
+		{string(binaryValue), append([]byte{0x40, 100}, binaryValue...)},
+		// compressed by lzf, only the encoding is checked
+		{long, []byte{0xC3}},
+	}
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		enc := NewEncoder(buf)
+		if err := enc.writeString([]byte(tt.value)); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.writer.writer.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if (tt.value == long && !bytes.HasPrefix(buf.Bytes(), tt.encoded)) ||
+			(tt.value != long && !bytes.Equal(buf.Bytes(), tt.encoded)) {
+			t.Errorf("%q: expected encoded as %x, actually %x", tt.value, tt.encoded, buf.Bytes())
+		}
+		dec := NewDecoder(buf)
+		decoded, err := dec.readString()
+		if err != nil {
+			t.Errorf("%q: %v", tt.value, err)
+			continue
+		}
+		if string(decoded) != tt.value {
+			t.Errorf("expected %q, actually %q", tt.value, decoded)
+		}
+	}
+}
+
+func TestEncoder_WriteLength(t *testing.T) {
+	tests := []struct {
+		length  uint64
+		encoded []byte
+	}{
+		{0x3F, []byte{0x3F}},
+		{0x40, []byte{0x40, 0x40}},
+		{0x3FFF, []byte{0x7F, 0xFF}},
+		{0x4000, []byte{0x80, 0x00, 0x00, 0x40, 0x00}},
+		{math.MaxUint32 + 1, []byte{0x81, 0, 0, 0, 1, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		enc := NewEncoder(buf)
+		if err := enc.writeLength(tt.length); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.writer.writer.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), tt.encoded) {
+			t.Errorf("%d: expected encoded as %x, actually %x", tt.length, tt.encoded, buf.Bytes())
+		}
+		length, err := NewDecoder(buf).readLength()
+		if err != nil || length != tt.length {
+			t.Errorf("%d: decoded as %d, error %v", tt.length, length, err)
+		}
+	}
+}
+
+func TestEncoder_Decoder(t *testing.T) {
+	expiration := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	objects := []*Object{
+		{Key: "str", Type: StringType, String: []byte("hello")},
+		{Key: "int", Type: StringType, String: []byte("123456")},
+		{Key: "long", Type: StringType, String: bytes.Repeat([]byte("value"), 100), Expiration: &expiration},
+		{Key: "list", Type: ListType, List: [][]byte{[]byte("a"), []byte("-1"), bytes.Repeat([]byte("b"), 50)}},
+		{Key: "set", Type: SetType, Set: [][]byte{[]byte("m1"), []byte("2")}},
+		{Key: "hash", Type: HashType, Hash: map[string][]byte{"f": []byte("v"), "n": []byte("1")}},
+		{DB: 3, Key: "zset", Type: ZSetType, ZSet: []*ZMember{
+			{Member: "a", Score: 1.5}, {Member: "b", Score: math.Inf(-1)}, {Member: "c", Score: math.Inf(1)},
+		}, Expiration: &expiration},
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteAuxFields(true); err != nil {
+		t.Fatal(err)
+	}
+	dbIndex := -1
+	for _, o := range objects {
+		if o.DB != dbIndex {
+			if err := enc.WriteDBHeader(o.DB, 1, 1); err != nil {
+				t.Fatal(err)
+			}
+			dbIndex = o.DB
+		}
+		if err := enc.WriteObject(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.WriteEnd(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("REDIS0009")) {
+		t.Errorf("expected header REDIS0009, actually %q", buf.Bytes()[:9])
+	}
+
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	var decoded []*Object
+	err := dec.Parse(func(o *Object) bool {
+		decoded = append(decoded, o)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, objects) {
+		t.Errorf("expected %+v, actually %+v", objects, decoded)
+	}
+	if dec.Aux("redis-ver") != redisVersion || dec.Aux("aof-base") != "1" {
+		t.Errorf("unexpected aux fields redis-ver %q and aof-base %q", dec.Aux("redis-ver"), dec.Aux("aof-base"))
+	}
+
+	// checksum is verified
+	corrupted := append([]byte(nil), buf.Bytes()...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+	if err := NewDecoder(bytes.NewReader(corrupted)).Parse(func(o *Object) bool { return true }); err == nil {
+		t.Error("expected checksum error")
+	}
+}
+
+// rawRDB builds a rdb file of the given version from raw data between header and EOF, checksum is disabled
+func rawRDB(version string, data ...[]byte) []byte {
+	file := []byte("REDIS" + version)
+	for _, d := range data {
+		file = append(file, d...)
+	}
+	file = append(file, opCodeEOF)
+	return append(file, make([]byte, 8)...)
+}
+
+// rawString encodes s with a 6 bit length
+func rawString(s []byte) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func makeZipList(entries ...[]byte) []byte {
+	buf := make([]byte, 10)
+	binary.LittleEndian.PutUint16(buf[8:10], uint16(len(entries)))
+	for _, e := range entries {
+		// the length of previous entry is not used by decoder
+		buf = append(buf, 0x00)
+		buf = append(buf, e...)
+	}
+	buf = append(buf, 0xFF)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	return buf
+}
+
+func makeListPack(entries ...[]byte) []byte {
+	buf := make([]byte, 6)
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(len(entries)))
+	for _, e := range entries {
+		buf = append(buf, e...)
+		buf = append(buf, byte(len(e)))
+	}
+	buf = append(buf, 0xFF)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	return buf
+}
+
+func TestDecoder_CompactEncodings(t *testing.T) {
+	zipList := makeZipList(
+		[]byte{0x02, 'a', 'b'},   // 6 bit string
+		[]byte{0xF3},             // 4 bit immediate integer 2
+		[]byte{0xC0, 0xFE, 0xFF}, // int16 -2
+		[]byte{0xFE, 0x80},       // int8 -128
+	)
+	listPack := makeListPack(
+		[]byte{0x05},             // 7 bit uint
+		[]byte{0x82, 'a', 'b'},   // 6 bit string
+		[]byte{0xDF, 0xFF},       // 13 bit int -1
+		[]byte{0xF1, 0xE8, 0x03}, // int16 1000
+	)
+	intSet := []byte{2, 0, 0, 0, 3, 0, 0, 0, 0xFF, 0xFF, 0x01, 0x00, 0x2C, 0x01}
+	zipMap := []byte{0x02, 0x01, 'k', 0x02, 0x01, 'v', '1', 'x', 0x01, 'n', 0x00, 0x00, 0xFF}
+	pairs := makeListPack([]byte{0x81, 'f'}, []byte{0x81, 'v'}, []byte{0x81, 'n'}, []byte{0x01})
+	zsetZipList := makeZipList([]byte{0x01, 'a'}, []byte{0x03, '1', '.', '5'}, []byte{0x01, 'b'}, []byte{0xF1})
+	zsetV1 := append(append(append([]byte{0x02}, rawString([]byte("a"))...), 0x03, '1', '.', '5'),
+		append(rawString([]byte("b")), 0xFF)...)
+
+	tests := []struct {
+		name    string
+		objType byte
+		value   []byte
+		want    *Object
+	}{
+		{"ziplist", typeListZipList, rawString(zipList),
+			&Object{Type: ListType, List: [][]byte{[]byte("ab"), []byte("2"), []byte("-2"), []byte("-128")}}},
+		{"quicklist", typeListQuickList, append([]byte{0x02}, append(rawString(zipList), rawString(zipList)...)...),
+			&Object{Type: ListType, List: [][]byte{[]byte("ab"), []byte("2"), []byte("-2"), []byte("-128"),
+				[]byte("ab"), []byte("2"), []byte("-2"), []byte("-128")}}},
+		{"quicklist 2", typeListQuickList2, append([]byte{0x02, quickListNodePacked},
+			append(rawString(listPack), append([]byte{quickListNodePlain}, rawString([]byte("plain"))...)...)...),
+			&Object{Type: ListType, List: [][]byte{[]byte("5"), []byte("ab"), []byte("-1"), []byte("1000"), []byte("plain")}}},
+		{"intset", typeSetIntSet, rawString(intSet),
+			&Object{Type: SetType, Set: [][]byte{[]byte("-1"), []byte("1"), []byte("300")}}},
+		{"set listpack", typeSetListPack, rawString(listPack),
+			&Object{Type: SetType, Set: [][]byte{[]byte("5"), []byte("ab"), []byte("-1"), []byte("1000")}}},
+		{"zipmap", typeHashZipMap, rawString(zipMap),
+			&Object{Type: HashType, Hash: map[string][]byte{"k": []byte("v1"), "n": {}}}},
+		{"hash listpack", typeHashListPack, rawString(pairs),
+			&Object{Type: HashType, Hash: map[string][]byte{"f": []byte("v"), "n": []byte("1")}}},
+		{"zset ziplist", typeZSetZipList, rawString(zsetZipList),
+			&Object{Type: ZSetType, ZSet: []*ZMember{{Member: "a", Score: 1.5}, {Member: "b", Score: 0}}}},
+		{"zset v1", typeZSet, zsetV1,
+			&Object{Type: ZSetType, ZSet: []*ZMember{{Member: "a", Score: 1.5}, {Member: "b", Score: math.Inf(-1)}}}},
+	}
+	for _, tt := range tests {
+		file := rawRDB("0011", []byte{opCodeSelectDB, 0x01, opCodeExpireTime, 0x10, 0x00, 0x00, 0x00, tt.objType},
+			rawString([]byte("key")), tt.value)
+		var decoded []*Object
+		err := NewDecoder(bytes.NewReader(file)).Parse(func(o *Object) bool {
+			decoded = append(decoded, o)
+			return true
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		expiration := time.Unix(16, 0)
+		tt.want.DB, tt.want.Key, tt.want.Expiration = 1, "key", &expiration
+		if len(decoded) != 1 || !reflect.DeepEqual(decoded[0], tt.want) {
+			t.Errorf("%s: expected %+v, actually %+v", tt.name, tt.want, decoded)
+		}
+	}
+}
+
+func TestDecoder_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"not rdb", []byte("RADIS0009\xFF")},
+		{"unsupported version", rawRDB("0013")},
+		{"truncated", []byte("REDIS0009\xFE")},
+		{"unknown type", rawRDB("0009", []byte{0x08}, rawString([]byte("key")))},
+		{"stream", rawRDB("0009", []byte{typeStreamListPacks}, rawString([]byte("key")))},
+		{"corrupted ziplist", rawRDB("0009", []byte{typeListZipList}, rawString([]byte("key")), rawString([]byte{1, 2, 3}))},
+		{"corrupted intset", rawRDB("0009", []byte{typeSetIntSet}, rawString([]byte("key")), rawString([]byte{3, 0, 0, 0, 1, 0, 0, 0, 0}))},
+	}
+	for _, tt := range tests {
+		err := NewDecoder(bytes.NewReader(tt.file)).Parse(func(o *Object) bool { return true })
+		if err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// compact encodings used by redis to store small values, they are only decoded
+
+var errCorrupted = errors.New("compact encoded value is corrupted")
+
+// parseZipList parses ziplist: <zlbytes><zltail><zllen><entry>...<0xFF>
+func parseZipList(buf []byte) ([][]byte, error) {
+	if len(buf) < 11 {
+		return nil, errCorrupted
+	}
+	size := int(binary.LittleEndian.Uint16(buf[8:10]))
+	values := make([][]byte, 0, size)
+	i := 10
+	for {
+		if i >= len(buf) {
+			return nil, errCorrupted
+		}
+		if buf[i] == 0xFF {
+			return values, nil
+		}
+		// skip length of previous entry
+		if buf[i] < 254 {
+			i++
+		} else {
+			i += 5
+		}
+		if i >= len(buf) {
+			return nil, errCorrupted
+		}
+		value, n, err := parseZipListEntry(buf[i:])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		i += n
+	}
+}
+
+// parseZipListEntry parses encoding and content of a ziplist entry, returns value and its size
+func parseZipListEntry(buf []byte) ([]byte, int, error) {
+	header := buf[0]
+	var length, n int
+	switch header >> 6 {
+	case 0:
+		length, n = int(header&0x3F), 1
+	case 1:
+		if len(buf) < 2 {
+			return nil, 0, errCorrupted
+		}
+		length, n = int(header&0x3F)<<8|int(buf[1]), 2
+	case 2:
+		if len(buf) < 5 {
+			return nil, 0, errCorrupted
+		}
+		length, n = int(binary.BigEndian.Uint32(buf[1:5])), 5
+	default:
+		return parseZipListInt(buf)
+	}
+	if n+length > len(buf) {
+		return nil, 0, errCorrupted
+	}
+	return buf[n : n+length], n + length, nil
+}
+
+func parseZipListInt(buf []byte) ([]byte, int, error) {
+	header := buf[0]
+	var size int
+	switch header {
+	case 0xC0:
+		size = 2
+	case 0xD0:
+		size = 4
+	case 0xE0:
+		size = 8
+	case 0xF0:
+		size = 3
+	case 0xFE:
+		size = 1
+	default:
+		if header >= 0xF1 && header <= 0xFD {
+			// 4 bits immediate integer
+			return []byte(strconv.Itoa(int(header&0x0F) - 1)), 1, nil
+		}
+		return nil, 0, errCorrupted
+	}
+	if 1+size > len(buf) {
+		return nil, 0, errCorrupted
+	}
+	v := readIntLE(buf[1:1+size], size)
+	return []byte(strconv.FormatInt(v, 10)), 1 + size, nil
+}
+
+// parseListPack parses listpack: <total bytes><num elements><entry>...<0xFF>
+func parseListPack(buf []byte) ([][]byte, error) {
+	if len(buf) < 7 {
+		return nil, errCorrupted
+	}
+	size := int(binary.LittleEndian.Uint16(buf[4:6]))
+	values := make([][]byte, 0, size)
+	i := 6
+	for {
+		if i >= len(buf) {
+			return nil, errCorrupted
+		}
+		if buf[i] == 0xFF {
+			return values, nil
+		}
+		value, n, err := parseListPackEntry(buf[i:])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		// skip entry and backlen
+		i += n + backLenSize(n)
+	}
+}
+
+// parseListPackEntry parses encoding and content of a listpack entry, returns value and its size without backlen
+func parseListPackEntry(buf []byte) ([]byte, int, error) {
+	header := buf[0]
+	var intSize, strLen, n int
+	switch {
+	case header&0x80 == 0: // 7 bit uint
+		return []byte(strconv.Itoa(int(header & 0x7F))), 1, nil
+	case header&0xC0 == 0x80: // 6 bit string length
+		strLen, n = int(header&0x3F), 1
+	case header&0xE0 == 0xC0: // 13 bit int
+		if len(buf) < 2 {
+			return nil, 0, errCorrupted
+		}
+		v := int64(header&0x1F)<<8 | int64(buf[1])
+		if v >= 1<<12 {
+			v -= 1 << 13
+		}
+		return []byte(strconv.FormatInt(v, 10)), 2, nil
+	case header&0xF0 == 0xE0: // 12 bit string length
+		if len(buf) < 2 {
+			return nil, 0, errCorrupted
+		}
+		strLen, n = int(header&0x0F)<<8|int(buf[1]), 2
+	case header == 0xF0: // 32 bit string length
+		if len(buf) < 5 {
+			return nil, 0, errCorrupted
+		}
+		strLen, n = int(binary.LittleEndian.Uint32(buf[1:5])), 5
+	case header == 0xF1:
+		intSize = 2
+	case header == 0xF2:
+		intSize = 3
+	case header == 0xF3:
+		intSize = 4
+	case header == 0xF4:
+		intSize = 8
+	default:
+		return nil, 0, errCorrupted
+	}
+	if intSize > 0 {
+		if 1+intSize > len(buf) {
+			return nil, 0, errCorrupted
+		}
+		v := readIntLE(buf[1:1+intSize], intSize)
+		return []byte(strconv.FormatInt(v, 10)), 1 + intSize, nil
+	}
+	if n+strLen > len(buf) {
+		return nil, 0, errCorrupted
+	}
+	return buf[n : n+strLen], n + strLen, nil
+}
+
+// backLenSize returns the size of backlen of a listpack entry
+func backLenSize(entrySize int) int {
+	switch {
+	case entrySize < 1<<7:
+		return 1
+	case entrySize < 1<<14:
+		return 2
+	case entrySize < 1<<21:
+		return 3
+	case entrySize < 1<<28:
+		return 4
+	}
+	return 5
+}
+
+// parseIntSet parses intset: <encoding><length><contents>
+func parseIntSet(buf []byte) ([][]byte, error) {
+	if len(buf) < 8 {
+		return nil, errCorrupted
+	}
+	intSize := int(binary.LittleEndian.Uint32(buf[0:4]))
+	size := int(binary.LittleEndian.Uint32(buf[4:8]))
+	if (intSize != 2 && intSize != 4 && intSize != 8) || 8+intSize*size > len(buf) {
+		return nil, errCorrupted
+	}
+	values := make([][]byte, 0, size)
+	for i := 0; i < size; i++ {
+		start := 8 + i*intSize
+		v := readIntLE(buf[start:start+intSize], intSize)
+		values = append(values, []byte(strconv.FormatInt(v, 10)))
+	}
+	return values, nil
+}
+
+// parseZipMap parses zipmap: <zmlen><len>key<len><free>value...<0xFF>
+func parseZipMap(buf []byte) (map[string][]byte, error) {
+	hash := make(map[string][]byte)
+	i := 1
+	readLen := func() (int, error) {
+		if i >= len(buf) {
+			return 0, errCorrupted
+		}
+		b := buf[i]
+		if b < 254 {
+			i++
+			return int(b), nil
+		}
+		if b == 254 && i+5 <= len(buf) {
+			length := int(binary.LittleEndian.Uint32(buf[i+1 : i+5]))
+			i += 5
+			return length, nil
+		}
+		return 0, errCorrupted
+	}
+	for {
+		if i >= len(buf) {
+			return nil, errCorrupted
+		}
+		if buf[i] == 0xFF {
+			return hash, nil
+		}
+		keyLen, err := readLen()
+		if err != nil {
+			return nil, err
+		}
+		if i+keyLen > len(buf) {
+			return nil, errCorrupted
+		}
+		key := buf[i : i+keyLen]
+		i += keyLen
+		valueLen, err := readLen()
+		if err != nil {
+			return nil, err
+		}
+		if i >= len(buf) {
+			return nil, errCorrupted
+		}
+		free := int(buf[i])
+		i++
+		if i+valueLen+free > len(buf) {
+			return nil, errCorrupted
+		}
+		hash[string(key)] = buf[i : i+valueLen]
+		i += valueLen + free
+	}
+}
+
+// readIntLE reads signed little endian integer of the given size
+func readIntLE(buf []byte, size int) int64 {
+	var v uint64
+	for i := size - 1; i >= 0; i-- {
+		v = v<<8 | uint64(buf[i])
+	}
+	// sign extension
+	shift := uint(64 - size*8)
+	return int64(v<<shift) >> shift
+}
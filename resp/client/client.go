@@ -1,13 +1,18 @@
 package client
 
 import (
+	"bufio"
+	"crypto/tls"
+	"errors"
 	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/lib/sync/wait"
 	"go-redis/resp/parser"
 	"go-redis/resp/reply"
+	"io"
 	"net"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,6 +24,9 @@ type Client struct {
 	waitingReqs chan *request // waiting response
 	ticker      *time.Ticker
 	addr        string
+	tlsConfig   *tls.Config // dial over TLS if it's not nil
+	// handshake is sent on every connection before requests, including reconnections
+	handshake [][]byte
 
 	working *sync.WaitGroup // its counter presents unfinished requests(pending and waiting)
 }
@@ -40,17 +48,68 @@ const (
 
 // MakeClient creates a new client
 func MakeClient(addr string) (*Client, error) {
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return nil, err
-	}
-	return &Client{
+	return MakeTLSClient(addr, nil)
+}
+
+// MakeTLSClient creates a new client connecting over TLS, tlsConfig nil means plaintext
+func MakeTLSClient(addr string, tlsConfig *tls.Config) (*Client, error) {
+	return MakeHandshakeClient(addr, tlsConfig, nil)
+}
+
+// MakeHandshakeClient creates a new client sending handshake, such as "HELLO 3 AUTH user password",
+// once the connection is established. The connection is closed if handshake fails
+func MakeHandshakeClient(addr string, tlsConfig *tls.Config, handshake [][]byte) (*Client, error) {
+	client := &Client{
 		addr:        addr,
-		conn:        conn,
+		tlsConfig:   tlsConfig,
+		handshake:   handshake,
 		pendingReqs: make(chan *request, chanSize),
 		waitingReqs: make(chan *request, chanSize),
 		working:     &sync.WaitGroup{},
-	}, nil
+	}
+	conn, err := client.dial()
+	if err != nil {
+		return nil, err
+	}
+	client.conn = conn
+	return client, nil
+}
+
+// dial connects to server and sends handshake, a server restarted loses the state of previous connections
+func (client *Client) dial() (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if client.tlsConfig != nil {
+		conn, err = tls.Dial("tcp", client.addr, client.tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", client.addr)
+	}
+	if err != nil || client.handshake == nil {
+		return conn, err
+	}
+	if err := doHandshake(conn, client.handshake); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// doHandshake sends handshake and reads its reply before any other request is sent
+func doHandshake(conn net.Conn, handshake [][]byte) error {
+	_ = conn.SetDeadline(time.Now().Add(maxWait))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := conn.Write(reply.MakeMultiBulkReply(handshake).ToBytes()); err != nil {
+		return err
+	}
+	// nothing else is sent by server until handshake is replied, so the buffered reader reads no more than the reply
+	result, err := parser.ReadReply(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	if reply.IsErrorReply(result) {
+		return errors.New("handshake failed: " + strings.TrimSpace(string(result.ToBytes())))
+	}
+	return nil
 }
 
 // Start starts asynchronous goroutines
@@ -58,7 +117,7 @@ func (client *Client) Start() {
 	client.ticker = time.NewTicker(10 * time.Second)
 	go client.handleWrite()
 	go func() {
-		err := client.handleRead()
+		err := client.handleRead(client.conn)
 		if err != nil {
 			logger.Error(err)
 		}
@@ -91,14 +150,16 @@ func (client *Client) handleConnectionError(err error) error {
 			return err1
 		}
 	}
-	conn, err1 := net.Dial("tcp", client.addr)
+	// replies of the requests sent to the broken connection are never received
+	client.failWaitingReqs(err)
+	conn, err1 := client.dial()
 	if err1 != nil {
 		logger.Error(err1)
 		return err1
 	}
 	client.conn = conn
 	go func() {
-		_ = client.handleRead()
+		_ = client.handleRead(conn)
 	}()
 	return nil
 }
@@ -189,14 +250,43 @@ func (client *Client) finishRequest(reply resp.Reply) {
 	}
 }
 
-func (client *Client) handleRead() error {
-	ch := parser.ParseStream(client.conn)
+// handleRead reads replies of conn until it's broken, such as the server restarts
+func (client *Client) handleRead(conn net.Conn) error {
+	ch := parser.ParseStream(conn)
 	for payload := range ch {
 		if payload.Err != nil {
+			if isConnectionError(payload.Err) {
+				client.failWaitingReqs(payload.Err)
+				break
+			}
 			client.finishRequest(reply.MakeErrReply(payload.Err.Error()))
 			continue
 		}
 		client.finishRequest(payload.Data)
 	}
+	// the next request fails writing to the closed connection and reconnects
+	_ = conn.Close()
 	return nil
 }
+
+// failWaitingReqs finishes the requests waiting for replies with err
+func (client *Client) failWaitingReqs(err error) {
+	for {
+		select {
+		case req := <-client.waitingReqs:
+			if req == nil { // closed by Close
+				return
+			}
+			req.err = err
+			req.waiting.Done()
+		default:
+			return
+		}
+	}
+}
+
+// isConnectionError tells whether err is returned by the connection rather than invalid replies
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"crypto/tls"
+	"go-redis/lib/testutil"
+	"go-redis/resp/reply"
+	"go-redis/tcp"
+	"testing"
+)
+
+// startTLSServer runs an echo server authenticating clients by ca, requests are sent back as replies
+func startTLSServer(t *testing.T, ca *testutil.Cert) string {
+	server := testutil.MakeCert(t, "server", ca)
+	tlsConfig, err := tcp.MakeServerTLSConfig(server.CertFile, server.KeyFile, ca.CertFile, "yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testutil.StartTLSServer(t, tlsConfig, tcp.ListenAndServe, tcp.MakeHandler())
+}
+
+func TestMakeTLSClient(t *testing.T) {
+	ca := testutil.MakeCert(t, "ca", nil)
+	addr := startTLSServer(t, ca)
+	cert := testutil.MakeCert(t, "client", ca)
+	tlsConfig, err := tcp.MakeClientTLSConfig(cert.CertFile, cert.KeyFile, ca.CertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := MakeTLSClient(addr, tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	defer client.Close()
+
+	result := client.Send([][]byte{[]byte("PING")})
+	multiBulk, ok := result.(*reply.MultiBulkReply)
+	if !ok || len(multiBulk.Args) != 1 || string(multiBulk.Args[0]) != "PING" {
+		t.Errorf("expected the echoed request, actually %q", result.ToBytes())
+	}
+}
+
+func TestMakeTLSClient_Rejected(t *testing.T) {
+	ca := testutil.MakeCert(t, "ca", nil)
+	addr := startTLSServer(t, ca)
+	untrusted := testutil.MakeCert(t, "untrusted", testutil.MakeCert(t, "other-ca", nil))
+	tests := map[string]struct {
+		certFile, keyFile string
+	}{
+		"untrusted client certificate": {untrusted.CertFile, untrusted.KeyFile},
+		"no client certificate":        {"", ""},
+	}
+	for name, tt := range tests {
+		tlsConfig, err := tcp.MakeClientTLSConfig(tt.certFile, tt.keyFile, ca.CertFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tlsConfig.Certificates) > 0 {
+			// present the certificate even if it's not issued by the CAs accepted by the server
+			tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &tlsConfig.Certificates[0], nil
+			}
+		}
+		client, err := MakeTLSClient(addr, tlsConfig)
+		if err != nil {
+			// rejected during handshake by TLS 1.2
+			continue
+		}
+		// with TLS 1.3 the client finishes its handshake before the server verifies the certificate,
+		// the rejection is reported by the first reply
+		client.Start()
+		result := client.Send([][]byte{[]byte("PING")})
+		client.Close()
+		if !reply.IsErrorReply(result) {
+			t.Errorf("%s: expected the client to be rejected, actually %q", name, result.ToBytes())
+		}
+	}
+}
+
+func TestMakeTLSClient_UnknownServer(t *testing.T) {
+	ca := testutil.MakeCert(t, "ca", nil)
+	addr := startTLSServer(t, ca)
+	cert := testutil.MakeCert(t, "client", ca)
+	// the server is not trusted by system CAs
+	tlsConfig, err := tcp.MakeClientTLSConfig(cert.CertFile, cert.KeyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MakeTLSClient(addr, tlsConfig); err == nil {
+		t.Error("expected error verifying the server certificate")
+	}
+}
@@ -1,23 +1,70 @@
 package connection
 
 import (
-	"go-redis/lib/sync/wait"
+	"bufio"
+	"errors"
+	"go-redis/interface/resp"
 	"net"
 	"sync"
 	"time"
 )
 
+// writeBufferSize is the size of reply buffer, replies of pipelined commands are sent in batches
+const writeBufferSize = 16 * 1024
+
+// closeTimeout is the max time of waiting for replies being written before closing
+const closeTimeout = 10 * time.Second
+
+var errClosed = errors.New("use of closed connection")
+
 type Connection struct {
-	conn         net.Conn
-	waitingReply wait.Wait
-	selectedDB   int
-	mu           sync.Mutex
+	conn       net.Conn
+	selectedDB int
+
+	// replies are queued and written by writeLoop, so that a client not reading doesn't block the caller.
+	// mu protects the fields below
+	mu       sync.Mutex
+	outQueue [][]byte
+	// outPending is the number of bytes queued or being written
+	outPending int64
+	// unflushed is the number of bytes queued since the latest flush
+	unflushed      int
+	class          ClientClass
+	softLimitSince time.Time
+	// softLimitTimer checks the soft limit again when it's expired, since writeLoop may be blocked by the client
+	softLimitTimer *time.Timer
+	writeErr       error
+	closed         bool
+
+	writer     *bufio.Writer // used by writeLoop only
+	flushChan  chan struct{}
+	closeChan  chan struct{}
+	writerDone chan struct{}
+	closeOnce  sync.Once
+
+	// name of the user the client has authenticated as, empty means not authenticated yet
+	user string
+	// protocol is the version negotiated by HELLO, 0 means RESP2
+	protocol int
+	name     string
+
+	// queued commands for `multi`
+	multiState bool
+	queue      [][][]byte
+	watching   map[int]map[string]uint64
+	txErrors   []error
 }
 
 func NewConn(conn net.Conn) *Connection {
-	return &Connection{
-		conn: conn,
+	c := &Connection{
+		conn:       conn,
+		writer:     bufio.NewWriterSize(conn, writeBufferSize),
+		flushChan:  make(chan struct{}, 1),
+		closeChan:  make(chan struct{}),
+		writerDone: make(chan struct{}),
 	}
+	go c.writeLoop()
+	return c
 }
 
 // RemoteAddr returns the remote network address
@@ -25,24 +72,122 @@ func (c *Connection) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
 
+// Close writes queued replies and closes the connection
 func (c *Connection) Close() error {
-	c.waitingReply.WaitWithTimeout(10 * time.Second)
-	_ = c.conn.Close()
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.resetSoftLimit()
+		c.mu.Unlock()
+		close(c.closeChan)
+		// queued replies are dropped if the client doesn't read them in time
+		select {
+		case <-c.writerDone:
+		case <-time.After(closeTimeout):
+		}
+		_ = c.conn.Close()
+	})
 	return nil
 }
 
+// Write sends b to the client, along with the buffered replies before it
 func (c *Connection) Write(b []byte) error {
-	if len(b) == 0 {
-		return nil
-	}
+	return c.write(b, true)
+}
+
+// WriteBuffered appends b to the reply queue, it's sent when Flush is called or the buffer is full
+func (c *Connection) WriteBuffered(b []byte) error {
+	return c.write(b, false)
+}
+
+// Flush sends the buffered replies
+func (c *Connection) Flush() error {
+	return c.write(nil, true)
+}
+
+// SetClass sets the class deciding output buffer limits of the client
+func (c *Connection) SetClass(class ClientClass) {
+	c.mu.Lock()
+	c.class = class
+	c.mu.Unlock()
+}
+
+// TimeoutExempt tells whether the client is exempt from idle timeout, such as replicas and subscribers
+func (c *Connection) TimeoutExempt() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.class != ClassNormal
+}
+
+// write queues b, the client is closed if it reaches output buffer limits
+func (c *Connection) write(b []byte, flush bool) error {
 	c.mu.Lock()
-	c.waitingReply.Add(1)
-	defer func() {
-		c.waitingReply.Done()
+	defer c.mu.Unlock()
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	if c.closed {
+		return errClosed
+	}
+	if len(b) > 0 {
+		c.outQueue = append(c.outQueue, b)
+		c.outPending += int64(len(b))
+		c.unflushed += len(b)
+		if c.reachedOutputLimit() {
+			c.closeForOutputLimit()
+			return c.writeErr
+		}
+	}
+	if flush || c.unflushed >= writeBufferSize {
+		c.unflushed = 0
+		select {
+		case c.flushChan <- struct{}{}:
+		default: // writeLoop has been notified
+		}
+	}
+	return nil
+}
+
+// writeLoop writes queued replies until the connection is closed or broken
+func (c *Connection) writeLoop() {
+	defer close(c.writerDone)
+	for {
+		closing := false
+		select {
+		case <-c.flushChan:
+		case <-c.closeChan:
+			closing = true
+		}
+		c.mu.Lock()
+		chunks := c.outQueue
+		c.outQueue = nil
 		c.mu.Unlock()
-	}()
-	_, err := c.conn.Write(b)
-	return err
+
+		var size int64
+		var err error
+		for _, b := range chunks {
+			if _, err = c.writer.Write(b); err != nil {
+				break
+			}
+			size += int64(len(b))
+		}
+		if err == nil {
+			err = c.writer.Flush()
+		}
+
+		c.mu.Lock()
+		c.outPending -= size
+		if limit := outputBufferLimits[c.class]; c.outPending < limit.soft {
+			c.resetSoftLimit()
+		}
+		if err != nil && c.writeErr == nil {
+			c.writeErr = err
+		}
+		c.mu.Unlock()
+		if err != nil || closing {
+			return
+		}
+	}
 }
 
 func (c *Connection) GetDBIndex() int {
@@ -52,3 +197,84 @@ func (c *Connection) GetDBIndex() int {
 func (c *Connection) SelectDB(dbNum int) {
 	c.selectedDB = dbNum
 }
+
+// SetUser stores the authenticated user name
+func (c *Connection) SetUser(name string) {
+	c.user = name
+}
+
+// GetUser returns the authenticated user name
+func (c *Connection) GetUser() string {
+	return c.user
+}
+
+// SetProtocol sets the protocol version used to encode replies
+func (c *Connection) SetProtocol(protocol int) {
+	c.protocol = protocol
+}
+
+// GetProtocol returns the protocol version used to encode replies
+func (c *Connection) GetProtocol() int {
+	if c.protocol == 0 {
+		return resp.Resp2
+	}
+	return c.protocol
+}
+
+// SetName stores the client name
+func (c *Connection) SetName(name string) {
+	c.name = name
+}
+
+// GetName returns the client name
+func (c *Connection) GetName() string {
+	return c.name
+}
+
+// InMultiState tells is connection in an uncommitted transaction
+func (c *Connection) InMultiState() bool {
+	return c.multiState
+}
+
+// SetMultiState sets transaction flag
+func (c *Connection) SetMultiState(state bool) {
+	if !state { // reset data when cancel multi
+		c.watching = nil
+		c.queue = nil
+	}
+	c.multiState = state
+}
+
+// GetQueuedCmdLine returns queued commands of current transaction
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	return c.queue
+}
+
+// EnqueueCmd  enqueues command of current transaction
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.queue = append(c.queue, cmdLine)
+}
+
+// AddTxError stores syntax error within transaction
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+// GetTxErrors returns syntax error within transaction
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
+
+// ClearQueuedCmds clears queued commands of current transaction
+func (c *Connection) ClearQueuedCmds() {
+	c.queue = nil
+	c.txErrors = nil
+}
+
+// GetWatching returns watching keys grouped by db index, and their version code when started watching
+func (c *Connection) GetWatching() map[int]map[string]uint64 {
+	if c.watching == nil {
+		c.watching = make(map[int]map[string]uint64)
+	}
+	return c.watching
+}
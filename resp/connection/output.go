@@ -0,0 +1,133 @@
+package connection
+
+import (
+	"errors"
+	"go-redis/config"
+	"go-redis/lib/logger"
+	"go-redis/lib/sync/atomic"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientClass decides the output buffer limits of a client
+type ClientClass int
+
+const (
+	// ClassNormal is the class of ordinary clients
+	ClassNormal ClientClass = iota
+	// ClassReplica is the class of replicas receiving the replication stream
+	ClassReplica
+	// ClassPubSub is the class of clients subscribing channels
+	ClassPubSub
+)
+
+// outputBufferLimit closes the client if its pending replies reach the hard limit,
+// or stay above the soft limit for softSeconds. 0 disables the limit
+type outputBufferLimit struct {
+	hard        int64
+	soft        int64
+	softSeconds int64
+}
+
+// outputBufferLimits are indexed by ClientClass, defaults are the same as redis
+var outputBufferLimits = []outputBufferLimit{
+	ClassNormal:  {},
+	ClassReplica: {hard: 256 << 20, soft: 64 << 20, softSeconds: 60},
+	ClassPubSub:  {hard: 32 << 20, soft: 8 << 20, softSeconds: 60},
+}
+
+// outputLimitDisconnections counts the clients closed for reaching output buffer limits
+var outputLimitDisconnections atomic.Int64
+
+var errOutputLimitReached = errors.New("output buffer limit reached")
+
+// SetupOutputBufferLimits sets limits by client-output-buffer-limit, classes not mentioned keep the defaults
+func SetupOutputBufferLimits() error {
+	fields := strings.Fields(config.Properties.ClientOutputBufferLimit)
+	if len(fields)%4 != 0 {
+		return errors.New("client-output-buffer-limit must be groups of <class> <hard limit> <soft limit> <soft seconds>")
+	}
+	for i := 0; i < len(fields); i += 4 {
+		var class ClientClass
+		switch strings.ToLower(fields[i]) {
+		case "normal":
+			class = ClassNormal
+		case "replica", "slave":
+			class = ClassReplica
+		case "pubsub":
+			class = ClassPubSub
+		default:
+			return errors.New("invalid client class: " + fields[i])
+		}
+		hard, err := config.ParseSize(fields[i+1])
+		if err != nil || hard < 0 {
+			return errors.New("invalid hard limit: " + fields[i+1])
+		}
+		soft, err := config.ParseSize(fields[i+2])
+		if err != nil || soft < 0 {
+			return errors.New("invalid soft limit: " + fields[i+2])
+		}
+		softSeconds, err := strconv.ParseInt(fields[i+3], 10, 64)
+		if err != nil || softSeconds < 0 {
+			return errors.New("invalid soft seconds: " + fields[i+3])
+		}
+		outputBufferLimits[class] = outputBufferLimit{hard: hard, soft: soft, softSeconds: softSeconds}
+	}
+	return nil
+}
+
+// OutputLimitDisconnections returns the number of clients closed for reaching output buffer limits
+func OutputLimitDisconnections() int64 {
+	return outputLimitDisconnections.Get()
+}
+
+// reachedOutputLimit tells whether pending replies exceed the limits of client class, c.mu must be held
+func (c *Connection) reachedOutputLimit() bool {
+	limit := outputBufferLimits[c.class]
+	if limit.hard > 0 && c.outPending >= limit.hard {
+		return true
+	}
+	if limit.soft > 0 && c.outPending >= limit.soft {
+		now := time.Now()
+		softDuration := time.Duration(limit.softSeconds) * time.Second
+		if c.softLimitSince.IsZero() {
+			c.softLimitSince = now
+			c.softLimitTimer = time.AfterFunc(softDuration, c.checkOutputLimit)
+			return false
+		}
+		return now.Sub(c.softLimitSince) >= softDuration
+	}
+	c.resetSoftLimit()
+	return false
+}
+
+// resetSoftLimit is called when pending replies are below the soft limit, c.mu must be held
+func (c *Connection) resetSoftLimit() {
+	c.softLimitSince = time.Time{}
+	if c.softLimitTimer != nil {
+		c.softLimitTimer.Stop()
+		c.softLimitTimer = nil
+	}
+}
+
+// checkOutputLimit is called by softLimitTimer, the client may not be written to after reaching the soft limit
+func (c *Connection) checkOutputLimit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.writeErr != nil {
+		return
+	}
+	if c.reachedOutputLimit() {
+		c.closeForOutputLimit()
+	}
+}
+
+// closeForOutputLimit closes the client reaching output buffer limits, c.mu must be held
+func (c *Connection) closeForOutputLimit() {
+	c.writeErr = errOutputLimitReached
+	outputLimitDisconnections.Add(1)
+	logger.Warn("closing client " + c.RemoteAddr().String() + " for reaching output buffer limit")
+	// closing socket unblocks writeLoop and the goroutine reading requests
+	_ = c.conn.Close()
+}
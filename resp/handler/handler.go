@@ -2,23 +2,30 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"go-redis/cluster"
 	"go-redis/config"
 	"go-redis/database"
 	databaseface "go-redis/interface/database"
+	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/lib/sync/atomic"
+	"go-redis/lib/sync/wait"
 	"go-redis/resp/connection"
 	"go-redis/resp/parser"
 	"go-redis/resp/reply"
 	"io"
 	"net"
+	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
-	unknownErrReplyBytes = []byte("-ERR unknown\r\n")
+	unknownErrReplyBytes    = []byte("-ERR unknown\r\n")
+	maxClientsErrReplyBytes = []byte("-ERR max number of clients reached\r\n")
+	shuttingDownErrReply    = reply.MakeErrReply("ERR server is shutting down")
 )
 
 // RespHandler implements tcp.Handler and serves as a redis handler
@@ -26,11 +33,30 @@ type RespHandler struct {
 	activeConn sync.Map // *client -> placeholder
 	db         databaseface.Database
 	closing    atomic.Boolean // refusing new client and new request
+
+	// executing counts in-flight commands, execGate makes checking closing and counting atomic
+	executing wait.Wait
+	execGate  sync.RWMutex
+	// shutdownMu protects shutdownState and abortChan, abortChan is not nil while shutdown can be aborted
+	shutdownMu    sync.Mutex
+	shutdownState int
+	abortChan     chan struct{}
+	shutdownChan  chan struct{}
+	shutdownOnce  sync.Once
+
+	connectedClients    atomic.Int64 // number of clients being served
+	rejectedConnections atomic.Int64 // number of connections refused because of maxclients
 }
 
 // MakeHandler creates a RespHandler instance
 func MakeHandler() *RespHandler {
 	var db databaseface.Database
+	if err := database.SetupACL(); err != nil {
+		panic(err)
+	}
+	if err := connection.SetupOutputBufferLimits(); err != nil {
+		panic(err)
+	}
 	if config.Properties.Self != "" &&
 		len(config.Properties.Peers) > 0 {
 		db = cluster.MakeClusterDatabase()
@@ -39,7 +65,8 @@ func MakeHandler() *RespHandler {
 	}
 
 	return &RespHandler{
-		db: db,
+		db:           db,
+		shutdownChan: make(chan struct{}),
 	}
 }
 
@@ -53,62 +80,168 @@ func (h *RespHandler) closeClient(client *connection.Connection) {
 func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	if h.closing.Get() {
 		// closing handler refuse new connection
-		<-ctx.Done()
 		_ = conn.Close()
+		return
+	}
+	if !h.admit() {
+		_, _ = conn.Write(maxClientsErrReplyBytes)
+		_ = conn.Close()
+		logger.Warn("max number of clients reached, connection refused: " + conn.RemoteAddr().String())
+		return
 	}
+	defer h.connectedClients.Add(-1)
 
 	client := connection.NewConn(conn)
 	h.activeConn.Store(client, 1)
 
-	ch := parser.ParseStream(conn)
-	for payload := range ch {
-		if payload.Err != nil {
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
+	// requests are parsed in this goroutine, replies of pipelined requests are flushed together
+	reader := parser.NewParser(conn)
+	idleTimeout := time.Duration(config.Properties.Timeout) * time.Second
+	for {
+		if idleTimeout > 0 {
+			// blocked clients are not affected since requests aren't read while a command is executing
+			var deadline time.Time
+			if !client.TimeoutExempt() {
+				deadline = time.Now().Add(idleTimeout)
+			}
+			_ = conn.SetReadDeadline(deadline)
+		}
+		cmdLine, fatal, err := reader.ReadCommand()
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				h.closeClient(client)
+				logger.Info("closing idle client: " + client.RemoteAddr().String())
+				return
+			}
+			if err == io.EOF ||
+				err == io.ErrUnexpectedEOF ||
+				strings.Contains(err.Error(), "use of closed network connection") {
 				// connection closed
 				h.closeClient(client)
 				logger.Info("connection closed: " + client.RemoteAddr().String())
 				return
 			}
 			// protocol err
-			errReply := reply.MakeErrReply(payload.Err.Error())
-			err := client.Write(errReply.ToBytes())
-			if err != nil {
+			errReply := reply.MakeErrReply(err.Error())
+			if fatal {
+				// parser can't continue after a fatal protocol error, such as too big request
+				logger.Warn("closing client " + client.RemoteAddr().String() + ": " + err.Error())
+			}
+			if err := client.Write(errReply.ToBytes()); err != nil || fatal {
 				h.closeClient(client)
 				logger.Info("connection closed: " + client.RemoteAddr().String())
 				return
 			}
 			continue
 		}
-		if payload.Data == nil {
-			logger.Error("empty payload")
-			continue
-		}
-		r, ok := payload.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk reply")
-			continue
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		var result resp.Reply
+		if errReply := h.authorize(client, cmdLine); errReply != nil {
+			result = errReply
+		} else if cmdName == "shutdown" {
+			if client.InMultiState() {
+				result = reply.MakeErrReply("ERR Command not allowed inside a transaction")
+			} else if result = h.execShutdown(cmdLine[1:]); result == nil {
+				// the server is shutting down
+				h.closeClient(client)
+				return
+			}
+		} else if !h.beginExec() {
+			result = shuttingDownErrReply
+		} else {
+			if cmdName == "info" {
+				result = h.execInfo(cmdLine[1:])
+			} else {
+				result = h.db.Exec(client, cmdLine)
+			}
+			h.executing.Done()
 		}
-		result := h.db.Exec(client, r.Args)
 		if result != nil {
-			_ = client.Write(result.ToBytes())
+			err = client.WriteBuffered(reply.Encode(result, client.GetProtocol()))
 		} else {
-			_ = client.Write(unknownErrReplyBytes)
+			err = client.WriteBuffered(unknownErrReplyBytes)
 		}
+		if err == nil && reader.Buffered() == 0 {
+			// no more pipelined requests
+			err = client.Flush()
+		}
+		if err != nil {
+			h.closeClient(client)
+			logger.Info("connection closed: " + client.RemoteAddr().String())
+			return
+		}
+	}
+}
+
+// beginExec counts an in-flight command, returns false if the handler is closing
+func (h *RespHandler) beginExec() bool {
+	h.execGate.RLock()
+	defer h.execGate.RUnlock()
+	if h.closing.Get() {
+		return false
+	}
+	h.executing.Add(1)
+	return true
+}
+
+// admit counts a new client, returns false if maxclients is reached
+func (h *RespHandler) admit() bool {
+	n := h.connectedClients.Add(1)
+	if config.Properties.MaxClients > 0 && n > int64(config.Properties.MaxClients) {
+		h.connectedClients.Add(-1)
+		h.rejectedConnections.Add(1)
+		return false
+	}
+	return true
+}
+
+// ConnectedClients returns the number of clients being served
+func (h *RespHandler) ConnectedClients() int64 {
+	return h.connectedClients.Get()
+}
+
+// RejectedConnections returns the number of connections refused because of maxclients
+func (h *RespHandler) RejectedConnections() int64 {
+	return h.rejectedConnections.Get()
+}
+
+// authorize rejects commands of unauthenticated or unprivileged clients, AUTH is always allowed
+func (h *RespHandler) authorize(client *connection.Connection, cmdLine [][]byte) resp.Reply {
+	if cmdName := strings.ToLower(string(cmdLine[0])); cmdName == "auth" || cmdName == "hello" {
+		// HELLO checks authentication itself since it may authenticate the client
+		return nil
+	}
+	if errReply := database.Authorize(client, cmdLine); errReply != nil {
+		return errReply
 	}
+	return nil
 }
 
-// Close stops handler
+// Close stops handler, in-flight commands are finished and data is persisted before closing database
 func (h *RespHandler) Close() error {
 	logger.Info("handler shutting down...")
-	h.closing.Set(true)
-	// TODO: concurrent wait
+	h.shutdownMu.Lock()
+	ready := h.shutdownState == shutdownReady
+	h.shutdownMu.Unlock()
+	if !ready {
+		// shutdown by signal, the server exits even if it failed to persist data
+		if err := h.prepareShutdown(databaseface.SaveDefault, false); err != nil {
+			logger.Error("prepare shutdown failed: " + err.Error())
+		}
+		h.closing.Set(true)
+	}
+	// clients are closed in parallel, each of them may wait for replies being written until timeout
+	var wg sync.WaitGroup
 	h.activeConn.Range(func(key interface{}, val interface{}) bool {
 		client := key.(*connection.Connection)
-		_ = client.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = client.Close()
+		}()
 		return true
 	})
+	wg.Wait()
 	h.db.Close()
 	return nil
 }
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"go-redis/resp/reply"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startHandler serves a RespHandler on a loopback listener and returns a connected client
+func startHandler(b *testing.B) net.Conn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	h := MakeHandler()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go h.Handle(context.Background(), conn)
+		}
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = conn.Close()
+		_ = listener.Close()
+		_ = h.Close()
+	})
+	return conn
+}
+
+// benchmarkPipeline sends SET commands in batches of pipeline and waits for all replies of a batch
+func benchmarkPipeline(b *testing.B, pipeline int) {
+	conn := startHandler(b)
+	var batch []byte
+	for i := 0; i < pipeline; i++ {
+		cmd := [][]byte{[]byte("SET"), []byte("key:" + strconv.Itoa(i)), bytes.Repeat([]byte("v"), 64)}
+		batch = append(batch, reply.MakeMultiBulkReply(cmd).ToBytes()...)
+	}
+	replies := make([]byte, pipeline*len("+OK\r\n"))
+	b.SetBytes(int64(len(batch)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.Write(batch); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadFull(conn, replies); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHandle_NoPipeline(b *testing.B) {
+	benchmarkPipeline(b, 1)
+}
+
+func BenchmarkHandle_Pipeline100(b *testing.B) {
+	benchmarkPipeline(b, 100)
+}
+
+// countingConn counts the writes of replies
+type countingConn struct {
+	net.Conn
+	writes atomic.Int32
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(b)
+}
+
+func TestHandle_FlushPipelinedReplies(t *testing.T) {
+	server, client := net.Pipe()
+	conn := &countingConn{Conn: server}
+	h := MakeHandler()
+	go h.Handle(context.Background(), conn)
+	defer func() {
+		_ = client.Close()
+		_ = h.Close()
+	}()
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	tests := []struct {
+		name     string
+		requests string
+		replies  string
+	}{
+		{"single request", "PING\r\n", "+PONG\r\n"},
+		{"pipelined requests", strings.Repeat("*1\r\n$4\r\nPING\r\n", 100), strings.Repeat("+PONG\r\n", 100)},
+		{"mixed with inline", "SET k \"a b\"\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\nGET missing\r\n", "+OK\r\n$3\r\na b\r\n$-1\r\n"},
+	}
+	for _, tt := range tests {
+		before := conn.writes.Load()
+		if _, err := client.Write([]byte(tt.requests)); err != nil {
+			t.Fatal(err)
+		}
+		replies := make([]byte, len(tt.replies))
+		if _, err := io.ReadFull(client, replies); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(replies) != tt.replies {
+			t.Errorf("%s: expected %q, actually %q", tt.name, tt.replies, replies)
+		}
+		if writes := conn.writes.Load() - before; writes != 1 {
+			t.Errorf("%s: expected replies to be flushed by 1 write, actually %d", tt.name, writes)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"fmt"
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+	"strings"
+)
+
+// execInfo returns server statistics, supports sections: clients, stats
+func (h *RespHandler) execInfo(args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		return reply.MakeSyntaxErrReply()
+	}
+	section := "all"
+	if len(args) == 1 {
+		section = strings.ToLower(string(args[0]))
+	}
+	var sb strings.Builder
+	if section == "all" || section == "default" || section == "clients" {
+		sb.WriteString("# Clients\r\n")
+		sb.WriteString(fmt.Sprintf("connected_clients:%d\r\n", h.ConnectedClients()))
+		sb.WriteString(fmt.Sprintf("maxclients:%d\r\n", config.Properties.MaxClients))
+	}
+	if section == "all" || section == "default" || section == "stats" {
+		if sb.Len() > 0 {
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString("# Stats\r\n")
+		sb.WriteString(fmt.Sprintf("rejected_connections:%d\r\n", h.RejectedConnections()))
+		sb.WriteString(fmt.Sprintf("client_output_buffer_limit_disconnections:%d\r\n", connection.OutputLimitDisconnections()))
+	}
+	return reply.MakeBulkReply([]byte(sb.String()))
+}
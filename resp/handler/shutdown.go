@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"go-redis/config"
+	databaseface "go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/resp/reply"
+	"strings"
+	"time"
+)
+
+// states of shutdown
+const (
+	shutdownNone    = iota
+	shutdownWaiting // waiting for in-flight commands, can be aborted
+	shutdownReady   // data has been persisted, the server is exiting
+)
+
+var (
+	errShutdownInProgress = errors.New("shutdown is in progress")
+	errShutdownAborted    = errors.New("shutdown is aborted")
+)
+
+// execShutdown implements SHUTDOWN [NOSAVE|SAVE] [NOW] [ABORT]
+// It returns nil if the server is shutting down, and the connection is closed without reply
+func (h *RespHandler) execShutdown(args [][]byte) resp.Reply {
+	mode := databaseface.SaveDefault
+	now, abort := false, false
+	for _, arg := range args {
+		switch strings.ToLower(string(arg)) {
+		case "nosave":
+			if mode == databaseface.SaveForced {
+				return reply.MakeSyntaxErrReply()
+			}
+			mode = databaseface.SaveDisabled
+		case "save":
+			if mode == databaseface.SaveDisabled {
+				return reply.MakeSyntaxErrReply()
+			}
+			mode = databaseface.SaveForced
+		case "now":
+			now = true
+		case "abort":
+			abort = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if abort {
+		if len(args) > 1 {
+			return reply.MakeSyntaxErrReply()
+		}
+		if !h.abortShutdown() {
+			return reply.MakeErrReply("ERR No shutdown in progress.")
+		}
+		return reply.MakeOKReply()
+	}
+	if err := h.prepareShutdown(mode, now); err != nil {
+		logger.Warn("SHUTDOWN failed: " + err.Error())
+		return reply.MakeErrReply("ERR Errors trying to SHUTDOWN. Check logs.")
+	}
+	logger.Info("user requested shutdown...")
+	h.shutdownOnce.Do(func() {
+		close(h.shutdownChan)
+	})
+	return nil
+}
+
+// prepareShutdown refuses new commands, waits for in-flight commands unless now is true, then persists data.
+// The handler goes on serving if it's aborted or failed to persist data
+func (h *RespHandler) prepareShutdown(mode databaseface.SaveMode, now bool) error {
+	h.shutdownMu.Lock()
+	if h.shutdownState != shutdownNone {
+		h.shutdownMu.Unlock()
+		return errShutdownInProgress
+	}
+	h.shutdownState = shutdownWaiting
+	abortChan := make(chan struct{})
+	h.abortChan = abortChan
+	h.shutdownMu.Unlock()
+
+	h.execGate.Lock()
+	h.closing.Set(true)
+	h.execGate.Unlock()
+
+	if !now {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if timeout := config.Properties.ShutdownTimeout; timeout > 0 {
+				if h.executing.WaitWithTimeout(time.Duration(timeout) * time.Second) {
+					logger.Warn("timeout waiting for in-flight commands")
+				}
+			} else {
+				h.executing.Wait()
+			}
+		}()
+		select {
+		case <-done:
+		case <-abortChan:
+			h.resetShutdown()
+			return errShutdownAborted
+		}
+	}
+
+	h.shutdownMu.Lock()
+	select {
+	case <-abortChan:
+		// aborted just before waiting finished
+		h.shutdownMu.Unlock()
+		h.resetShutdown()
+		return errShutdownAborted
+	default:
+	}
+	h.abortChan = nil
+	h.shutdownMu.Unlock()
+
+	if err := h.db.PrepareShutdown(mode); err != nil {
+		h.resetShutdown()
+		return err
+	}
+	h.shutdownMu.Lock()
+	h.shutdownState = shutdownReady
+	h.shutdownMu.Unlock()
+	return nil
+}
+
+// abortShutdown cancels the shutdown waiting for in-flight commands, returns false if there is no such shutdown
+func (h *RespHandler) abortShutdown() bool {
+	h.shutdownMu.Lock()
+	defer h.shutdownMu.Unlock()
+	if h.abortChan == nil {
+		return false
+	}
+	close(h.abortChan)
+	h.abortChan = nil
+	logger.Info("shutdown is aborted")
+	return true
+}
+
+// resetShutdown accepts commands again after the shutdown is aborted or failed
+func (h *RespHandler) resetShutdown() {
+	h.execGate.Lock()
+	h.closing.Set(false)
+	h.execGate.Unlock()
+	h.shutdownMu.Lock()
+	h.shutdownState = shutdownNone
+	h.abortChan = nil
+	h.shutdownMu.Unlock()
+}
+
+// ShutdownRequested is closed after SHUTDOWN command succeeds
+func (h *RespHandler) ShutdownRequested() <-chan struct{} {
+	return h.shutdownChan
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"errors"
+)
+
+// maxInlineLen is the max length of an inline command, the connection is closed if it's exceeded
+const maxInlineLen = 64 * 1024
+
+var (
+	errUnbalancedQuotes = errors.New("ERR Protocol error: unbalanced quotes in request")
+	errTooBigInline     = errors.New("ERR Protocol error: too big inline request")
+	errTooBigMultiBulk  = errors.New("ERR Protocol error: too big mbulk count string")
+)
+
+// parseInlineCommand splits an inline command such as `set key "hello world"` into arguments.
+// Quoting rules are the same as redis-cli: escapes like \n, \t and \xHH are supported in double quotes,
+// only \' is supported in single quotes, and a closing quote must be followed by space
+func parseInlineCommand(line []byte) ([][]byte, error) {
+	args := make([][]byte, 0)
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+		var arg []byte
+		inDoubleQuotes, inSingleQuotes := false, false
+		for done := false; !done; {
+			switch {
+			case inDoubleQuotes:
+				if i >= len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				if line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' &&
+					isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					arg = append(arg, hexDigitToInt(line[i+2])<<4|hexDigitToInt(line[i+3]))
+					i += 3
+				} else if line[i] == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, line[i])
+					}
+				} else if line[i] == '"' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, line[i])
+				}
+			case inSingleQuotes:
+				if i >= len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				if line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if line[i] == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, line[i])
+				}
+			default:
+				if i >= len(line) {
+					done = true
+					break
+				}
+				switch line[i] {
+				case ' ', '\n', '\r', '\t', '\v', '\f', 0:
+					done = true
+				case '"':
+					inDoubleQuotes = true
+				case '\'':
+					inSingleQuotes = true
+				default:
+					arg = append(arg, line[i])
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		if arg == nil {
+			arg = []byte{}
+		}
+		args = append(args, arg)
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\v' || b == '\f' || b == 0
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+func hexDigitToInt(b byte) byte {
+	switch {
+	case b >= '0' && b <= '9':
+		return b - '0'
+	case b >= 'a' && b <= 'f':
+		return b - 'a' + 10
+	}
+	return b - 'A' + 10
+}
@@ -2,11 +2,14 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
+	"go-redis/config"
 	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/resp/reply"
 	"io"
+	"math"
 	"runtime/debug"
 	"strconv"
 	"strings"
@@ -17,23 +20,21 @@ type Payload struct {
 	Err  error
 }
 
-type readState struct {
-	//解析单行还是多行数据
-	readingMultiLine bool
-	//该cmd应该有几个参数 记录是否解析完
-	expectedArgsCount int
-	//状态位
-	msgType byte
-	//已经解析的参数
-	args [][]byte
-	//字节组长度
-	bulkLen int64
-}
+const (
+	// readBufferSize is the size of read buffer of a connection, pipelined requests are read in batches
+	readBufferSize = 16 * 1024
+	// maxArgsPrealloc limits the arguments allocated before they are received
+	maxArgsPrealloc = 1024
+)
 
-func (s *readState) finished() bool {
-	return s.expectedArgsCount > 0 && len(s.args) == s.expectedArgsCount
-}
+var (
+	errInvalidMultiBulkLen = errors.New("ERR Protocol error: invalid multibulk length")
+	errInvalidBulkLen      = errors.New("ERR Protocol error: invalid bulk length")
+	errTooBigBulk          = errors.New("ERR Protocol error: too big bulk count string")
+	errQueryBufferLimit    = errors.New("ERR Protocol error: query buffer limit exceeded")
+)
 
+// ParseStream reads replies from the stream, it's used by clients
 func ParseStream(reader io.Reader) <-chan *Payload {
 	ch := make(chan *Payload)
 	go parse0(reader, ch)
@@ -46,182 +47,196 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 			logger.Error(string(debug.Stack()))
 		}
 	}()
-	bufReader := bufio.NewReader(reader)
-	var state readState
+	parseReplies(bufio.NewReader(reader), ch)
+}
+
+// Parser reads requests synchronously in the goroutine serving the connection.
+// Besides multi bulk, requests may be inline commands such as "PING\r\n" typed in telnet
+type Parser struct {
+	reader *bufio.Reader
+
+	// limits of requests, 0 means no limit
+	maxBulkLen       int64
+	maxMultibulkLen  int64
+	queryBufferLimit int64
+	// queryLen is the number of bytes of the request being read
+	queryLen int64
+}
+
+// NewParser creates a Parser reading requests from reader, it's used by server
+func NewParser(reader io.Reader) *Parser {
+	return &Parser{
+		reader:           bufio.NewReaderSize(reader, readBufferSize),
+		maxBulkLen:       config.Properties.ProtoMaxBulkLen,
+		maxMultibulkLen:  config.Properties.ProtoMaxMultibulkLen,
+		queryBufferLimit: config.Properties.ClientQueryBufferLimit,
+	}
+}
+
+// Buffered returns the number of bytes read from the connection but not parsed yet,
+// 0 means there are no more pipelined requests and the replies should be flushed
+func (p *Parser) Buffered() int {
+	return p.reader.Buffered()
+}
+
+// ReadCommand blocks until a complete command is read, empty commands are skipped.
+// It returns the command line, whether the connection should be closed, and error.
+// The connection should be closed after io error, exceeding limits or invalid data in the middle of multi bulk,
+// while invalid data is discarded after other errors
+func (p *Parser) ReadCommand() ([][]byte, bool, error) {
 	for {
-		// read line
-		msg, ioErr, err := readLine(bufReader, &state)
+		line, err := readLimitedLine(p.reader, maxInlineLen)
 		if err != nil {
-			if ioErr {
-				ch <- &Payload{Err: err}
-				close(ch)
-				return
-			}
-			// 处理协议错误时，跳过无效数据
-			discardInvalidData(bufReader) // 新增跳过无效数据的逻辑
-			ch <- &Payload{Err: err}
-			state = readState{}
-			continue
+			return nil, true, err
 		}
-
-		// parse line
 		/*
-			*：多行批量回复（multi bulk reply）
-			$：批量回复（bulk reply）
-			其他字符：单行回复（single line reply）
+			*：多行批量请求（multi bulk）
+			其他字符：内联命令（inline command）
 		*/
-		if !state.readingMultiLine { // 用来设置状态机 或 读取单行回复+ - :
-			// receive new response
-			if msg[0] == '*' {
-				// multi bulk reply
-				err = parseMultiBulkHeader(msg, &state) // 解析协议头 设置状态机 state.readingMultiLine = true
-				if err != nil {
-					ch <- &Payload{
-						Err: err,
-					}
-					state = readState{} // reset state
-					continue
-				}
-				if state.expectedArgsCount == 0 { // 参数数量为0 直接返回空reply
-					ch <- &Payload{
-						Data: reply.MakeEmptyMultiBulkReply(),
-					}
-					state = readState{} // reset state
-					continue
-				}
-			} else if msg[0] == '$' { // bulk reply
-				err = parseBulkHeader(msg, &state) // 解析协议头 设置状态机 state.readingMultiLine = true
-				if err != nil {
-					ch <- &Payload{
-						Err: err,
-					}
-					state = readState{} // reset state
-					continue
-				}
-				if state.bulkLen == -1 { // 空字符串
-					ch <- &Payload{
-						Data: reply.MakeNullBulkReply(),
-					}
-					state = readState{} // reset state
-					continue
-				}
-			} else {
-				// single line reply
-				result, err := parseSingleLineReply(msg)
-				ch <- &Payload{
-					Data: result,
-					Err:  err,
+		switch line[0] {
+		case '*':
+			args, fatal, err := p.readMultiBulk(line)
+			if err != nil {
+				if !fatal {
+					// 处理协议错误时，跳过无效数据
+					discardInvalidData(p.reader)
 				}
-				state = readState{} // reset state
-				continue
+				return nil, fatal, err
 			}
-		} else {
-			// receive following bulk reply
-			err = readBody(msg, &state)
+			if len(args) > 0 {
+				return args, false, nil
+			}
+		default:
+			args, err := parseInlineCommand(line)
 			if err != nil {
-				ch <- &Payload{
-					Err: err,
-				}
-				state = readState{} // reset state
-				continue
+				return nil, false, err
 			}
-			// if sending finished
-			if state.finished() {
-				var result resp.Reply
-				if state.msgType == '*' {
-					result = reply.MakeMultiBulkReply(state.args)
-				} else if state.msgType == '$' {
-					result = reply.MakeBulkReply(state.args[0])
-				}
-				ch <- &Payload{
-					Data: result,
-					Err:  err,
-				}
-				state = readState{}
+			if len(args) > 0 { // skip empty line
+				return args, false, nil
 			}
 		}
 	}
 }
 
-// 读取当前行 直到\n 返回msg，是否io error，error
-func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
-	var msg []byte
-	var err error
-	//单行协议 + - ：，或者*3\r\n $5\r\n协议头
-	if state.bulkLen == 0 { // read normal line
-		msg, err = bufReader.ReadBytes('\n') //存储到第一次遇到\n
-		// io错误
+// readMultiBulk reads arguments following the header
+/*
+*3\r\n$3\r\nset\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
+ */
+func (p *Parser) readMultiBulk(header []byte) ([][]byte, bool, error) {
+	if len(header) < 3 || header[len(header)-2] != '\r' {
+		return nil, false, protocolError(header)
+	}
+	p.queryLen = 0
+	if err := p.consume(int64(len(header))); err != nil {
+		return nil, true, err
+	}
+	// 读取元素（参数）个数
+	count, err := strconv.ParseInt(string(header[1:len(header)-2]), 10, 64)
+	if err != nil {
+		return nil, false, protocolError(header)
+	}
+	if count <= 0 {
+		// like redis, empty or null multi bulk such as "*-1" is ignored
+		return nil, false, nil
+	}
+	// the following data can't be skipped reliably, so the connection is closed
+	if count > math.MaxInt32 || (p.maxMultibulkLen > 0 && count > p.maxMultibulkLen) {
+		return nil, true, errInvalidMultiBulkLen
+	}
+	args := make([][]byte, 0, min(count, maxArgsPrealloc))
+	// errors in the middle of multi bulk are fatal, since the rest of it would be parsed as new commands
+	for i := int64(0); i < count; i++ {
+		line, err := readLimitedLine(p.reader, maxInlineLen)
 		if err != nil {
 			return nil, true, err
 		}
-		// 协议错误
-		if len(msg) == 0 || msg[len(msg)-2] != '\r' {
-			return nil, false, errors.New("protocol error: " + string(msg))
+		if err := p.consume(int64(len(line))); err != nil {
+			return nil, true, err
+		}
+		if len(line) < 4 || line[0] != '$' || line[len(line)-2] != '\r' {
+			return nil, true, protocolError(line)
 		}
-	} else { // read bulk line (binary safe)
-		msg = make([]byte, state.bulkLen+2)  // 存储 一个字符串\r\n
-		_, err = io.ReadFull(bufReader, msg) // 可能包含任意二进制数据（包括 \r\n），如果使用 ReadBytes，可能会错误地将数据截断
+		bulkLen, err := strconv.ParseInt(string(line[1:len(line)-2]), 10, 64)
 		if err != nil {
+			return nil, true, protocolError(line)
+		}
+		// null bulk "$-1" is not an argument
+		if bulkLen < 0 || (p.maxBulkLen > 0 && bulkLen > p.maxBulkLen) {
+			return nil, true, errInvalidBulkLen
+		}
+		if err := p.consume(bulkLen + 2); err != nil {
 			return nil, true, err
 		}
-		if len(msg) == 0 ||
-			msg[len(msg)-2] != '\r' ||
-			msg[len(msg)-1] != '\n' ||
-			int64(len(msg)-2) != state.bulkLen {
-			return nil, false, errors.New("protocol error: " + string(msg))
+		// 可能包含任意二进制数据（包括 \r\n），所以按长度读取
+		arg, err := p.readBulk(bulkLen + 2)
+		if err != nil {
+			return nil, true, err
 		}
-		state.bulkLen = 0
+		if arg[bulkLen] != '\r' || arg[bulkLen+1] != '\n' {
+			return nil, true, errors.New("protocol error: bulk string is not terminated by CRLF")
+		}
+		args = append(args, arg[:bulkLen])
 	}
-	return msg, false, nil
+	return args, false, nil
 }
 
-/*
-*3\r\n
- */
-func parseMultiBulkHeader(msg []byte, state *readState) error {
-	var err error
-	var expectedLine uint64
-	// 读取元素（参数）个数
-	expectedLine, err = strconv.ParseUint(string(msg[1:len(msg)-2]), 10, 32)
-	if err != nil {
-		return errors.New("protocol error: " + string(msg))
+// readBulk reads n bytes. Large bulk is read incrementally,
+// so that memory is allocated for the data received rather than the length claimed by client
+func (p *Parser) readBulk(n int64) ([]byte, error) {
+	if n <= readBufferSize {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(p.reader, buf)
+		return buf, err
 	}
-	if expectedLine == 0 {
-		state.expectedArgsCount = 0
-		return nil
-	} else if expectedLine > 0 { // 有参数 设置状态机
-		// first line of multi bulk reply
-		state.msgType = msg[0]                       // 消息类型为数组：*
-		state.readingMultiLine = true                // 多行消息
-		state.expectedArgsCount = int(expectedLine)  // 元素（参数）个数
-		state.args = make([][]byte, 0, expectedLine) // 初始化切片 为即将解析的参数分配内存
-		return nil
-	} else {
-		return errors.New("protocol error: " + string(msg))
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, p.reader, n); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
 	}
+	return buf.Bytes(), nil
 }
 
-/*$5\r\n  */
-func parseBulkHeader(msg []byte, state *readState) error {
-	var err error
-	// 读取字符个数 赋给状态机bulkLen
-	state.bulkLen, err = strconv.ParseInt(string(msg[1:len(msg)-2]), 10, 64)
-	if err != nil {
-		return errors.New("protocol error: " + string(msg))
+// consume counts n bytes of the request being read, returns error if query buffer limit is exceeded
+func (p *Parser) consume(n int64) error {
+	p.queryLen += n
+	if p.queryBufferLimit > 0 && p.queryLen > p.queryBufferLimit {
+		return errQueryBufferLimit
 	}
-	if state.bulkLen == -1 { // null bulk
-		return nil
-	} else if state.bulkLen > 0 {
-		state.msgType = msg[0]            // 消息类型为字符串：$
-		state.readingMultiLine = true     // 多行消息（协议头+字符串）
-		state.expectedArgsCount = 1       // 单行字符串
-		state.args = make([][]byte, 0, 1) // 初始化切片 为即将解析的字符串分配内存
-		return nil
-	} else {
-		return errors.New("protocol error: " + string(msg))
+	return nil
+}
+
+// readLimitedLine reads a line no longer than limit, too long line is regarded as an io error
+// because the connection should be closed
+func readLimitedLine(bufReader *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := bufReader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if err == nil {
+			return line, nil
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		if len(line) > limit {
+			switch line[0] {
+			case '*':
+				return nil, errTooBigMultiBulk
+			case '$':
+				return nil, errTooBigBulk
+			}
+			return nil, errTooBigInline
+		}
 	}
 }
 
+// protocolError reports an invalid line, CRLF is trimmed as the error is sent to client
+func protocolError(line []byte) error {
+	return errors.New("protocol error: " + strings.TrimRight(string(line), "\r\n"))
+}
+
 /*
 +OK\r\n          // 简单字符串
 -Error msg\r\n   // 错误类型
@@ -245,39 +260,16 @@ func parseSingleLineReply(msg []byte) (resp.Reply, error) {
 	return result, nil
 }
 
-// read the non-first lines of multi bulk reply or bulk reply
-/*
-hello\r\n (单行字符串）
-$3\r\nset\r\n$3\r\nkey\r\n$5\r\nvalue\r\n （数组 多行参数）读进来时只有 $3\r\n
-*/
-func readBody(msg []byte, state *readState) error {
-	line := msg[0 : len(msg)-2] // 去掉最后的\r\n
-	var err error
-	if line[0] == '$' { //数组的第一个参数 $3
-		// bulk reply
-		state.bulkLen, err = strconv.ParseInt(string(line[1:]), 10, 64)
-		if err != nil {
-			return errors.New("protocol error: " + string(msg))
-		}
-		if state.bulkLen <= 0 { // null bulk in multi bulks
-			state.args = append(state.args, []byte{})
-			state.bulkLen = 0
-		}
-	} else { //单行字符串 hello
-		state.args = append(state.args, line) //填入状态机已解析参数
-	}
-	return nil
-}
-
 // discardInvalidData 跳过无效数据直到找到下一个RESP命令头
 func discardInvalidData(bufReader *bufio.Reader) {
-	for {
+	// only buffered data is discarded, otherwise the error reply is delayed until more data arrives
+	for bufReader.Buffered() > 0 {
 		b, err := bufReader.ReadByte()
 		if err != nil {
 			return // 遇到I/O错误或EOF则退出
 		}
 		// 检查是否是合法的RESP类型起始字符
-		if b == '*' || b == '$' || b == '+' || b == '-' || b == ':' {
+		if strings.IndexByte("*$+-:#_,(!=%~>|", b) >= 0 {
 			bufReader.UnreadByte() // 将合法字符放回缓冲区
 			return
 		}
@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"go-redis/resp/reply"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var benchCmd = reply.MakeMultiBulkReply([][]byte{
+	[]byte("SET"), []byte("key:000000001"), bytes.Repeat([]byte("v"), 64),
+}).ToBytes()
+
+// BenchmarkParser_ReadCommand reads pipelined requests synchronously as the server does
+func BenchmarkParser_ReadCommand(b *testing.B) {
+	p := NewParser(bytes.NewReader(bytes.Repeat(benchCmd, b.N)))
+	b.SetBytes(int64(len(benchCmd)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := p.ReadCommand(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseStream reads the same requests through the goroutine and channel of ParseStream,
+// which was used by the server before requests were parsed synchronously
+func BenchmarkParseStream(b *testing.B) {
+	ch := ParseStream(bytes.NewReader(bytes.Repeat(benchCmd, b.N)))
+	b.SetBytes(int64(len(benchCmd)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		payload := <-ch
+		if payload.Err != nil {
+			b.Fatal(payload.Err)
+		}
+		if _, ok := payload.Data.(*reply.MultiBulkReply); !ok {
+			b.Fatal("not a multi bulk reply")
+		}
+	}
+}
+
+func TestParseInlineCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+		err  error
+	}{
+		{"PING\r\n", []string{"PING"}, nil},
+		{"  set  key\tvalue \n", []string{"set", "key", "value"}, nil},
+		{"\r\n", []string{}, nil},
+		{`set key "hello world"`, []string{"set", "key", "hello world"}, nil},
+		{`set key ""`, []string{"set", "key", ""}, nil},
+		{`echo "a\nb\tc\"d\\"`, []string{"echo", "a\nb\tc\"d\\"}, nil},
+		{`echo "\x41\x62\x7a"`, []string{"echo", "Abz"}, nil},
+		// invalid hex escape is kept as x
+		{`echo "\xZZ"`, []string{"echo", "xZZ"}, nil},
+		{`echo 'it\'s'`, []string{"echo", "it's"}, nil},
+		// only \' is an escape in single quotes
+		{`echo 'a\nb'`, []string{"echo", `a\nb`}, nil},
+		{`echo a"b"`, []string{"echo", "ab"}, nil},
+		{`echo "abc`, nil, errUnbalancedQuotes},
+		{`echo 'abc`, nil, errUnbalancedQuotes},
+		{`echo "abc"def`, nil, errUnbalancedQuotes},
+		{`echo 'abc'def`, nil, errUnbalancedQuotes},
+	}
+	for _, tt := range tests {
+		args, err := parseInlineCommand([]byte(tt.line))
+		if err != tt.err {
+			t.Errorf("%q: expected error %v, actually %v", tt.line, tt.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := toStrings(args); !reflect.DeepEqual(got, tt.args) {
+			t.Errorf("%q: expected %q, actually %q", tt.line, tt.args, got)
+		}
+	}
+}
+
+func toStrings(args [][]byte) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result
+}
+
+// readAll reads commands until io.EOF or a fatal error, commands are joined by space and errors are prefixed by "error: "
+func readAll(p *Parser) (results []string, fatalErr error) {
+	for {
+		args, fatal, err := p.ReadCommand()
+		if err == io.EOF {
+			return results, nil
+		}
+		if fatal {
+			return results, err
+		}
+		if err != nil {
+			results = append(results, "error: "+err.Error())
+			continue
+		}
+		results = append(results, strings.Join(toStrings(args), " "))
+	}
+}
+
+func TestParser_ReadCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		results []string
+		fatal   error
+	}{
+		{"multi bulk", "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", []string{"GET key"}, nil},
+		{"empty bulk", "*2\r\n$3\r\nGET\r\n$0\r\n\r\n", []string{"GET "}, nil},
+		{"binary bulk", "*2\r\n$4\r\nECHO\r\n$4\r\na\r\nb\r\n", []string{"ECHO a\r\nb"}, nil},
+		{"pipelined", "*1\r\n$4\r\nPING\r\nPING\r\n*2\r\n$4\r\nECHO\r\n$1\r\na\r\n", []string{"PING", "PING", "ECHO a"}, nil},
+		{"inline", "SET k \"v v\"\r\nGET k\n", []string{"SET k v v", "GET k"}, nil},
+		{"empty lines", "\r\n\n  \r\nPING\r\n", []string{"PING"}, nil},
+		// like redis, null or empty multi bulk is ignored
+		{"null multi bulk", "*-1\r\n*1\r\n$4\r\nPING\r\n", []string{"PING"}, nil},
+		{"empty multi bulk", "*0\r\nPING\r\n", []string{"PING"}, nil},
+		// null bulk is not a valid argument
+		{"null bulk", "*2\r\n$3\r\nGET\r\n$-1\r\nPING\r\n", nil, errInvalidBulkLen},
+		{"negative bulk length", "*1\r\n$-2\r\n", nil, errInvalidBulkLen},
+		{"unbalanced quotes", "ECHO \"a\r\nPING\r\n", []string{"error: " + errUnbalancedQuotes.Error(), "PING"}, nil},
+		{"invalid multi bulk length", "*x\r\n*1\r\n$4\r\nPING\r\n", []string{"error: protocol error: *x", "PING"}, nil},
+		{"bulk expected", "*1\r\n:1\r\n", nil, errors.New("protocol error: :1")},
+		{"bulk not terminated", "*1\r\n$1\r\nab\r\n", nil, errors.New("protocol error: bulk string is not terminated by CRLF")},
+		{"truncated bulk", "*1\r\n$4\r\nPI", nil, io.ErrUnexpectedEOF},
+		{"multi bulk length exceeds int32", "*2147483648\r\n", nil, errInvalidMultiBulkLen},
+		{"too big inline", strings.Repeat("a", 2*maxInlineLen), nil, errTooBigInline},
+		{"too big mbulk count", "*" + strings.Repeat("1", 2*maxInlineLen), nil, errTooBigMultiBulk},
+		{"too big bulk count", "*1\r\n$" + strings.Repeat("1", 2*maxInlineLen), nil, errTooBigBulk},
+	}
+	// bulk strings may be split across reads
+	readers := map[string]func(io.Reader) io.Reader{
+		"whole":    func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+	}
+	for readerName, wrap := range readers {
+		for _, tt := range tests {
+			p := &Parser{reader: bufio.NewReaderSize(wrap(strings.NewReader(tt.input)), readBufferSize)}
+			results, err := readAll(p)
+			if !reflect.DeepEqual(results, tt.results) {
+				t.Errorf("%s, %s: expected %q, actually %q", tt.name, readerName, tt.results, results)
+			}
+			if !sameError(err, tt.fatal) {
+				t.Errorf("%s, %s: expected fatal error %v, actually %v", tt.name, readerName, tt.fatal, err)
+			}
+		}
+	}
+}
+
+func sameError(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Error() == b.Error()
+}
+
+func TestParser_Limits(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// limits of Parser
+		maxBulkLen, maxMultibulkLen, queryBufferLimit int64
+		results                                       []string
+		fatal                                         error
+	}{
+		{"bulk within limit", "*1\r\n$4\r\nPING\r\n", 4, 0, 0, []string{"PING"}, nil},
+		{"too big bulk", "*1\r\n$5\r\nHELLO\r\n", 4, 0, 0, nil, errInvalidBulkLen},
+		{"multi bulk within limit", "*2\r\n$4\r\nECHO\r\n$1\r\na\r\n", 0, 2, 0, []string{"ECHO a"}, nil},
+		{"too big multi bulk", "*3\r\n$3\r\nDEL\r\n$1\r\na\r\n$1\r\nb\r\n", 0, 2, 0, nil, errInvalidMultiBulkLen},
+		// the request is 21 bytes
+		{"query within limit", "*2\r\n$4\r\nECHO\r\n$1\r\na\r\n", 0, 0, 21, []string{"ECHO a"}, nil},
+		{"query buffer limit", "*2\r\n$4\r\nECHO\r\n$2\r\nab\r\n", 0, 0, 21, nil, errQueryBufferLimit},
+		// the limit is applied to each request rather than the whole connection
+		{"pipelined requests within limit", strings.Repeat("*2\r\n$4\r\nECHO\r\n$1\r\na\r\n", 3), 0, 0, 21,
+			[]string{"ECHO a", "ECHO a", "ECHO a"}, nil},
+		// claimed length is rejected before data is received
+		{"huge bulk", "*1\r\n$1000000000\r\n", 0, 0, 1024, nil, errQueryBufferLimit},
+	}
+	for _, tt := range tests {
+		p := &Parser{
+			reader:           bufio.NewReaderSize(strings.NewReader(tt.input), readBufferSize),
+			maxBulkLen:       tt.maxBulkLen,
+			maxMultibulkLen:  tt.maxMultibulkLen,
+			queryBufferLimit: tt.queryBufferLimit,
+		}
+		results, err := readAll(p)
+		if !reflect.DeepEqual(results, tt.results) {
+			t.Errorf("%s: expected %q, actually %q", tt.name, tt.results, results)
+		}
+		if err != tt.fatal {
+			t.Errorf("%s: expected fatal error %v, actually %v", tt.name, tt.fatal, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// parseReplies reads replies of RESP2 and RESP3 from server, aggregate replies may be nested
+func parseReplies(bufReader *bufio.Reader, ch chan<- *Payload) {
+	for {
+		result, ioErr, err := readReply(bufReader)
+		if err != nil {
+			if ioErr {
+				ch <- &Payload{Err: err}
+				close(ch)
+				return
+			}
+			discardInvalidData(bufReader)
+			ch <- &Payload{Err: err}
+			continue
+		}
+		ch <- &Payload{Data: result}
+	}
+}
+
+// ReadReply reads a single reply of RESP2 or RESP3, such as the reply of handshake before a client starts pipelining
+func ReadReply(bufReader *bufio.Reader) (resp.Reply, error) {
+	result, _, err := readReply(bufReader)
+	return result, err
+}
+
+// readReply reads a complete reply, returns the reply, whether it's io error, and error
+func readReply(bufReader *bufio.Reader) (resp.Reply, bool, error) {
+	line, err := bufReader.ReadBytes('\n')
+	if err != nil {
+		return nil, true, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, false, errors.New("protocol error: " + string(line))
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+', '-', ':':
+		r, err := parseSingleLineReply(line)
+		return r, false, err
+	case '$', '=', '!':
+		return readBlob(bufReader, line)
+	case '*', '~', '>':
+		return readAggregate(bufReader, line)
+	case '%', '|':
+		size, err := strconv.Atoi(string(body))
+		if err != nil || size < 0 {
+			return nil, false, errors.New("protocol error: " + string(line))
+		}
+		keys := make([]resp.Reply, size)
+		values := make([]resp.Reply, size)
+		for i := 0; i < size; i++ {
+			var ioErr bool
+			if keys[i], ioErr, err = readReply(bufReader); err != nil {
+				return nil, ioErr, err
+			}
+			if values[i], ioErr, err = readReply(bufReader); err != nil {
+				return nil, ioErr, err
+			}
+		}
+		m := reply.MakeMapReply(keys, values)
+		if line[0] == '%' {
+			return m, false, nil
+		}
+		// attributes are followed by the actual reply
+		r, ioErr, err := readReply(bufReader)
+		if err != nil {
+			return nil, ioErr, err
+		}
+		return reply.MakeAttributeReply(m, r), false, nil
+	case '_':
+		return reply.MakeNullReply(), false, nil
+	case ',':
+		return parseDouble(body)
+	case '#':
+		switch string(body) {
+		case "t":
+			return reply.MakeBooleanReply(true), false, nil
+		case "f":
+			return reply.MakeBooleanReply(false), false, nil
+		}
+	case '(':
+		if _, ok := new(big.Int).SetString(string(body), 10); ok {
+			return reply.MakeBigNumberReply(string(body)), false, nil
+		}
+	}
+	return nil, false, errors.New("protocol error: " + string(line))
+}
+
+// readBlob reads bulk string, verbatim string and blob error
+func readBlob(bufReader *bufio.Reader, header []byte) (resp.Reply, bool, error) {
+	size, err := strconv.ParseInt(string(header[1:len(header)-2]), 10, 64)
+	if err != nil || size < -1 || (size == -1 && header[0] != '$') {
+		return nil, false, errors.New("protocol error: " + string(header))
+	}
+	if size == -1 {
+		return reply.MakeNullBulkReply(), false, nil
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(bufReader, data); err != nil {
+		return nil, true, err
+	}
+	if !bytes.HasSuffix(data, []byte(reply.CRLF)) {
+		return nil, false, errors.New("protocol error: bulk string is not terminated by CRLF")
+	}
+	data = data[:size]
+	switch header[0] {
+	case '=':
+		// <format>:<text>
+		if len(data) < 4 || data[3] != ':' {
+			return nil, false, errors.New("protocol error: invalid verbatim string")
+		}
+		return reply.MakeVerbatimReply(string(data[:3]), data[4:]), false, nil
+	case '!':
+		return reply.MakeErrReply(string(data)), false, nil
+	}
+	return reply.MakeBulkReply(data), false, nil
+}
+
+// readAggregate reads array, set and push. An array of strings is returned as MultiBulkReply
+func readAggregate(bufReader *bufio.Reader, header []byte) (resp.Reply, bool, error) {
+	size, err := strconv.Atoi(string(header[1 : len(header)-2]))
+	if err != nil || size < -1 || (size == -1 && header[0] != '*') {
+		return nil, false, errors.New("protocol error: " + string(header))
+	}
+	if size == -1 {
+		return reply.MakeNullMultiBulkReply(), false, nil
+	}
+	if size == 0 && header[0] == '*' {
+		return reply.MakeEmptyMultiBulkReply(), false, nil
+	}
+	replies := make([]resp.Reply, size)
+	for i := 0; i < size; i++ {
+		var ioErr bool
+		if replies[i], ioErr, err = readReply(bufReader); err != nil {
+			return nil, ioErr, err
+		}
+	}
+	switch header[0] {
+	case '~':
+		return reply.MakeSetReply(replies), false, nil
+	case '>':
+		return reply.MakePushReply(replies), false, nil
+	}
+	args := make([][]byte, size)
+	for i, r := range replies {
+		switch r := r.(type) {
+		case *reply.BulkReply:
+			args[i] = r.Arg
+		case *reply.NullBulkReply:
+			args[i] = nil
+		default:
+			return reply.MakeMultiRawReply(replies), false, nil
+		}
+	}
+	return reply.MakeMultiBulkReply(args), false, nil
+}
+
+func parseDouble(body []byte) (resp.Reply, bool, error) {
+	var value float64
+	switch string(body) {
+	case "inf", "+inf":
+		value = math.Inf(1)
+	case "-inf":
+		value = math.Inf(-1)
+	case "nan":
+		value = math.NaN()
+	default:
+		var err error
+		value, err = strconv.ParseFloat(string(body), 64)
+		if err != nil {
+			return nil, false, errors.New("protocol error: invalid double " + string(body))
+		}
+	}
+	return reply.MakeDoubleReply(value), false, nil
+}
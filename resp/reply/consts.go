@@ -60,6 +60,36 @@ func MakeEmptyMultiBulkReply() *EmptyMultiBulkReply {
 	return theEmptyMultiBulkReply
 }
 
+// null list reply, such as EXEC aborted by WATCH
+type NullMultiBulkReply struct{}
+
+var nullMultiBulkBytes = []byte("*-1\r\n")
+
+func (r *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
+var theNullMultiBulkReply = new(NullMultiBulkReply)
+
+func MakeNullMultiBulkReply() *NullMultiBulkReply {
+	return theNullMultiBulkReply
+}
+
+// queued reply, returned for commands enqueued in a transaction
+type QueuedReply struct{}
+
+var queuedBytes = []byte("+QUEUED\r\n")
+
+func (r *QueuedReply) ToBytes() []byte {
+	return queuedBytes
+}
+
+var theQueuedReply = new(QueuedReply)
+
+func MakeQueuedReply() *QueuedReply {
+	return theQueuedReply
+}
+
 // nothing reply
 type NoReply struct{}
 
@@ -0,0 +1,351 @@
+package reply
+
+import (
+	"bytes"
+	"go-redis/interface/resp"
+	"math"
+	"strconv"
+)
+
+// Encode marshals reply in the protocol version negotiated by HELLO
+func Encode(r resp.Reply, protocol int) []byte {
+	if protocol == resp.Resp3 {
+		if r3, ok := r.(resp.Resp3Reply); ok {
+			return r3.ToResp3Bytes()
+		}
+	}
+	return r.ToBytes()
+}
+
+var nullBytes = []byte("_" + CRLF)
+
+// RESP3 encoding of replies defined in RESP2
+
+// ToResp3Bytes marshals null bulk as RESP3 null
+func (r *NullBulkReply) ToResp3Bytes() []byte {
+	return nullBytes
+}
+
+// ToResp3Bytes marshals null list as RESP3 null
+func (r *NullMultiBulkReply) ToResp3Bytes() []byte {
+	return nullBytes
+}
+
+// ToResp3Bytes marshals empty bulk as RESP3 null, the same as RESP2
+func (r *BulkReply) ToResp3Bytes() []byte {
+	if len(r.Arg) == 0 {
+		return nullBytes
+	}
+	return r.ToBytes()
+}
+
+// ToResp3Bytes marshals nil elements as RESP3 null
+func (r *MultiBulkReply) ToResp3Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(r.Args)) + CRLF)
+	for _, arg := range r.Args {
+		if arg == nil {
+			buf.Write(nullBytes)
+		} else {
+			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
+		}
+	}
+	return buf.Bytes()
+}
+
+// ToResp3Bytes marshals elements in RESP3
+func (r *MultiRawReply) ToResp3Bytes() []byte {
+	return encodeAggregate('*', r.Replies, resp.Resp3)
+}
+
+// encodeAggregate marshals aggregate type such as array, set and push
+func encodeAggregate(prefix byte, replies []resp.Reply, protocol int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(prefix)
+	buf.WriteString(strconv.Itoa(len(replies)) + CRLF)
+	for _, r := range replies {
+		buf.Write(Encode(r, protocol))
+	}
+	return buf.Bytes()
+}
+
+/* ---- Null Reply ---- */
+
+// NullReply represents RESP3 null, it's null bulk in RESP2
+type NullReply struct{}
+
+// ToBytes marshals RESP2 null bulk
+func (r *NullReply) ToBytes() []byte {
+	return nullBulkBytes
+}
+
+// ToResp3Bytes marshals RESP3 null
+func (r *NullReply) ToResp3Bytes() []byte {
+	return nullBytes
+}
+
+var theNullReply = new(NullReply)
+
+// MakeNullReply creates NullReply
+func MakeNullReply() *NullReply {
+	return theNullReply
+}
+
+/* ---- Map Reply ---- */
+
+// MapReply stores key value pairs in order, it's a flat array of keys and values in RESP2
+type MapReply struct {
+	Keys   []resp.Reply
+	Values []resp.Reply
+}
+
+// MakeMapReply creates MapReply, keys and values should have the same length
+func MakeMapReply(keys []resp.Reply, values []resp.Reply) *MapReply {
+	return &MapReply{Keys: keys, Values: values}
+}
+
+// ToBytes marshals RESP2 flat array
+func (r *MapReply) ToBytes() []byte {
+	return encodeAggregate('*', r.flatten(), resp.Resp2)
+}
+
+// ToResp3Bytes marshals RESP3 map
+func (r *MapReply) ToResp3Bytes() []byte {
+	return encodeMap('%', r.Keys, r.Values)
+}
+
+func (r *MapReply) flatten() []resp.Reply {
+	replies := make([]resp.Reply, 0, len(r.Keys)*2)
+	for i := range r.Keys {
+		replies = append(replies, r.Keys[i], r.Values[i])
+	}
+	return replies
+}
+
+func encodeMap(prefix byte, keys []resp.Reply, values []resp.Reply) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(prefix)
+	buf.WriteString(strconv.Itoa(len(keys)) + CRLF)
+	for i := range keys {
+		buf.Write(Encode(keys[i], resp.Resp3))
+		buf.Write(Encode(values[i], resp.Resp3))
+	}
+	return buf.Bytes()
+}
+
+/* ---- Pairs Reply ---- */
+
+// PairsReply stores pairs such as members and scores of ZRANGE WITHSCORES,
+// it's an array of 2-element arrays in RESP3 and a flat array in RESP2
+type PairsReply struct {
+	Keys   []resp.Reply
+	Values []resp.Reply
+}
+
+// MakePairsReply creates PairsReply, keys and values should have the same length
+func MakePairsReply(keys []resp.Reply, values []resp.Reply) *PairsReply {
+	return &PairsReply{Keys: keys, Values: values}
+}
+
+// ToBytes marshals RESP2 flat array
+func (r *PairsReply) ToBytes() []byte {
+	m := MapReply(*r)
+	return m.ToBytes()
+}
+
+// ToResp3Bytes marshals RESP3 array of pairs
+func (r *PairsReply) ToResp3Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(r.Keys)) + CRLF)
+	for i := range r.Keys {
+		buf.WriteString("*2" + CRLF)
+		buf.Write(Encode(r.Keys[i], resp.Resp3))
+		buf.Write(Encode(r.Values[i], resp.Resp3))
+	}
+	return buf.Bytes()
+}
+
+/* ---- Set Reply ---- */
+
+// SetReply stores unordered members, it's an array in RESP2
+type SetReply struct {
+	Members []resp.Reply
+}
+
+// MakeSetReply creates SetReply
+func MakeSetReply(members []resp.Reply) *SetReply {
+	return &SetReply{Members: members}
+}
+
+// ToBytes marshals RESP2 array
+func (r *SetReply) ToBytes() []byte {
+	return encodeAggregate('*', r.Members, resp.Resp2)
+}
+
+// ToResp3Bytes marshals RESP3 set
+func (r *SetReply) ToResp3Bytes() []byte {
+	return encodeAggregate('~', r.Members, resp.Resp3)
+}
+
+/* ---- Push Reply ---- */
+
+// PushReply stores out of band data such as pub/sub messages, it's an array in RESP2
+type PushReply struct {
+	Replies []resp.Reply
+}
+
+// MakePushReply creates PushReply
+func MakePushReply(replies []resp.Reply) *PushReply {
+	return &PushReply{Replies: replies}
+}
+
+// ToBytes marshals RESP2 array
+func (r *PushReply) ToBytes() []byte {
+	return encodeAggregate('*', r.Replies, resp.Resp2)
+}
+
+// ToResp3Bytes marshals RESP3 push
+func (r *PushReply) ToResp3Bytes() []byte {
+	return encodeAggregate('>', r.Replies, resp.Resp3)
+}
+
+/* ---- Attribute Reply ---- */
+
+// AttributeReply attaches auxiliary data to a reply, the attributes are omitted in RESP2
+type AttributeReply struct {
+	Attributes *MapReply
+	Reply      resp.Reply
+}
+
+// MakeAttributeReply creates AttributeReply
+func MakeAttributeReply(attributes *MapReply, r resp.Reply) *AttributeReply {
+	return &AttributeReply{Attributes: attributes, Reply: r}
+}
+
+// ToBytes marshals the reply without attributes
+func (r *AttributeReply) ToBytes() []byte {
+	return r.Reply.ToBytes()
+}
+
+// ToResp3Bytes marshals attributes followed by the reply
+func (r *AttributeReply) ToResp3Bytes() []byte {
+	data := encodeMap('|', r.Attributes.Keys, r.Attributes.Values)
+	return append(data, Encode(r.Reply, resp.Resp3)...)
+}
+
+/* ---- Double Reply ---- */
+
+// DoubleReply stores a float number, it's a bulk string in RESP2
+type DoubleReply struct {
+	Value float64
+}
+
+// MakeDoubleReply creates DoubleReply
+func MakeDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{Value: value}
+}
+
+// FormatDouble formats float in the same way as redis, e.g. 1.5, 3, inf, -inf
+func FormatDouble(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// ToBytes marshals RESP2 bulk string
+func (r *DoubleReply) ToBytes() []byte {
+	s := FormatDouble(r.Value)
+	return []byte("$" + strconv.Itoa(len(s)) + CRLF + s + CRLF)
+}
+
+// ToResp3Bytes marshals RESP3 double
+func (r *DoubleReply) ToResp3Bytes() []byte {
+	return []byte("," + FormatDouble(r.Value) + CRLF)
+}
+
+/* ---- Boolean Reply ---- */
+
+// BooleanReply stores true or false, it's integer 1 or 0 in RESP2
+type BooleanReply struct {
+	Value bool
+}
+
+var (
+	trueReply  = &BooleanReply{Value: true}
+	falseReply = &BooleanReply{Value: false}
+)
+
+// MakeBooleanReply creates BooleanReply
+func MakeBooleanReply(value bool) *BooleanReply {
+	if value {
+		return trueReply
+	}
+	return falseReply
+}
+
+// ToBytes marshals RESP2 integer
+func (r *BooleanReply) ToBytes() []byte {
+	if r.Value {
+		return []byte(":1" + CRLF)
+	}
+	return []byte(":0" + CRLF)
+}
+
+// ToResp3Bytes marshals RESP3 boolean
+func (r *BooleanReply) ToResp3Bytes() []byte {
+	if r.Value {
+		return []byte("#t" + CRLF)
+	}
+	return []byte("#f" + CRLF)
+}
+
+/* ---- Big Number Reply ---- */
+
+// BigNumberReply stores an integer out of the range of int64 in decimal, it's a bulk string in RESP2
+type BigNumberReply struct {
+	Value string
+}
+
+// MakeBigNumberReply creates BigNumberReply
+func MakeBigNumberReply(value string) *BigNumberReply {
+	return &BigNumberReply{Value: value}
+}
+
+// ToBytes marshals RESP2 bulk string
+func (r *BigNumberReply) ToBytes() []byte {
+	return []byte("$" + strconv.Itoa(len(r.Value)) + CRLF + r.Value + CRLF)
+}
+
+// ToResp3Bytes marshals RESP3 big number
+func (r *BigNumberReply) ToResp3Bytes() []byte {
+	return []byte("(" + r.Value + CRLF)
+}
+
+/* ---- Verbatim Reply ---- */
+
+// VerbatimReply stores a text with its format such as txt and mkd, it's a bulk string in RESP2
+type VerbatimReply struct {
+	Format string // 3 bytes
+	Text   []byte
+}
+
+// MakeVerbatimReply creates VerbatimReply
+func MakeVerbatimReply(format string, text []byte) *VerbatimReply {
+	return &VerbatimReply{Format: format, Text: text}
+}
+
+// ToBytes marshals RESP2 bulk string of the text
+func (r *VerbatimReply) ToBytes() []byte {
+	return []byte("$" + strconv.Itoa(len(r.Text)) + CRLF + string(r.Text) + CRLF)
+}
+
+// ToResp3Bytes marshals RESP3 verbatim string
+func (r *VerbatimReply) ToResp3Bytes() []byte {
+	return []byte("=" + strconv.Itoa(len(r.Text)+4) + CRLF + r.Format + ":" + string(r.Text) + CRLF)
+}
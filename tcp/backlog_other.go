@@ -0,0 +1,10 @@
+//go:build !unix
+
+package tcp
+
+import "net"
+
+// setBacklog is not supported, the backlog chosen by the net package is kept
+func setBacklog(listener net.Listener, backlog int) error {
+	return nil
+}
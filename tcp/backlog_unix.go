@@ -0,0 +1,29 @@
+//go:build unix
+
+package tcp
+
+import (
+	"net"
+	"syscall"
+)
+
+// setBacklog calls listen(2) again on the listening socket, which updates its backlog.
+// The net package always uses the value of somaxconn
+func setBacklog(listener net.Listener, backlog int) error {
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	rawConn, err := tcpListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	err = rawConn.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return listenErr
+}
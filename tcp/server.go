@@ -2,6 +2,7 @@ package tcp
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"go-redis/interface/tcp"
 	"go-redis/lib/logger"
@@ -10,15 +11,24 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 type Config struct {
+	// Address of plaintext listener, empty disables it
 	Address string
+	// TLSAddress of TLS listener, empty disables it
+	TLSAddress string
+	TLSConfig  *tls.Config
+	// KeepAlive is the interval of TCP keepalive probes, 0 disables keepalive
+	KeepAlive time.Duration
+	// Backlog is the size of accept queue, 0 keeps the default of system
+	Backlog int
 }
 
 func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 	closeChan := make(chan struct{})
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
 	go func() {
 		switch <-signals {
@@ -26,42 +36,111 @@ func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 			closeChan <- struct{}{}
 		}
 	}()
-	listener, err := net.Listen("tcp", cfg.Address)
-	if err != nil {
-		panic(err)
+	if shutdowner, ok := handler.(tcp.Shutdowner); ok {
+		go func() {
+			<-shutdowner.ShutdownRequested()
+			closeChan <- struct{}{}
+		}()
 	}
-	logger.Info("start listening:", cfg.Address)
-	ListenAndServe(listener, handler, closeChan)
+	var listeners []net.Listener
+	if cfg.Address != "" {
+		listener, err := listen(cfg.Address, cfg)
+		if err != nil {
+			panic(err)
+		}
+		logger.Info("start listening:", cfg.Address)
+		listeners = append(listeners, listener)
+	}
+	if cfg.TLSAddress != "" {
+		listener, err := listen(cfg.TLSAddress, cfg)
+		if err != nil {
+			panic(err)
+		}
+		logger.Info("start listening tls:", cfg.TLSAddress)
+		// handshake is done by the first read or write in handler
+		listeners = append(listeners, tls.NewListener(listener, cfg.TLSConfig))
+	}
+	if len(listeners) == 0 {
+		return errors.New("neither port nor tls-port is configured")
+	}
+	ListenAndServe(listeners, handler, closeChan)
 	return nil
 }
 
-func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan chan struct{}) {
+// listen creates the listener, keepalive is applied to the accepted connections
+func listen(address string, cfg *Config) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: -1}
+	if cfg.KeepAlive > 0 {
+		// like redis, the connection is closed after 3 probes without response
+		lc.KeepAliveConfig = net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     cfg.KeepAlive,
+			Interval: max(cfg.KeepAlive/3, time.Second),
+			Count:    3,
+		}
+	}
+	listener, err := lc.Listen(context.Background(), "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Backlog > 0 {
+		if err := setBacklog(listener, cfg.Backlog); err != nil {
+			logger.Warn("failed to set tcp backlog: " + err.Error())
+		}
+	}
+	return listener, nil
+}
+
+func ListenAndServe(listeners []net.Listener, handler tcp.Handler, closeChan chan struct{}) {
 
 	// 使用 context 控制循环退出
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// closed is closed after handler has finished closing
+	closed := make(chan struct{})
 	go func() {
 		<-closeChan
 		logger.Info("shutdown signal received")
-		cancel()
-		_ = listener.Close()
+		// stop accepting new connections at first, then handler finishes in-flight commands and persists data
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
 		_ = handler.Close()
+		cancel()
+		close(closed)
 	}()
 
 	defer func() {
 		logger.Info("closing listener")
-		_ = listener.Close()
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
 		logger.Info("server fully stopped")
 	}()
 
 	var wg sync.WaitGroup
+	var acceptWg sync.WaitGroup
+	for _, listener := range listeners {
+		acceptWg.Add(1)
+		go func(listener net.Listener) {
+			defer acceptWg.Done()
+			serve(ctx, listener, handler, &wg)
+		}(listener)
+	}
+	acceptWg.Wait()
+	<-closed
+	wg.Wait()
+}
+
+// serve accepts connections until the listener is closed, wg counts the connections being handled
+func serve(ctx context.Context, listener net.Listener, handler tcp.Handler, wg *sync.WaitGroup) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			// 关键：检查是否为监听器关闭导致的错误
 			if errors.Is(err, net.ErrClosed) {
-				break // 退出循环
+				return // 退出循环
 			}
 			logger.Error("accept err:", err)
 			continue
@@ -73,6 +152,4 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan chan s
 			handler.Handle(ctx, conn)
 		}()
 	}
-	wg.Wait()
-
 }
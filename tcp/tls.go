@@ -0,0 +1,76 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strings"
+)
+
+// MakeServerTLSConfig creates the config of TLS listener.
+// authClients is yes, no or optional, client certificates are verified by the CA in caCertFile
+func MakeServerTLSConfig(certFile, keyFile, caCertFile, authClients string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	switch strings.ToLower(authClients) {
+	case "", "yes":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "no":
+		tlsConfig.ClientAuth = tls.NoClientCert
+		return tlsConfig, nil
+	default:
+		return nil, errors.New("invalid tls-auth-clients: " + authClients)
+	}
+	if caCertFile == "" {
+		return nil, errors.New("tls-ca-cert-file is required to authenticate clients")
+	}
+	if tlsConfig.ClientCAs, err = loadCertPool(caCertFile); err != nil {
+		return nil, err
+	}
+	return tlsConfig, nil
+}
+
+// MakeClientTLSConfig creates the config of dialing servers over TLS.
+// The certificate is presented if the server authenticates clients,
+// servers are verified by the CA in caCertFile, or by the system CAs if it's empty
+func MakeClientTLSConfig(certFile, keyFile, caCertFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if caCertFile != "" {
+		pool, err := loadCertPool(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func loadCertPool(caCertFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificate found in " + caCertFile)
+	}
+	return pool, nil
+}
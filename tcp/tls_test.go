@@ -0,0 +1,151 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"go-redis/lib/testutil"
+	"testing"
+	"time"
+)
+
+// testPKI is a CA with a server certificate, a trusted client certificate and a client certificate of another CA
+type testPKI struct {
+	ca, server, client, untrusted *testutil.Cert
+}
+
+func makeTestPKI(t *testing.T) *testPKI {
+	ca := testutil.MakeCert(t, "ca", nil)
+	return &testPKI{
+		ca:        ca,
+		server:    testutil.MakeCert(t, "server", ca),
+		client:    testutil.MakeCert(t, "client", ca),
+		untrusted: testutil.MakeCert(t, "untrusted", testutil.MakeCert(t, "other-ca", nil)),
+	}
+}
+
+func TestMakeServerTLSConfig(t *testing.T) {
+	pki := makeTestPKI(t)
+	tests := []struct {
+		authClients string
+		want        tls.ClientAuthType
+	}{
+		{"", tls.RequireAndVerifyClientCert},
+		{"yes", tls.RequireAndVerifyClientCert},
+		{"optional", tls.VerifyClientCertIfGiven},
+		{"no", tls.NoClientCert},
+	}
+	for _, tt := range tests {
+		cfg, err := MakeServerTLSConfig(pki.server.CertFile, pki.server.KeyFile, pki.ca.CertFile, tt.authClients)
+		if err != nil {
+			t.Fatalf("tls-auth-clients %q: %v", tt.authClients, err)
+		}
+		if cfg.ClientAuth != tt.want {
+			t.Errorf("tls-auth-clients %q: expected client auth %v, actually %v", tt.authClients, tt.want, cfg.ClientAuth)
+		}
+		if len(cfg.Certificates) != 1 {
+			t.Errorf("tls-auth-clients %q: expected 1 certificate, actually %d", tt.authClients, len(cfg.Certificates))
+		}
+		if tt.want != tls.NoClientCert && cfg.ClientCAs == nil {
+			t.Errorf("tls-auth-clients %q: client CAs are not loaded", tt.authClients)
+		}
+	}
+
+	// CA is not needed if clients are not authenticated
+	if _, err := MakeServerTLSConfig(pki.server.CertFile, pki.server.KeyFile, "", "no"); err != nil {
+		t.Errorf("tls-auth-clients no without CA: %v", err)
+	}
+	for _, authClients := range []string{"yes", "optional"} {
+		if _, err := MakeServerTLSConfig(pki.server.CertFile, pki.server.KeyFile, "", authClients); err == nil {
+			t.Errorf("tls-auth-clients %s without CA: expected error", authClients)
+		}
+	}
+	if _, err := MakeServerTLSConfig(pki.server.CertFile, pki.server.KeyFile, pki.ca.CertFile, "maybe"); err == nil {
+		t.Error("invalid tls-auth-clients: expected error")
+	}
+	if _, err := MakeServerTLSConfig(pki.server.CertFile, pki.server.KeyFile, pki.server.KeyFile, "yes"); err == nil {
+		t.Error("CA file without certificate: expected error")
+	}
+}
+
+// startTLSServer runs ListenAndServe with an echo handler on a TLS listener and returns its address
+func startTLSServer(t *testing.T, tlsConfig *tls.Config) string {
+	return testutil.StartTLSServer(t, tlsConfig, ListenAndServe, MakeHandler())
+}
+
+// echo sends a line to the server and reads it back, a failed handshake may be reported by the read with TLS 1.3
+func echo(addr string, tlsConfig *tls.Config) error {
+	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err = conn.Write([]byte("hello\n")); err != nil {
+		return err
+	}
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	return err
+}
+
+func TestListenAndServe_TLS(t *testing.T) {
+	pki := makeTestPKI(t)
+	clientConfig := func(cert *testutil.Cert) *tls.Config {
+		var certFile, keyFile string
+		if cert != nil {
+			certFile, keyFile = cert.CertFile, cert.KeyFile
+		}
+		cfg, err := MakeClientTLSConfig(certFile, keyFile, pki.ca.CertFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert != nil {
+			// present the certificate even if it's not issued by the CAs accepted by the server
+			cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &cfg.Certificates[0], nil
+			}
+		}
+		return cfg
+	}
+	tests := []struct {
+		authClients string
+		clientCert  *testutil.Cert
+		ok          bool
+	}{
+		{"yes", pki.client, true},
+		{"yes", nil, false},
+		{"yes", pki.untrusted, false},
+		{"optional", pki.client, true},
+		{"optional", nil, true},
+		{"optional", pki.untrusted, false},
+		{"no", nil, true},
+		{"no", pki.untrusted, true},
+	}
+	for _, tt := range tests {
+		serverConfig, err := MakeServerTLSConfig(pki.server.CertFile, pki.server.KeyFile, pki.ca.CertFile, tt.authClients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := startTLSServer(t, serverConfig)
+		err = echo(addr, clientConfig(tt.clientCert))
+		name := "no client certificate"
+		if tt.clientCert != nil {
+			name = tt.clientCert.Cert.Subject.CommonName
+		}
+		if tt.ok && err != nil {
+			t.Errorf("tls-auth-clients %s with %s: %v", tt.authClients, name, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("tls-auth-clients %s with %s: expected handshake error", tt.authClients, name)
+		}
+	}
+
+	// server is verified by the client as well
+	serverConfig, err := MakeServerTLSConfig(pki.server.CertFile, pki.server.KeyFile, "", "no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startTLSServer(t, serverConfig)
+	if err := echo(addr, &tls.Config{MinVersion: tls.VersionTLS12}); err == nil {
+		t.Error("server certificate of unknown CA: expected handshake error")
+	}
+}